@@ -0,0 +1,123 @@
+// Package barejson converts BARE messages to JSON and back, according to a
+// schema.
+//
+// BARE types are mapped to JSON as follows:
+//
+//	uint, int, f32, f64      number
+//	bool                     true or false
+//	string                   string
+//	data, data<N>            string, base64 encoded with padding
+//	void                     null
+//	optional<T>              null, or the value of T
+//	[]T, [N]T                array
+//	{ fields... }            object, with fields in schema order
+//	enum                     string with the value name, or a number for
+//	                         values not listed in the schema
+//	(T | T | ...)            object with a single member, named after the type
+//	                         for named user types, or after the tag otherwise,
+//	                         e.g. {"Employee": {...}} or {"4": "text"}
+//
+// Maps are objects if their keys are strings, integers, bools or enums, with
+// the keys formatted as JSON strings, e.g. {"1": "one", "2": "two"}. Maps with
+// any other key type are arrays of objects with a "key" and a "value" member.
+//
+// When converting from JSON, unions may be given by tag even if the type is
+// named, and enums may be given by value. Floating point NaN and infinities
+// cannot be represented. Nested optional types are ambiguous when the inner
+// value is null, and are always decoded as the outer value being present.
+package barejson
+
+import (
+	"fmt"
+
+	"git.sr.ht/~runxiyu/go-bareish/schema"
+)
+
+// Converts a BARE message of the named user-defined type to JSON. Data after
+// the message is rejected with a *bare.TrailingDataError.
+func ToJSON(types []schema.SchemaType, root string, msg []byte) ([]byte, error) {
+	val, err := schema.DecodeDynamic(types, root, msg)
+	if err != nil {
+		return nil, err
+	}
+	return ValueToJSON(types, root, val)
+}
+
+// Converts JSON to a BARE message of the named user-defined type. See ToJSON.
+func FromJSON(types []schema.SchemaType, root string, data []byte) ([]byte, error) {
+	val, err := ValueFromJSON(types, root, data)
+	if err != nil {
+		return nil, err
+	}
+	return schema.EncodeDynamic(types, root, val)
+}
+
+// Returned when a value cannot be converted. It describes the value which
+// failed and wraps the underlying error.
+type Error struct {
+	// Path to the value from the root type, made of schema type names,
+	// struct field names, indices and map keys. See schema.ValueError.
+	Path string
+	// The underlying error
+	Err error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Path, e.Err.Error())
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func wrapError(err error, seg string) error {
+	if e, ok := err.(*Error); ok {
+		e.Path = seg + e.Path
+		return e
+	}
+	return &Error{Path: seg, Err: err}
+}
+
+type transcoder struct {
+	*schema.Resolver
+}
+
+func newTranscoder(types []schema.SchemaType) *transcoder {
+	return &transcoder{schema.NewResolver(types)}
+}
+
+// Resolves the named root type of a message.
+func (t *transcoder) lookup(root string) (schema.Type, *schema.UserDefinedEnum, error) {
+	return t.Resolve(schema.NewNamedUserType(root))
+}
+
+// Reports whether map keys of the given type are represented as JSON object
+// keys.
+func (t *transcoder) objectKey(ty schema.Type) bool {
+	ty, enum, err := t.Resolve(ty)
+	if err != nil {
+		return false
+	}
+	if enum != nil {
+		return true
+	}
+	switch ty.Kind() {
+	case schema.UINT, schema.U8, schema.U16, schema.U32, schema.U64,
+		schema.INT, schema.I8, schema.I16, schema.I32, schema.I64,
+		schema.Bool, schema.String:
+		return true
+	}
+	return false
+}
+
+func unionSegment(ust schema.UnionSubtype) string {
+	return fmt.Sprintf(".(%s)", unionKey(ust))
+}
+
+// Returns the JSON object key for a union member.
+func unionKey(ust schema.UnionSubtype) string {
+	if named, ok := ust.Type().(*schema.NamedUserType); ok {
+		return named.Name()
+	}
+	return fmt.Sprintf("%d", ust.Tag())
+}
@@ -0,0 +1,133 @@
+package barejson
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"git.sr.ht/~runxiyu/go-bareish/schema"
+)
+
+func loadExampleSchema(t *testing.T) []schema.SchemaType {
+	f, err := os.Open("../example/schema.bare")
+	assert.NoError(t, err)
+	defer f.Close()
+	types, err := schema.Parse(f)
+	assert.NoError(t, err)
+	return types
+}
+
+func TestExamples(t *testing.T) {
+	types := loadExampleSchema(t)
+
+	for _, name := range []string{"customer", "employee", "terminated"} {
+		msg, err := ioutil.ReadFile("../example/" + name + ".bin")
+		assert.NoError(t, err)
+
+		data, err := ToJSON(types, "Person", msg)
+		assert.NoError(t, err, name)
+
+		out, err := FromJSON(types, "Person", data)
+		assert.NoError(t, err, name)
+		assert.Equal(t, msg, out, name)
+	}
+}
+
+func TestToJSON(t *testing.T) {
+	types := loadExampleSchema(t)
+
+	msg, err := ioutil.ReadFile("../example/terminated.bin")
+	assert.NoError(t, err)
+	data, err := ToJSON(types, "Person", msg)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"TerminatedEmployee":null}`, string(data))
+
+	data, err = ToJSON(types, "Department", []byte{0x63})
+	assert.NoError(t, err)
+	assert.Equal(t, `"JSMITH"`, string(data))
+
+	data, err = ToJSON(types, "Department", []byte{0x07})
+	assert.NoError(t, err)
+	assert.Equal(t, `7`, string(data))
+}
+
+const mappingSchema = `
+	enum Color {
+		RED
+		GREEN
+	}
+
+	type Mapping {
+		colors: map[Color]string
+		ints: map[i8]bool
+		points: map[data<2>]f32
+		extra: (Color | string | void)
+		maybe: optional<data>
+	}
+`
+
+func TestMappings(t *testing.T) {
+	types, err := schema.Parse(strings.NewReader(mappingSchema))
+	assert.NoError(t, err)
+
+	msg := []byte{
+		0x01, 0x01, 0x01, 0x67, // colors
+		0x01, 0xFF, 0x01, // ints
+		0x01, 0x13, 0x37, 0x00, 0x00, 0xC0, 0x3F, // points
+		0x01, 0x02, 0x3C, 0x3E, // extra
+		0x00, // maybe
+	}
+	expected := `{"colors":{"GREEN":"g"},"ints":{"-1":true},` +
+		`"points":[{"key":"Ezc=","value":1.5}],"extra":{"1":"<>"},"maybe":null}`
+
+	data, err := ToJSON(types, "Mapping", msg)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, string(data))
+
+	out, err := FromJSON(types, "Mapping", data)
+	assert.NoError(t, err)
+	assert.Equal(t, msg, out)
+
+	// Unions may be given by tag, and enums by value
+	out, err = FromJSON(types, "Mapping", []byte(`{
+		"colors": {"1": "g"},
+		"ints": {"-1": true},
+		"points": [{"value": 1.5, "key": "Ezc="}],
+		"extra": {"0": 1},
+		"maybe": "AQI="
+	}`))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{
+		0x01, 0x01, 0x01, 0x67,
+		0x01, 0xFF, 0x01,
+		0x01, 0x13, 0x37, 0x00, 0x00, 0xC0, 0x3F,
+		0x00, 0x01,
+		0x01, 0x02, 0x01, 0x02,
+	}, out)
+}
+
+func TestFromJSONErrors(t *testing.T) {
+	types := loadExampleSchema(t)
+
+	_, err := FromJSON(types, "Address", []byte(`{"address": []}`))
+	var e *Error
+	assert.True(t, errors.As(err, &e))
+	assert.Equal(t, "Address.city", e.Path)
+	assert.EqualError(t, e.Err, "Missing struct field")
+
+	_, err = FromJSON(types, "Person", []byte(`{"Manager": null}`))
+	assert.EqualError(t, err, "Person: Unknown union member Manager")
+
+	_, err = FromJSON(types, "Department", []byte(`"CEO"`))
+	assert.EqualError(t, err, "Department: Unknown value CEO for enum Department")
+
+	_, err = FromJSON(types, "Customer", []byte(`{"name": 1}`))
+	assert.EqualError(t, err, "Customer.name: Expected JSON string, got number")
+
+	_, err = FromJSON(types, "Time", []byte(`"now" "later"`))
+	assert.EqualError(t, err, "Unexpected data after JSON value")
+}
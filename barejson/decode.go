@@ -0,0 +1,384 @@
+package barejson
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"git.sr.ht/~runxiyu/go-bareish/schema"
+)
+
+// Converts JSON to a dynamic value of the named user-defined type. See
+// schema.EncodeDynamic.
+func ValueFromJSON(types []schema.SchemaType, root string, data []byte) (schema.Value, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	j, err := parseJSON(dec)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("Unexpected data after JSON value")
+	}
+
+	t := newTranscoder(types)
+	ty, enum, err := t.lookup(root)
+	var val schema.Value
+	if err == nil {
+		val, err = t.decode(ty, enum, j)
+	}
+	if err != nil {
+		return nil, wrapError(err, root)
+	}
+	return val, nil
+}
+
+// A JSON object, with its members in the order they appear in the input.
+type object []member
+
+type member struct {
+	key   string
+	value interface{}
+}
+
+// Parses a JSON value into nil, bool, json.Number, string, []interface{} or
+// object.
+func parseJSON(dec *json.Decoder) (interface{}, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	delim, ok := tok.(json.Delim)
+	if !ok {
+		return tok, nil
+	}
+
+	switch delim {
+	case '[':
+		arr := []interface{}{}
+		for dec.More() {
+			v, err := parseJSON(dec)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, v)
+		}
+		_, err = dec.Token()
+		return arr, err
+	case '{':
+		obj := object{}
+		for dec.More() {
+			tok, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			v, err := parseJSON(dec)
+			if err != nil {
+				return nil, err
+			}
+			obj = append(obj, member{tok.(string), v})
+		}
+		_, err = dec.Token()
+		return obj, err
+	}
+	return nil, fmt.Errorf("Unexpected JSON delimiter %s", delim)
+}
+
+func jsonType(j interface{}) string {
+	switch j.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "bool"
+	case json.Number:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case object:
+		return "object"
+	}
+	return fmt.Sprintf("%T", j)
+}
+
+func unexpectedJSON(expected string, j interface{}) error {
+	return fmt.Errorf("Expected JSON %s, got %s", expected, jsonType(j))
+}
+
+func (t *transcoder) decodeType(ty schema.Type, j interface{}) (schema.Value, error) {
+	ty, enum, err := t.Resolve(ty)
+	if err != nil {
+		return nil, err
+	}
+	return t.decode(ty, enum, j)
+}
+
+func (t *transcoder) decode(ty schema.Type, enum *schema.UserDefinedEnum,
+	j interface{}) (schema.Value, error) {
+	if enum != nil {
+		return decodeEnum(enum, j)
+	}
+
+	switch ty := ty.(type) {
+	case *schema.PrimitiveType:
+		return decodePrimitive(ty.Kind(), j)
+	case *schema.DataType:
+		str, ok := j.(string)
+		if !ok {
+			return nil, unexpectedJSON("string", j)
+		}
+		data, err := base64.StdEncoding.DecodeString(str)
+		if err != nil {
+			return nil, err
+		}
+		return schema.DataValue(data), nil
+	case *schema.OptionalType:
+		if j == nil {
+			return schema.OptionalValue{}, nil
+		}
+		v, err := t.decodeType(ty.Subtype(), j)
+		if err != nil {
+			return nil, err
+		}
+		return schema.OptionalValue{Value: v}, nil
+	case *schema.ArrayType:
+		return t.decodeList(ty, j)
+	case *schema.MapType:
+		return t.decodeMap(ty, j)
+	case *schema.UnionType:
+		return t.decodeUnion(ty, j)
+	case *schema.StructType:
+		return t.decodeStruct(ty, j)
+	}
+	return nil, fmt.Errorf("Unsupported type %T", ty)
+}
+
+func decodePrimitive(kind schema.TypeKind, j interface{}) (schema.Value, error) {
+	switch kind {
+	case schema.UINT, schema.U8, schema.U16, schema.U32, schema.U64:
+		n, ok := j.(json.Number)
+		if !ok {
+			return nil, unexpectedJSON("number", j)
+		}
+		v, err := strconv.ParseUint(string(n), 10, 64)
+		return schema.UintValue(v), err
+	case schema.INT, schema.I8, schema.I16, schema.I32, schema.I64:
+		n, ok := j.(json.Number)
+		if !ok {
+			return nil, unexpectedJSON("number", j)
+		}
+		v, err := strconv.ParseInt(string(n), 10, 64)
+		return schema.IntValue(v), err
+	case schema.F32, schema.F64:
+		n, ok := j.(json.Number)
+		if !ok {
+			return nil, unexpectedJSON("number", j)
+		}
+		v, err := n.Float64()
+		return schema.FloatValue(v), err
+	case schema.Bool:
+		b, ok := j.(bool)
+		if !ok {
+			return nil, unexpectedJSON("bool", j)
+		}
+		return schema.BoolValue(b), nil
+	case schema.String:
+		str, ok := j.(string)
+		if !ok {
+			return nil, unexpectedJSON("string", j)
+		}
+		return schema.StringValue(str), nil
+	case schema.Void:
+		if j != nil {
+			return nil, unexpectedJSON("null", j)
+		}
+		return schema.VoidValue{}, nil
+	}
+	return nil, fmt.Errorf("Unsupported primitive type %s", kind)
+}
+
+func decodeEnum(enum *schema.UserDefinedEnum, j interface{}) (schema.Value, error) {
+	switch j := j.(type) {
+	case string:
+		for _, ev := range enum.Values() {
+			if ev.Name() == j {
+				return schema.UserEnumValue{Name: j, Value: ev.Value()}, nil
+			}
+		}
+		return nil, fmt.Errorf("Unknown value %s for enum %s", j, enum.Name())
+	case json.Number:
+		v, err := strconv.ParseUint(string(j), 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		return schema.UserEnumValue{Value: uint(v)}, nil
+	}
+	return nil, unexpectedJSON("string", j)
+}
+
+func (t *transcoder) decodeList(ty *schema.ArrayType, j interface{}) (schema.Value, error) {
+	arr, ok := j.([]interface{})
+	if !ok {
+		return nil, unexpectedJSON("array", j)
+	}
+	list := make(schema.ListValue, 0, len(arr))
+	for i, el := range arr {
+		v, err := t.decodeType(ty.Member(), el)
+		if err != nil {
+			return nil, wrapError(err, fmt.Sprintf("[%d]", i))
+		}
+		list = append(list, v)
+	}
+	return list, nil
+}
+
+func (t *transcoder) decodeMap(ty *schema.MapType, j interface{}) (schema.Value, error) {
+	if !t.objectKey(ty.Key()) {
+		arr, ok := j.([]interface{})
+		if !ok {
+			return nil, unexpectedJSON("array", j)
+		}
+		m := make(schema.MapValue, 0, len(arr))
+		for i, el := range arr {
+			seg := fmt.Sprintf("[#%d]", i)
+			obj, ok := el.(object)
+			if !ok {
+				return nil, wrapError(unexpectedJSON("object", el), seg)
+			}
+			var entry schema.MapEntry
+			for _, mem := range obj {
+				v, err := t.decodeEntry(ty, mem)
+				if err != nil {
+					return nil, wrapError(err, seg)
+				}
+				if mem.key == "key" {
+					entry.Key = v
+				} else {
+					entry.Value = v
+				}
+			}
+			if entry.Key == nil || entry.Value == nil {
+				return nil, wrapError(
+					errors.New(`Expected "key" and "value" members`), seg)
+			}
+			m = append(m, entry)
+		}
+		return m, nil
+	}
+
+	obj, ok := j.(object)
+	if !ok {
+		return nil, unexpectedJSON("object", j)
+	}
+	m := make(schema.MapValue, 0, len(obj))
+	for _, mem := range obj {
+		seg := fmt.Sprintf("[%q]", mem.key)
+		k, err := t.decodeObjectKey(ty.Key(), mem.key)
+		if err != nil {
+			return nil, wrapError(err, seg)
+		}
+		v, err := t.decodeType(ty.Value(), mem.value)
+		if err != nil {
+			return nil, wrapError(err, seg)
+		}
+		m = append(m, schema.MapEntry{Key: k, Value: v})
+	}
+	return m, nil
+}
+
+func (t *transcoder) decodeEntry(ty *schema.MapType, mem member) (schema.Value, error) {
+	switch mem.key {
+	case "key":
+		return t.decodeType(ty.Key(), mem.value)
+	case "value":
+		return t.decodeType(ty.Value(), mem.value)
+	}
+	return nil, fmt.Errorf("Unexpected member %q in map entry", mem.key)
+}
+
+func (t *transcoder) decodeObjectKey(ty schema.Type, key string) (schema.Value, error) {
+	ty, enum, err := t.Resolve(ty)
+	if err != nil {
+		return nil, err
+	}
+	if enum != nil {
+		if _, err := strconv.ParseUint(key, 10, 64); err == nil {
+			return decodeEnum(enum, json.Number(key))
+		}
+		return decodeEnum(enum, key)
+	}
+	switch ty.Kind() {
+	case schema.Bool:
+		v, err := strconv.ParseBool(key)
+		return schema.BoolValue(v), err
+	case schema.String:
+		return schema.StringValue(key), nil
+	}
+	return decodePrimitive(ty.Kind(), json.Number(key))
+}
+
+func (t *transcoder) decodeUnion(ty *schema.UnionType, j interface{}) (schema.Value, error) {
+	obj, ok := j.(object)
+	if !ok || len(obj) != 1 {
+		return nil, errors.New("Expected JSON object with a single member for union")
+	}
+	key := obj[0].key
+	for _, ust := range ty.Types() {
+		if key != unionKey(ust) && key != strconv.FormatUint(ust.Tag(), 10) {
+			continue
+		}
+		v, err := t.decodeType(ust.Type(), obj[0].value)
+		if err != nil {
+			return nil, wrapError(err, unionSegment(ust))
+		}
+		return schema.UnionValue{Tag: ust.Tag(), Value: v}, nil
+	}
+	return nil, fmt.Errorf("Unknown union member %s", key)
+}
+
+func (t *transcoder) decodeStruct(ty *schema.StructType, j interface{}) (schema.Value, error) {
+	obj, ok := j.(object)
+	if !ok {
+		return nil, unexpectedJSON("object", j)
+	}
+	for _, mem := range obj {
+		found := false
+		for _, field := range ty.Fields() {
+			if field.Name() == mem.key {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("Unknown struct field %s", mem.key)
+		}
+	}
+
+	sv := make(schema.StructValue, 0, len(ty.Fields()))
+	for _, field := range ty.Fields() {
+		seg := "." + field.Name()
+		var (
+			j     interface{}
+			found bool
+		)
+		for _, mem := range obj {
+			if mem.key == field.Name() {
+				j, found = mem.value, true
+			}
+		}
+		if !found {
+			return nil, wrapError(errors.New("Missing struct field"), seg)
+		}
+		v, err := t.decodeType(field.Type(), j)
+		if err != nil {
+			return nil, wrapError(err, seg)
+		}
+		sv = append(sv, schema.FieldValue{Name: field.Name(), Value: v})
+	}
+	return sv, nil
+}
@@ -0,0 +1,281 @@
+package barejson
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+
+	"git.sr.ht/~runxiyu/go-bareish/schema"
+)
+
+// Converts a dynamic value of the named user-defined type to JSON. See
+// schema.DecodeDynamic.
+func ValueToJSON(types []schema.SchemaType, root string, val schema.Value) ([]byte, error) {
+	t := newTranscoder(types)
+	var buf bytes.Buffer
+	ty, enum, err := t.lookup(root)
+	if err == nil {
+		err = t.encode(&buf, ty, enum, val)
+	}
+	if err != nil {
+		return nil, wrapError(err, root)
+	}
+	return buf.Bytes(), nil
+}
+
+func (t *transcoder) encodeType(buf *bytes.Buffer, ty schema.Type, val schema.Value) error {
+	ty, enum, err := t.Resolve(ty)
+	if err != nil {
+		return err
+	}
+	return t.encode(buf, ty, enum, val)
+}
+
+func (t *transcoder) encode(buf *bytes.Buffer, ty schema.Type,
+	enum *schema.UserDefinedEnum, val schema.Value) error {
+	if enum != nil {
+		return encodeEnum(buf, val)
+	}
+
+	switch ty := ty.(type) {
+	case *schema.PrimitiveType:
+		return encodePrimitive(buf, ty.Kind(), val)
+	case *schema.DataType:
+		data, ok := val.(schema.DataValue)
+		if !ok {
+			return unexpectedValue("data", val)
+		}
+		buf.WriteByte('"')
+		buf.WriteString(base64.StdEncoding.EncodeToString(data))
+		buf.WriteByte('"')
+		return nil
+	case *schema.OptionalType:
+		v, ok := val.(schema.OptionalValue)
+		if !ok {
+			return unexpectedValue("optional", val)
+		}
+		if v.Value == nil {
+			buf.WriteString("null")
+			return nil
+		}
+		return t.encodeType(buf, ty.Subtype(), v.Value)
+	case *schema.ArrayType:
+		return t.encodeList(buf, ty, val)
+	case *schema.MapType:
+		return t.encodeMap(buf, ty, val)
+	case *schema.UnionType:
+		return t.encodeUnion(buf, ty, val)
+	case *schema.StructType:
+		return t.encodeStruct(buf, ty, val)
+	}
+	return fmt.Errorf("Unsupported type %T", ty)
+}
+
+func encodePrimitive(buf *bytes.Buffer, kind schema.TypeKind, val schema.Value) error {
+	switch kind {
+	case schema.UINT, schema.U8, schema.U16, schema.U32, schema.U64:
+		v, ok := val.(schema.UintValue)
+		if !ok {
+			return unexpectedValue("uint", val)
+		}
+		buf.WriteString(strconv.FormatUint(uint64(v), 10))
+	case schema.INT, schema.I8, schema.I16, schema.I32, schema.I64:
+		v, ok := val.(schema.IntValue)
+		if !ok {
+			return unexpectedValue("int", val)
+		}
+		buf.WriteString(strconv.FormatInt(int64(v), 10))
+	case schema.F32, schema.F64:
+		v, ok := val.(schema.FloatValue)
+		if !ok {
+			return unexpectedValue("float", val)
+		}
+		f := float64(v)
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return fmt.Errorf("Cannot represent %v in JSON", f)
+		}
+		bits := 64
+		if kind == schema.F32 {
+			bits = 32
+		}
+		buf.WriteString(strconv.FormatFloat(f, 'g', -1, bits))
+	case schema.Bool:
+		v, ok := val.(schema.BoolValue)
+		if !ok {
+			return unexpectedValue("bool", val)
+		}
+		buf.WriteString(strconv.FormatBool(bool(v)))
+	case schema.String:
+		v, ok := val.(schema.StringValue)
+		if !ok {
+			return unexpectedValue("string", val)
+		}
+		encodeString(buf, string(v))
+	case schema.Void:
+		if _, ok := val.(schema.VoidValue); !ok {
+			return unexpectedValue("void", val)
+		}
+		buf.WriteString("null")
+	default:
+		return fmt.Errorf("Unsupported primitive type %s", kind)
+	}
+	return nil
+}
+
+func encodeEnum(buf *bytes.Buffer, val schema.Value) error {
+	v, ok := val.(schema.UserEnumValue)
+	if !ok {
+		return unexpectedValue("enum", val)
+	}
+	if v.Name == "" {
+		buf.WriteString(strconv.FormatUint(uint64(v.Value), 10))
+	} else {
+		encodeString(buf, v.Name)
+	}
+	return nil
+}
+
+func encodeString(buf *bytes.Buffer, str string) {
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(str)
+	// Encode terminates each value with a newline
+	buf.Truncate(buf.Len() - 1)
+}
+
+func (t *transcoder) encodeList(buf *bytes.Buffer, ty *schema.ArrayType, val schema.Value) error {
+	list, ok := val.(schema.ListValue)
+	if !ok {
+		return unexpectedValue("list", val)
+	}
+	buf.WriteByte('[')
+	for i, v := range list {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		if err := t.encodeType(buf, ty.Member(), v); err != nil {
+			return wrapError(err, fmt.Sprintf("[%d]", i))
+		}
+	}
+	buf.WriteByte(']')
+	return nil
+}
+
+func (t *transcoder) encodeMap(buf *bytes.Buffer, ty *schema.MapType, val schema.Value) error {
+	m, ok := val.(schema.MapValue)
+	if !ok {
+		return unexpectedValue("map", val)
+	}
+
+	if !t.objectKey(ty.Key()) {
+		buf.WriteByte('[')
+		for i, entry := range m {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			seg := fmt.Sprintf("[#%d]", i)
+			buf.WriteString(`{"key":`)
+			if err := t.encodeType(buf, ty.Key(), entry.Key); err != nil {
+				return wrapError(err, seg)
+			}
+			buf.WriteString(`,"value":`)
+			if err := t.encodeType(buf, ty.Value(), entry.Value); err != nil {
+				return wrapError(err, seg)
+			}
+			buf.WriteByte('}')
+		}
+		buf.WriteByte(']')
+		return nil
+	}
+
+	buf.WriteByte('{')
+	for i, entry := range m {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := objectKeyString(entry.Key)
+		if err != nil {
+			return wrapError(err, fmt.Sprintf("[#%d]", i))
+		}
+		encodeString(buf, key)
+		buf.WriteByte(':')
+		if err := t.encodeType(buf, ty.Value(), entry.Value); err != nil {
+			return wrapError(err, fmt.Sprintf("[%q]", key))
+		}
+	}
+	buf.WriteByte('}')
+	return nil
+}
+
+func objectKeyString(key schema.Value) (string, error) {
+	switch k := key.(type) {
+	case schema.StringValue:
+		return string(k), nil
+	case schema.UintValue:
+		return strconv.FormatUint(uint64(k), 10), nil
+	case schema.IntValue:
+		return strconv.FormatInt(int64(k), 10), nil
+	case schema.BoolValue:
+		return strconv.FormatBool(bool(k)), nil
+	case schema.UserEnumValue:
+		if k.Name == "" {
+			return strconv.FormatUint(uint64(k.Value), 10), nil
+		}
+		return k.Name, nil
+	}
+	return "", unexpectedValue("map key", key)
+}
+
+func (t *transcoder) encodeUnion(buf *bytes.Buffer, ty *schema.UnionType, val schema.Value) error {
+	v, ok := val.(schema.UnionValue)
+	if !ok {
+		return unexpectedValue("union", val)
+	}
+	for _, ust := range ty.Types() {
+		if ust.Tag() != v.Tag {
+			continue
+		}
+		buf.WriteByte('{')
+		encodeString(buf, unionKey(ust))
+		buf.WriteByte(':')
+		if err := t.encodeType(buf, ust.Type(), v.Value); err != nil {
+			return wrapError(err, unionSegment(ust))
+		}
+		buf.WriteByte('}')
+		return nil
+	}
+	return fmt.Errorf("Invalid union tag %d", v.Tag)
+}
+
+func (t *transcoder) encodeStruct(buf *bytes.Buffer, ty *schema.StructType, val schema.Value) error {
+	sv, ok := val.(schema.StructValue)
+	if !ok {
+		return unexpectedValue("struct", val)
+	}
+	buf.WriteByte('{')
+	for i, field := range ty.Fields() {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		seg := "." + field.Name()
+		v, ok := sv.Field(field.Name())
+		if !ok {
+			return wrapError(errors.New("Missing struct field"), seg)
+		}
+		encodeString(buf, field.Name())
+		buf.WriteByte(':')
+		if err := t.encodeType(buf, field.Type(), v); err != nil {
+			return wrapError(err, seg)
+		}
+	}
+	buf.WriteByte('}')
+	return nil
+}
+
+func unexpectedValue(expected string, val schema.Value) error {
+	return fmt.Errorf("Expected %s value, got %T", expected, val)
+}
@@ -0,0 +1,167 @@
+package bare
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+)
+
+// Named unsigned integer types which implement this interface (with a value
+// receiver) are treated as enums: in strict mode, values for which IsValid
+// returns false are neither encoded nor decoded.
+type Enum interface {
+	IsValid() bool
+}
+
+var enumInterface = reflect.TypeOf((*Enum)(nil)).Elem()
+
+// Options applied while encoding messages. The zero value encodes messages
+// like Marshal.
+//
+// Together, Strict and Canonical ensure that equal values are always encoded
+// as identical bytes, which DecodeOptions.Strict accepts, as required for
+// signing or content-addressed storage.
+type EncodeOptions struct {
+	// Writes map entries in ascending order of their keys: numerically for
+	// integers, false before true for bools, and byte-wise for strings.
+	// Otherwise, the order of map entries is unspecified.
+	Canonical bool
+	// Rejects values which cannot be decoded, or only outside of strict mode:
+	// strings containing invalid UTF-8, and values of enums (see Enum) which
+	// are not among their values.
+	Strict bool
+	// Unions used to encode union types. Defaults to DefaultRegistry.
+	Registry *Registry
+	// Maximum nesting depth of structs, arrays, maps, optionals and unions.
+	// Defaults to 1024.
+	MaxDepth uint64
+	// Maximum size of a message, in bytes. Encoding fails with
+	// ErrLimitExceeded as soon as it is exceeded, before the excess is
+	// written. Defaults to the limit set with MaxMarshalBytes.
+	MaxMarshalBytes uint64
+}
+
+// Marshals a value (val, which must be a pointer) into a BARE message using
+// these options. See Marshal for details.
+func (o EncodeOptions) Marshal(val interface{}) ([]byte, error) {
+	return marshal(o, val)
+}
+
+// Appends the BARE encoding of a value (val, which must be a pointer) to dst
+// using these options. See AppendMarshal for details.
+func (o EncodeOptions) AppendMarshal(dst []byte, val interface{}) ([]byte, error) {
+	buf, _, err := marshalPooled(Writer{opts: o, buf: dst}, val)
+	if err != nil {
+		return dst, err
+	}
+	return buf, nil
+}
+
+// Writes the BARE encoding of a value (val, which must be a pointer) to the
+// start of buf using these options. See MarshalTo for details.
+func (o EncodeOptions) MarshalTo(buf []byte, val interface{}) (int, error) {
+	msg, _, err := marshalPooled(Writer{
+		opts:     o,
+		buf:      buf[:0:len(buf)],
+		fixedCap: true,
+	}, val)
+	if err != nil {
+		return 0, err
+	}
+	return len(msg), nil
+}
+
+// Returns the length of the BARE encoding of a value (val, which must be a
+// pointer) using these options. See EncodedSize for details.
+func (o EncodeOptions) EncodedSize(val interface{}) (int, error) {
+	_, n, err := marshalPooled(Writer{opts: o, discard: true}, val)
+	if err != nil {
+		return 0, err
+	}
+	return int(n), nil
+}
+
+// Returns a new BARE primitive writer which appends to a byte slice, and
+// applies these options to the values marshaled to it.
+func (o EncodeOptions) NewBytesWriter(buf []byte) *Writer {
+	w := NewBytesWriter(buf)
+	w.opts = o
+	return w
+}
+
+// Returns a new BARE primitive writer wrapping the given io.Writer, which
+// applies these options to the values marshaled to it.
+func (o EncodeOptions) NewWriter(base io.Writer) *Writer {
+	w := NewWriter(base)
+	w.opts = o
+	return w
+}
+
+// Returns a new encoder that writes to w and applies these options to each
+// message.
+func (o EncodeOptions) NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{o.NewWriter(w)}
+}
+
+// Reports whether map entries are to be written in canonical order. See
+// EncodeOptions.Canonical.
+func (w *Writer) Canonical() bool {
+	return w.opts.Canonical
+}
+
+// Returns an error if the writer is strict and e is not a valid enum value.
+// Custom Marshalable enums should call it before writing their value.
+func (w *Writer) CheckEnum(e Enum) error {
+	if w.opts.Strict && !e.IsValid() {
+		return invalidEnumError(e)
+	}
+	return nil
+}
+
+// Returns an error if the reader is strict and e is not a valid enum value.
+// Custom Unmarshalable enums should call it after reading their value.
+func (r *Reader) CheckEnum(e Enum) error {
+	if r.opts.Strict && !e.IsValid() {
+		return invalidEnumError(e)
+	}
+	return nil
+}
+
+func invalidEnumError(e Enum) error {
+	// %d rather than %v, as String methods of enums may not accept invalid
+	// values
+	return fmt.Errorf("Invalid value %d for enum %s", e,
+		rootSegment(reflect.TypeOf(e)))
+}
+
+// Returns the keys of a map in canonical order. See EncodeOptions.Canonical.
+func sortedMapKeys(v reflect.Value) ([]reflect.Value, error) {
+	keys := v.MapKeys()
+	var less func(a, b reflect.Value) bool
+	switch v.Type().Key().Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		less = func(a, b reflect.Value) bool { return a.Uint() < b.Uint() }
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		less = func(a, b reflect.Value) bool { return a.Int() < b.Int() }
+	case reflect.Bool:
+		less = func(a, b reflect.Value) bool { return !a.Bool() && b.Bool() }
+	case reflect.String:
+		less = func(a, b reflect.Value) bool { return a.String() < b.String() }
+	default:
+		return nil, fmt.Errorf("Map key type %s has no canonical order",
+			typeName(v.Type().Key()))
+	}
+	sort.Slice(keys, func(i, j int) bool { return less(keys[i], keys[j]) })
+	return keys, nil
+}
+
+// Returns the length of the minimal encoding of x as a varint.
+func uvarintLen(x uint64) int {
+	n := 1
+	for x >= 0x80 {
+		x >>= 7
+		n++
+	}
+	return n
+}
@@ -0,0 +1,127 @@
+package bare
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type color uint8
+
+const (
+	red   color = 0
+	green color = 1
+	blue  color = 2
+)
+
+func (c color) IsValid() bool {
+	return c <= blue
+}
+
+func TestStrictVarints(t *testing.T) {
+	var u Uint
+	err := Unmarshal([]byte{0x80, 0x00}, &u)
+	assert.Nil(t, err)
+
+	strict := DecodeOptions{Strict: true}
+	err = strict.Unmarshal([]byte{0x80, 0x00}, &u)
+	assert.True(t, errors.Is(err, ErrNonCanonical))
+	err = strict.Unmarshal([]byte{0xAC, 0x82, 0x00}, &u)
+	assert.True(t, errors.Is(err, ErrNonCanonical))
+	err = strict.Unmarshal([]byte{0xAC, 0x02}, &u)
+	assert.Nil(t, err)
+	assert.Equal(t, Uint(300), u)
+
+	var i Int
+	err = strict.Unmarshal([]byte{0x81, 0x80, 0x00}, &i)
+	assert.True(t, errors.Is(err, ErrNonCanonical))
+	err = strict.Unmarshal([]byte{0x81, 0x01}, &i)
+	assert.Nil(t, err)
+	assert.Equal(t, Int(-65), i)
+
+	// Lengths are varints too
+	var str string
+	err = strict.Unmarshal([]byte{0x81, 0x00, 0x41}, &str)
+	assert.True(t, errors.Is(err, ErrNonCanonical))
+}
+
+func TestStrictTrailingData(t *testing.T) {
+	var u uint8
+	strict := DecodeOptions{Strict: true}
+	err := strict.Unmarshal([]byte{0x01, 0x02}, &u)
+	assert.True(t, errors.Is(err, ErrTrailingData))
+}
+
+func TestStrictEnums(t *testing.T) {
+	var c color
+	err := Unmarshal([]byte{0x03}, &c)
+	assert.Nil(t, err)
+
+	strict := DecodeOptions{Strict: true}
+	err = strict.Unmarshal([]byte{0x03}, &c)
+	assert.EqualError(t, errors.Unwrap(err), "Invalid value 3 for enum color")
+	err = strict.Unmarshal([]byte{0x02}, &c)
+	assert.Nil(t, err)
+	assert.Equal(t, blue, c)
+
+	c = 3
+	_, err = Marshal(&c)
+	assert.Nil(t, err)
+	_, err = EncodeOptions{Strict: true}.Marshal(&c)
+	assert.EqualError(t, errors.Unwrap(err), "Invalid value 3 for enum color")
+}
+
+func TestStrictStrings(t *testing.T) {
+	str := "\xff"
+	_, err := Marshal(&str)
+	assert.Nil(t, err)
+	_, err = EncodeOptions{Strict: true}.Marshal(&str)
+	assert.True(t, errors.Is(err, ErrInvalidStr))
+}
+
+func TestCanonicalMaps(t *testing.T) {
+	canonical := EncodeOptions{Canonical: true}
+
+	strs := map[string]uint8{"b": 2, "ab": 1, "c": 3, "a": 0}
+	data, err := canonical.Marshal(&strs)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{
+		0x04,
+		0x01, 'a', 0x00,
+		0x02, 'a', 'b', 0x01,
+		0x01, 'b', 0x02,
+		0x01, 'c', 0x03,
+	}, data)
+
+	ints := map[int8]uint8{3: 3, -1: 1, 0: 2, -128: 0}
+	data, err = canonical.Marshal(&ints)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0x04, 0x80, 0x00, 0xFF, 0x01, 0x00, 0x02, 0x03, 0x03}, data)
+
+	bools := map[bool]uint8{true: 1, false: 0}
+	data, err = canonical.Marshal(&bools)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0x02, 0x00, 0x00, 0x01, 0x01}, data)
+
+	colors := map[color]string{blue: "blue", red: "red", green: "green"}
+	first, err := canonical.Marshal(&colors)
+	assert.Nil(t, err)
+	for i := 0; i < 16; i++ {
+		data, err = canonical.Marshal(&colors)
+		assert.Nil(t, err)
+		assert.Equal(t, first, data)
+	}
+
+	floats := map[float32]uint8{1: 1}
+	_, err = canonical.Marshal(&floats)
+	assert.EqualError(t, errors.Unwrap(err), "Map key type f32 has no canonical order")
+}
+
+func TestCanonicalWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := EncodeOptions{Canonical: true}.NewWriter(&buf)
+	assert.True(t, w.Canonical())
+	assert.False(t, NewWriter(&buf).Canonical())
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+
+	bare "git.sr.ht/~runxiyu/go-bareish"
+	"git.sr.ht/~runxiyu/go-bareish/barejson"
+	"git.sr.ht/~runxiyu/go-bareish/schema"
+)
+
+const decodeUsage = `Usage: bare decode [-m] -s <schema.bare> -t <type> [input.bin]
+
+Decodes a message of the given type to JSON. With -m, the input is a stream
+of any number of messages, each of which is printed as a JSON value; an empty
+input is a stream of no messages, and prints nothing.`
+
+func decodeCmd(args []string) {
+	var (
+		mo     messageOpts
+		stream bool
+	)
+	opts, args := getopts(args, messageSpec+"m", decodeUsage)
+	for _, opt := range opts {
+		mo.set(opt)
+		if opt.Option == 'm' {
+			stream = true
+		}
+	}
+	types := mo.load(decodeUsage)
+	data := readInput(args, decodeUsage)
+
+	var out bytes.Buffer
+	err := readMessages(types, mo.typ, data, stream, func(val schema.Value) error {
+		j, err := barejson.ValueToJSON(types, mo.typ, val)
+		if err != nil {
+			return err
+		}
+		if err := json.Indent(&out, j, "", "\t"); err != nil {
+			return err
+		}
+		out.WriteByte('\n')
+		return nil
+	})
+	writeOutput("", out.Bytes())
+	if err != nil {
+		log.Fatalf("error: %v", err)
+	}
+}
+
+const encodeUsage = `Usage: bare encode -s <schema.bare> -t <type> [-o <output.bin>] [input.json]
+
+Encodes each JSON value in the input as a message of the given type, and
+writes them to the output file or standard output. An empty input has no
+values, and writes no messages.`
+
+func encodeCmd(args []string) {
+	var (
+		mo     messageOpts
+		output string
+	)
+	opts, args := getopts(args, messageSpec+"o:", encodeUsage)
+	for _, opt := range opts {
+		mo.set(opt)
+		if opt.Option == 'o' {
+			output = opt.Value
+		}
+	}
+	types := mo.load(encodeUsage)
+	data := readInput(args, encodeUsage)
+
+	// Each JSON value in the input is encoded as a separate message
+	var out bytes.Buffer
+	dec := json.NewDecoder(bytes.NewReader(data))
+	for n := 0; ; n++ {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err == io.EOF {
+			break
+		} else if err != nil {
+			log.Fatalf("error: value %d: %v", n, err)
+		}
+		msg, err := barejson.FromJSON(types, mo.typ, raw)
+		if err != nil {
+			log.Fatalf("error: value %d: %v", n, err)
+		}
+		out.Write(msg)
+	}
+	writeOutput(output, out.Bytes())
+}
+
+const validateUsage = `Usage: bare validate [-m] -s <schema.bare> -t <type> [input.bin]
+
+Checks that the input holds a valid message of the given type, or with -m, a
+stream of any number of them. With -m, an empty input is a valid stream of no
+messages.`
+
+func validateCmd(args []string) {
+	var (
+		mo     messageOpts
+		stream bool
+	)
+	opts, args := getopts(args, messageSpec+"m", validateUsage)
+	for _, opt := range opts {
+		mo.set(opt)
+		if opt.Option == 'm' {
+			stream = true
+		}
+	}
+	types := mo.load(validateUsage)
+	data := readInput(args, validateUsage)
+
+	err := readMessages(types, mo.typ, data, stream, func(schema.Value) error {
+		return nil
+	})
+	if err != nil {
+		log.Fatalf("invalid: %v", err)
+	}
+}
+
+// Decodes the messages in data, which must be consumed exactly, and passes
+// each to fn. Unless stream is set, data must hold a single message; if it is
+// set, data holds any number of messages, and none if it is empty.
+func readMessages(types []schema.SchemaType, typ string, data []byte,
+	stream bool, fn func(schema.Value) error) error {
+	pos := 0
+	for n := 0; (!stream && n == 0) || (stream && pos < len(data)); n++ {
+		r := bare.NewReader(bytes.NewReader(data[pos:]))
+		val, err := schema.ReadDynamic(r, types, typ)
+		if err != nil {
+			var ve *schema.ValueError
+			if errors.As(err, &ve) && ve.Offset >= 0 {
+				ve.Offset += int64(pos)
+			}
+			return fmt.Errorf("message %d: %v", n, err)
+		}
+		if r.Offset() == 0 && stream {
+			return fmt.Errorf("message %d: %s is empty and cannot be read as a stream", n, typ)
+		}
+		pos += int(r.Offset())
+		if err := fn(val); err != nil {
+			return fmt.Errorf("message %d: %v", n, err)
+		}
+	}
+	if pos != len(data) {
+		return fmt.Errorf("%d unexpected bytes after message at offset %d",
+			len(data)-pos, pos)
+	}
+	return nil
+}
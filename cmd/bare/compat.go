@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+
+	"git.sr.ht/~runxiyu/go-bareish/schema"
+)
+
+// The JSON report of the compat command.
+type compatReport struct {
+	Compatibility schema.Compatibility `json:"compatibility"`
+	Changes       []compatChange       `json:"changes"`
+}
+
+type compatChange struct {
+	Path          string               `json:"path"`
+	Compatibility schema.Compatibility `json:"compatibility"`
+	Message       string               `json:"message"`
+	Old           string               `json:"old,omitempty"`
+	New           string               `json:"new,omitempty"`
+}
+
+var failLevels = map[string]schema.Compatibility{
+	"wire-compatible":     schema.WireCompatible,
+	"backward-compatible": schema.BackwardCompatible,
+	"breaking":            schema.Breaking,
+}
+
+const compatUsage = `Usage: bare compat [-j] [-f <level>] <old.bare> <new.bare>
+
+Reports the differences between two versions of a schema, and exits with
+status 1 if any of them is at the given level or worse: breaking (the
+default), backward-compatible, wire-compatible or never. With -j, it prints
+the report as JSON.`
+
+func compatCmd(args []string) {
+	var (
+		asJSON bool
+		fail   = "breaking"
+	)
+	opts, args := getopts(args, "jf:", compatUsage)
+	for _, opt := range opts {
+		switch opt.Option {
+		case 'j':
+			asJSON = true
+		case 'f':
+			fail = opt.Value
+		}
+	}
+	if len(args) != 2 {
+		log.Fatal(compatUsage)
+	}
+	level, ok := failLevels[fail]
+	if !ok && fail != "never" {
+		log.Fatalf("error: unknown level %q", fail)
+	}
+
+	changes := schema.Compare(loadSchema(args[0]), loadSchema(args[1]))
+	overall := schema.Overall(changes)
+
+	if asJSON {
+		report := compatReport{Compatibility: overall, Changes: []compatChange{}}
+		for _, c := range changes {
+			cc := compatChange{
+				Path:          c.Path,
+				Compatibility: c.Compatibility,
+				Message:       c.Message,
+			}
+			if c.Old.IsValid() {
+				cc.Old = c.Old.String()
+			}
+			if c.New.IsValid() {
+				cc.New = c.New.String()
+			}
+			report.Changes = append(report.Changes, cc)
+		}
+		out, _ := json.MarshalIndent(report, "", "\t")
+		writeOutput("", append(out, '\n'))
+	} else {
+		for _, c := range changes {
+			pos := c.New
+			if !pos.IsValid() {
+				pos = c.Old
+			}
+			fmt.Printf("%s: %s\n", pos, c)
+		}
+		fmt.Printf("%d changes, %s\n", len(changes), overall)
+	}
+
+	if ok && len(changes) > 0 && overall >= level {
+		os.Exit(1)
+	}
+}
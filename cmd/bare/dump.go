@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	bare "git.sr.ht/~runxiyu/go-bareish"
+	"git.sr.ht/~runxiyu/go-bareish/schema"
+)
+
+const dumpUsage = `Usage: bare dump -s <schema.bare> -t <type> [input.bin]
+
+Prints an annotated hex dump of the messages of the given type in the input.`
+
+func dumpCmd(args []string) {
+	var mo messageOpts
+	opts, args := getopts(args, messageSpec, dumpUsage)
+	for _, opt := range opts {
+		mo.set(opt)
+	}
+	types := mo.load(dumpUsage)
+	data := readInput(args, dumpUsage)
+
+	d := &dumper{
+		out:      os.Stdout,
+		data:     data,
+		Resolver: schema.NewResolver(types),
+	}
+
+	// The input is dumped as a sequence of messages
+	for n := 0; d.pos < len(data); n++ {
+		fmt.Fprintf(d.out, "# message %d\n", n)
+		start := d.pos
+		d.r = bare.NewReader(bytes.NewReader(data[d.pos:]))
+		err := d.dumpNamed(mo.typ, mo.typ)
+		d.pos += int(d.r.Offset())
+		if err != nil {
+			log.Fatalf("error: message %d at offset %#x: %v", n, d.pos, err)
+		}
+		if d.pos == start {
+			break
+		}
+	}
+}
+
+// Prints each value of a message on its own line, with its offset, the bytes
+// which encode it, its path and its decoded value.
+type dumper struct {
+	*schema.Resolver
+	out  io.Writer
+	data []byte
+	r    *bare.Reader
+	// Offset of the current message
+	pos int
+}
+
+// The number of bytes shown on each line
+const dumpWidth = 8
+
+func (d *dumper) line(start int64, path string, format string, args ...interface{}) {
+	end := d.pos + int(d.r.Offset())
+	raw := d.data[d.pos+int(start) : end]
+
+	var hex strings.Builder
+	for i, b := range raw {
+		if i == dumpWidth {
+			hex.WriteString("..")
+			break
+		}
+		fmt.Fprintf(&hex, "%02x ", b)
+	}
+	fmt.Fprintf(d.out, "%08x  %-26s %s: %s\n", d.pos+int(start),
+		hex.String(), path, fmt.Sprintf(format, args...))
+}
+
+func (d *dumper) dumpNamed(name, path string) error {
+	st, err := d.Lookup(name)
+	if err != nil {
+		return err
+	}
+
+	switch st := st.(type) {
+	case *schema.UserDefinedType:
+		return d.dump(st.Type(), path)
+	case *schema.UserDefinedEnum:
+		start := d.r.Offset()
+		v, err := readUint(d.r, st.Kind())
+		if err != nil {
+			return err
+		}
+		label := "?"
+		for _, ev := range st.Values() {
+			if uint64(ev.Value()) == v {
+				label = ev.Name()
+			}
+		}
+		d.line(start, path, "%s %s (%d)", st.Name(), label, v)
+		return nil
+	}
+	return fmt.Errorf("unsupported schema type %T", st)
+}
+
+func (d *dumper) dump(ty schema.Type, path string) error {
+	start := d.r.Offset()
+
+	switch ty := ty.(type) {
+	case *schema.PrimitiveType:
+		v, err := readPrimitive(d.r, ty.Kind())
+		if err != nil {
+			return err
+		}
+		d.line(start, path, "%s %s", schema.FormatType(ty), v)
+	case *schema.DataType:
+		var n int
+		if ty.Length() == 0 {
+			data, err := d.r.ReadData()
+			if err != nil {
+				return err
+			}
+			n = len(data)
+		} else {
+			n = int(ty.Length())
+			if err := d.r.ReadDataFixed(make([]byte, n)); err != nil {
+				return err
+			}
+		}
+		d.line(start, path, "%s (%d bytes)", schema.FormatType(ty), n)
+	case *schema.OptionalType:
+		ok, err := d.r.ReadOptional()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			d.line(start, path, "optional (absent)")
+			return nil
+		}
+		d.line(start, path, "optional (present)")
+		return d.dump(ty.Subtype(), path)
+	case *schema.ArrayType:
+		n := uint64(ty.Length())
+		if n == 0 {
+			var err error
+			if n, err = d.r.ReadArrayLength(); err != nil {
+				return err
+			}
+			d.line(start, path, "length %d", n)
+		}
+		for i := uint64(0); i < n; i++ {
+			if err := d.dump(ty.Member(), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case *schema.MapType:
+		n, err := d.r.ReadMapSize()
+		if err != nil {
+			return err
+		}
+		d.line(start, path, "map size %d", n)
+		for i := uint64(0); i < n; i++ {
+			entry := fmt.Sprintf("%s[#%d]", path, i)
+			if err := d.dump(ty.Key(), entry+" key"); err != nil {
+				return err
+			}
+			if err := d.dump(ty.Value(), entry+" value"); err != nil {
+				return err
+			}
+		}
+	case *schema.UnionType:
+		tag, err := d.r.ReadUint()
+		if err != nil {
+			return err
+		}
+		for _, ust := range ty.Types() {
+			if ust.Tag() != tag {
+				continue
+			}
+			member := schema.FormatType(ust.Type())
+			if _, ok := ust.Type().(*schema.NamedUserType); !ok {
+				member = fmt.Sprintf("%d", tag)
+			}
+			d.line(start, path, "union tag %d (%s)", tag, member)
+			return d.dump(ust.Type(), fmt.Sprintf("%s.(%s)", path, member))
+		}
+		d.line(start, path, "union tag %d", tag)
+		return fmt.Errorf("invalid union tag %d", tag)
+	case *schema.StructType:
+		for _, field := range ty.Fields() {
+			if err := d.dump(field.Type(), path+"."+field.Name()); err != nil {
+				return err
+			}
+		}
+	case *schema.NamedUserType:
+		return d.dumpNamed(ty.Name(), path)
+	default:
+		return fmt.Errorf("unsupported type %T", ty)
+	}
+	return nil
+}
+
+func readUint(r *bare.Reader, kind schema.TypeKind) (uint64, error) {
+	switch kind {
+	case schema.U8:
+		v, err := r.ReadU8()
+		return uint64(v), err
+	case schema.U16:
+		v, err := r.ReadU16()
+		return uint64(v), err
+	case schema.U32:
+		v, err := r.ReadU32()
+		return uint64(v), err
+	case schema.U64:
+		return r.ReadU64()
+	}
+	return r.ReadUint()
+}
+
+// Reads a primitive value and formats it for display.
+func readPrimitive(r *bare.Reader, kind schema.TypeKind) (string, error) {
+	var (
+		v   interface{}
+		err error
+	)
+	switch kind {
+	case schema.UINT, schema.U8, schema.U16, schema.U32, schema.U64:
+		v, err = readUint(r, kind)
+	case schema.INT:
+		v, err = r.ReadInt()
+	case schema.I8:
+		v, err = r.ReadI8()
+	case schema.I16:
+		v, err = r.ReadI16()
+	case schema.I32:
+		v, err = r.ReadI32()
+	case schema.I64:
+		v, err = r.ReadI64()
+	case schema.F32:
+		v, err = r.ReadF32()
+	case schema.F64:
+		v, err = r.ReadF64()
+	case schema.Bool:
+		v, err = r.ReadBool()
+	case schema.String:
+		var str string
+		str, err = r.ReadString()
+		v = fmt.Sprintf("%q", str)
+	case schema.Void:
+		return "", nil
+	default:
+		return "", fmt.Errorf("unsupported primitive type %s", kind)
+	}
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprint(v), nil
+}
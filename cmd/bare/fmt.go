@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"git.sr.ht/~runxiyu/go-bareish/schema"
+)
+
+const fmtUsage = `Usage: bare fmt [-f] [-w] <schema.bare...>
+
+Reformats schema files, keeping their comments, and prints the result. With
+-f, it uses the syntax of the final specification. With -w, it writes the
+result to the source files instead.`
+
+func fmtCmd(args []string) {
+	var (
+		fo    schema.FormatOptions
+		write bool
+	)
+	opts, args := getopts(args, "fw", fmtUsage)
+	for _, opt := range opts {
+		switch opt.Option {
+		case 'f':
+			fo.Dialect = schema.FinalDialect
+		case 'w':
+			write = true
+		}
+	}
+	if len(args) == 0 {
+		log.Fatal(fmtUsage)
+	}
+
+	for _, path := range args {
+		src, err := ioutil.ReadFile(path)
+		if err != nil {
+			log.Fatalf("error reading %s: %v", path, err)
+		}
+		types, err := schema.ParseFile(path, bytes.NewReader(src))
+		if err != nil {
+			log.Fatalf("error: %v", err)
+		}
+
+		var buf bytes.Buffer
+		if err := fo.Format(&buf, types); err != nil {
+			log.Fatalf("error formatting %s: %v", path, err)
+		}
+
+		if !write {
+			os.Stdout.Write(buf.Bytes())
+			continue
+		}
+		if bytes.Equal(src, buf.Bytes()) {
+			continue
+		}
+		if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+			log.Fatalf("error writing %s: %v", path, err)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+
+	"git.sr.ht/~sircmpwn/getopt"
+
+	"git.sr.ht/~runxiyu/go-bareish/schema"
+)
+
+const usage = `Usage: bare <command> [options] [arguments]
+
+Commands:
+	decode    Decode BARE messages to JSON
+	encode    Encode JSON values as BARE messages
+	validate  Check that the input holds valid BARE messages
+	dump      Print an annotated hex dump of BARE messages
+	fmt       Reformat schema files
+	compat    Report the differences between two versions of a schema
+
+Run "bare <command> -h" for the usage of each command.`
+
+var commands = map[string]func(args []string){
+	"decode":   decodeCmd,
+	"encode":   encodeCmd,
+	"validate": validateCmd,
+	"dump":     dumpCmd,
+	"fmt":      fmtCmd,
+	"compat":   compatCmd,
+}
+
+func main() {
+	log.SetFlags(0)
+
+	if len(os.Args) < 2 {
+		log.Fatal(usage)
+	}
+	switch os.Args[1] {
+	case "-h", "-help", "--help", "help":
+		log.Println(usage)
+		os.Exit(0)
+	}
+
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		log.Fatalf("unknown command %q\n\n%s", os.Args[1], usage)
+	}
+	cmd(os.Args[2:])
+}
+
+// Parses the options of a command with getopt, given their spec without -h,
+// and returns them and the remaining arguments. -h prints the usage of the
+// command.
+func getopts(args []string, spec, usage string) ([]getopt.Option, []string) {
+	argv := append([]string{os.Args[0]}, args...)
+	opts, optind, err := getopt.Getopts(argv, "h"+spec)
+	if err != nil {
+		log.Fatalf("error: %v", err)
+	}
+	for _, opt := range opts {
+		if opt.Option == 'h' {
+			log.Println(usage)
+			os.Exit(0)
+		}
+	}
+	return opts, argv[optind:]
+}
+
+// Options shared by the commands which work on messages: -s <schema.bare>
+// and -t <type>.
+type messageOpts struct {
+	schema string
+	typ    string
+}
+
+const messageSpec = "s:t:"
+
+// Sets the option if it is one of the shared options.
+func (mo *messageOpts) set(opt getopt.Option) {
+	switch opt.Option {
+	case 's':
+		mo.schema = opt.Value
+	case 't':
+		mo.typ = opt.Value
+	}
+}
+
+func (mo *messageOpts) load(usage string) []schema.SchemaType {
+	if mo.schema == "" || mo.typ == "" {
+		log.Fatal(usage)
+	}
+	types := loadSchema(mo.schema)
+	for _, ty := range types {
+		if ty.Name() == mo.typ {
+			return types
+		}
+	}
+	log.Fatalf("error: type %s not found in %s", mo.typ, mo.schema)
+	return nil
+}
+
+func loadSchema(path string) []schema.SchemaType {
+	f, err := os.Open(path)
+	if err != nil {
+		log.Fatalf("error opening %s: %v", path, err)
+	}
+	defer f.Close()
+
+	types, err := schema.ParseFile(path, f)
+	if err != nil {
+		log.Fatalf("error: %v", err)
+	}
+	if errs := schema.Check(types); len(errs) != 0 {
+		for _, err := range errs {
+			log.Printf("error: %v", err)
+		}
+		os.Exit(1)
+	}
+	return types
+}
+
+// Reads the file named by the only argument, or standard input if there is
+// none or it is "-".
+func readInput(args []string, usage string) []byte {
+	var (
+		data []byte
+		err  error
+	)
+	switch {
+	case len(args) > 1:
+		log.Fatal(usage)
+	case len(args) == 0 || args[0] == "-":
+		data, err = ioutil.ReadAll(os.Stdin)
+	default:
+		data, err = ioutil.ReadFile(args[0])
+	}
+	if err != nil {
+		log.Fatalf("error reading input: %v", err)
+	}
+	return data
+}
+
+func writeOutput(path string, data []byte) {
+	var err error
+	if path == "" || path == "-" {
+		_, err = os.Stdout.Write(data)
+	} else {
+		err = ioutil.WriteFile(path, data, 0644)
+	}
+	if err != nil {
+		log.Fatalf("error writing output: %v", err)
+	}
+}
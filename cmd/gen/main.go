@@ -23,6 +23,12 @@ package {{.package}}
 import (
 {{- if .schema.NeedErrors }}
 	"errors"
+{{- end }}
+{{- if .schema.NeedFmt }}
+	"fmt"
+{{- end }}
+{{- if .schema.NeedSort }}
+	"sort"
 {{- end }}
 	"git.sr.ht/~runxiyu/go-bareish"
 )
@@ -61,6 +67,16 @@ import (
 	func (t *{{ .Name }}) Encode() ([]byte, error) {
 		return bare.Marshal(t)
 	}
+
+	{{ if $.static -}}
+	func (t *{{ .Name }}) Marshal(w *bare.Writer) error {
+		{{ marshalType . -}}
+	}
+
+	func (t *{{ .Name }}) Unmarshal(r *bare.Reader) error {
+		{{ unmarshalType . -}}
+	}
+	{{- end }}
 {{end}}
 
 {{range .Enums}}
@@ -83,6 +99,26 @@ const (
 		}
 		panic(errors.New("Invalid {{.Name}} value"))
 	}
+
+	func (t {{ .Name }}) IsValid() bool {
+		switch (t) {
+		{{- range .Values }}
+		case {{ .Name }}:
+			return true
+		{{- end -}}
+		}
+		return false
+	}
+
+	{{ if $.static -}}
+	func (t *{{ .Name }}) Marshal(w *bare.Writer) error {
+		{{ marshalEnum . -}}
+	}
+
+	func (t *{{ .Name }}) Unmarshal(r *bare.Reader) error {
+		{{ unmarshalEnum . -}}
+	}
+	{{- end }}
 {{end}}
 
 {{ if gt (len .Unions) 0 }}
@@ -94,6 +130,16 @@ const (
 		{{range .Type.Types}}
 			func (_ {{.Type.Name}}) IsUnion() {}
 		{{end}}
+
+		{{ if $.static -}}
+		func marshal{{ .Name }}(w *bare.Writer, v {{ .Name }}) error {
+			{{ marshalUnion . -}}
+		}
+
+		func unmarshal{{ .Name }}(r *bare.Reader) ({{ .Name }}, error) {
+			{{ unmarshalUnion . -}}
+		}
+		{{- end }}
 	{{end}}
 
 	func init() {
@@ -131,67 +177,77 @@ var funcs = template.FuncMap{
 			panic(fmt.Sprintf("Unimplemented schema type: %T", ty))
 		}
 	},
-	"primitiveType": func(t schema.TypeKind) string {
-		switch t {
-		case schema.U8:
-			return "uint8"
-		case schema.U16:
-			return "uint16"
-		case schema.U32:
-			return "uint32"
-		case schema.U64:
-			return "uint64"
-		case schema.UINT:
-			return "uint"
-		case schema.I8:
-			return "int8"
-		case schema.I16:
-			return "int16"
-		case schema.I32:
-			return "int32"
-		case schema.I64:
-			return "int64"
-		case schema.INT:
-			return "int"
-		case schema.F32:
-			return "float32"
-		case schema.F64:
-			return "float64"
-		case schema.Bool:
-			return "bool"
-		case schema.String:
-			return "string"
-		case schema.Void:
-			return "struct{}"
-		}
-		panic(fmt.Errorf("Invalid primitive type %d", t))
-	},
-	"structTag": func(name string) string {
-		return fmt.Sprintf("`bare:\"%s\"`", name)
-	},
-	"capitalize": func(s string) string {
-		return strings.ToUpper(s[:1]) + s[1:]
-	},
+	"primitiveType": primitiveType,
+	"structTag":     structTag,
+	"capitalize":    capitalize,
 	"last": func(len, i int) bool {
 		return i+1 == len
 	},
 }
 
+func primitiveType(t schema.TypeKind) string {
+	switch t {
+	case schema.U8:
+		return "uint8"
+	case schema.U16:
+		return "uint16"
+	case schema.U32:
+		return "uint32"
+	case schema.U64:
+		return "uint64"
+	case schema.UINT:
+		return "uint"
+	case schema.I8:
+		return "int8"
+	case schema.I16:
+		return "int16"
+	case schema.I32:
+		return "int32"
+	case schema.I64:
+		return "int64"
+	case schema.INT:
+		return "int"
+	case schema.F32:
+		return "float32"
+	case schema.F64:
+		return "float64"
+	case schema.Bool:
+		return "bool"
+	case schema.String:
+		return "string"
+	case schema.Void:
+		return "struct{}"
+	}
+	panic(fmt.Errorf("Invalid primitive type %d", t))
+}
+
+func structTag(name string) string {
+	return fmt.Sprintf("`bare:\"%s\"`", name)
+}
+
+func capitalize(s string) string {
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
 func main() {
 	cfg := parseArgs()
 	out := &bytes.Buffer{}
 
-	tmpl, err := template.New("").Funcs(funcs).Parse(templateString)
+	types := parseSchema(cfg.In, cfg.Skip, cfg.Static)
+
+	tmpl, err := template.New("").
+		Funcs(funcs).
+		Funcs(newStaticGen(types).funcs()).
+		Parse(templateString)
 	if err != nil {
 		log.Fatalf("error parsing template: %v", err)
 	}
 
-	types := parseSchema(cfg.In, cfg.Skip)
-
 	data := make(map[string]interface{})
 
 	data["package"] = cfg.PackageName
 	data["schema"] = types
+	data["static"] = cfg.Static
 
 	err = tmpl.Execute(out, data)
 	if err != nil {
@@ -216,13 +272,27 @@ type Config struct {
 	In          string
 	Out         string
 	Skip        map[string]bool
+	Static      bool
 }
 
+const usage = "Usage: gen [-static] [-p <package>] [-s <skip type>] <input.bare> <output.go>"
+
 func parseArgs() *Config {
 	cfg := &Config{}
 
 	log.SetFlags(0)
-	opts, optind, err := getopt.Getopts(os.Args, "hs:p:")
+
+	// -static does not fit getopt's single-letter options
+	argv := os.Args[:1]
+	for _, arg := range os.Args[1:] {
+		if arg == "-static" {
+			cfg.Static = true
+			continue
+		}
+		argv = append(argv, arg)
+	}
+
+	opts, optind, err := getopt.Getopts(argv, "hs:p:")
 	if err != nil {
 		log.Fatalf("error: %e", err)
 	}
@@ -237,14 +307,14 @@ func parseArgs() *Config {
 		case 's':
 			cfg.Skip[opt.Value] = true
 		case 'h':
-			log.Println("Usage: gen [-p <package>] [-s <skip type>] <input.bare> <output.go>")
+			log.Println(usage)
 			os.Exit(0)
 		}
 	}
 
-	args := os.Args[optind:]
+	args := argv[optind:]
 	if len(args) != 2 {
-		log.Fatal("Usage: gen [-p <package>] <input.bare> <output.go>")
+		log.Fatal(usage)
 	}
 
 	cfg.In = args[0]
@@ -258,18 +328,26 @@ type Types struct {
 	Enums      []*schema.UserDefinedEnum
 	Unions     []*schema.UserDefinedType
 	NeedErrors bool
+	NeedFmt    bool
+	NeedSort   bool
 }
 
-func parseSchema(path string, skip map[string]bool) Types {
+func parseSchema(path string, skip map[string]bool, static bool) Types {
 	inf, err := os.Open(path)
 	if err != nil {
 		log.Fatalf("error opening %s: %e", path, err)
 	}
 	defer inf.Close()
 
-	schemaTypes, err := schema.Parse(inf)
+	schemaTypes, err := schema.ParseFile(path, inf)
 	if err != nil {
-		log.Fatalf("error parsing %s: %e", path, err)
+		log.Fatalf("error: %v", err)
+	}
+	if errs := schema.Check(schemaTypes); len(errs) != 0 {
+		for _, err := range errs {
+			log.Printf("error: %v", err)
+		}
+		os.Exit(1)
 	}
 
 	types := Types{}
@@ -297,5 +375,16 @@ func parseSchema(path string, skip map[string]bool) Types {
 		types.NeedErrors = true
 	}
 
+	if static && len(types.Unions) > 0 {
+		types.NeedErrors = true
+		types.NeedFmt = true
+	}
+	for _, ty := range types.UserTypes {
+		if static && containsMap(ty.Type()) {
+			types.NeedFmt = true
+			types.NeedSort = true
+		}
+	}
+
 	return types
 }
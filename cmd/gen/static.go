@@ -0,0 +1,368 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"git.sr.ht/~runxiyu/go-bareish/schema"
+)
+
+// Generates reflection-free Marshal and Unmarshal methods for the types in a
+// schema (the -static option).
+type staticGen struct {
+	buf    bytes.Buffer
+	unions map[string]bool
+}
+
+func newStaticGen(types Types) *staticGen {
+	g := &staticGen{unions: make(map[string]bool)}
+	for _, ut := range types.Unions {
+		g.unions[ut.Name()] = true
+	}
+	return g
+}
+
+func (g *staticGen) funcs() map[string]interface{} {
+	return map[string]interface{}{
+		"marshalType":    g.marshalType,
+		"unmarshalType":  g.unmarshalType,
+		"marshalEnum":    g.marshalEnum,
+		"unmarshalEnum":  g.unmarshalEnum,
+		"marshalUnion":   g.marshalUnion,
+		"unmarshalUnion": g.unmarshalUnion,
+	}
+}
+
+func (g *staticGen) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+func (g *staticGen) flush() string {
+	s := g.buf.String()
+	g.buf.Reset()
+	return s
+}
+
+// Returns the body of the Marshal method for a user-defined type.
+func (g *staticGen) marshalType(udt *schema.UserDefinedType) string {
+	if nut, ok := udt.Type().(*schema.NamedUserType); ok && !g.unions[nut.Name()] {
+		// Go types defined in terms of another do not inherit its methods
+		g.printf("return (*%s)(t).Marshal(w)\n", nut.Name())
+		return g.flush()
+	}
+	g.printf("if err := w.Enter(); err != nil {\nreturn err\n}\n")
+	g.printf("defer w.Leave()\n")
+	g.marshal(rootExpr(udt), udt.Type(), 0)
+	g.printf("return nil\n")
+	return g.flush()
+}
+
+// Returns the body of the Unmarshal method for a user-defined type.
+func (g *staticGen) unmarshalType(udt *schema.UserDefinedType) string {
+	if nut, ok := udt.Type().(*schema.NamedUserType); ok && !g.unions[nut.Name()] {
+		g.printf("return (*%s)(t).Unmarshal(r)\n", nut.Name())
+		return g.flush()
+	}
+	g.printf("if err := r.Enter(); err != nil {\nreturn err\n}\n")
+	g.printf("defer r.Leave()\n")
+	g.unmarshal(rootExpr(udt), udt.Name(), udt.Type(), 0)
+	g.printf("return nil\n")
+	return g.flush()
+}
+
+// Returns the expression for the value of a user-defined type in its methods.
+func rootExpr(udt *schema.UserDefinedType) string {
+	if _, ok := udt.Type().(*schema.StructType); ok {
+		// Fields are accessible through the receiver
+		return "t"
+	}
+	return "(*t)"
+}
+
+// Returns the body of the Marshal method for an enum.
+func (g *staticGen) marshalEnum(ude *schema.UserDefinedEnum) string {
+	g.printf("if err := w.CheckEnum(*t); err != nil {\nreturn err\n}\n")
+	g.marshal("*t", &primitive{ude.Kind()}, 0)
+	g.printf("return nil\n")
+	return g.flush()
+}
+
+// Returns the body of the Unmarshal method for an enum.
+func (g *staticGen) unmarshalEnum(ude *schema.UserDefinedEnum) string {
+	g.unmarshal("*t", ude.Name(), &primitive{ude.Kind()}, 0)
+	g.printf("return r.CheckEnum(*t)\n")
+	return g.flush()
+}
+
+// Returns the body of the marshal function for a union.
+func (g *staticGen) marshalUnion(udt *schema.UserDefinedType) string {
+	ut := udt.Type().(*schema.UnionType)
+	g.printf("switch v := v.(type) {\n")
+	for _, st := range ut.Types() {
+		name := st.Type().(*schema.NamedUserType).Name()
+		g.printf("case %s:\n", name)
+		g.printf("if err := w.WriteUint(%d); err != nil {\nreturn err\n}\n", st.Tag())
+		g.printf("return v.Marshal(w)\n")
+		g.printf("case *%s:\n", name)
+		g.printf("if err := w.WriteUint(%d); err != nil {\nreturn err\n}\n", st.Tag())
+		g.printf("return v.Marshal(w)\n")
+	}
+	g.printf("case nil:\n")
+	g.printf("return errors.New(\"Nil value for union type %s\")\n", udt.Name())
+	g.printf("}\n")
+	g.printf("return fmt.Errorf(\"Invalid union value: %%T\", v)\n")
+	return g.flush()
+}
+
+// Returns the body of the unmarshal function for a union.
+func (g *staticGen) unmarshalUnion(udt *schema.UserDefinedType) string {
+	ut := udt.Type().(*schema.UnionType)
+	g.printf("tag, err := r.ReadUint()\n")
+	g.printf("if err != nil {\nreturn nil, err\n}\n")
+	g.printf("switch tag {\n")
+	for _, st := range ut.Types() {
+		name := st.Type().(*schema.NamedUserType).Name()
+		g.printf("case %d:\n", st.Tag())
+		g.printf("v := new(%s)\n", name)
+		g.printf("if err := v.Unmarshal(r); err != nil {\nreturn nil, err\n}\n")
+		g.printf("return v, nil\n")
+	}
+	g.printf("}\n")
+	g.printf("return nil, fmt.Errorf(\"Invalid union tag %%d for type %s\", tag)\n",
+		udt.Name())
+	return g.flush()
+}
+
+// A stand-in for the primitive type an enum is encoded as.
+type primitive struct {
+	kind schema.TypeKind
+}
+
+func (p *primitive) Kind() schema.TypeKind {
+	return p.kind
+}
+
+var primitiveMethods = map[schema.TypeKind]string{
+	schema.UINT:   "Uint",
+	schema.U8:     "U8",
+	schema.U16:    "U16",
+	schema.U32:    "U32",
+	schema.U64:    "U64",
+	schema.INT:    "Int",
+	schema.I8:     "I8",
+	schema.I16:    "I16",
+	schema.I32:    "I32",
+	schema.I64:    "I64",
+	schema.F32:    "F32",
+	schema.F64:    "F64",
+	schema.Bool:   "Bool",
+	schema.String: "String",
+}
+
+var primitiveArgTypes = map[schema.TypeKind]string{
+	schema.UINT:   "uint64",
+	schema.U8:     "uint8",
+	schema.U16:    "uint16",
+	schema.U32:    "uint32",
+	schema.U64:    "uint64",
+	schema.INT:    "int64",
+	schema.I8:     "int8",
+	schema.I16:    "int16",
+	schema.I32:    "int32",
+	schema.I64:    "int64",
+	schema.F32:    "float32",
+	schema.F64:    "float64",
+	schema.Bool:   "bool",
+	schema.String: "string",
+}
+
+// Emits statements which write the value of the (addressable) Go expression
+// expr, of the given schema type.
+func (g *staticGen) marshal(expr string, ty schema.Type, depth int) {
+	switch ty := ty.(type) {
+	case *schema.PrimitiveType, *primitive:
+		if ty.Kind() == schema.Void {
+			return
+		}
+		g.printf("if err := w.Write%s(%s(%s)); err != nil {\nreturn err\n}\n",
+			primitiveMethods[ty.Kind()], primitiveArgTypes[ty.Kind()], expr)
+	case *schema.DataType:
+		if ty.Length() == 0 {
+			g.printf("if err := w.WriteData(%s); err != nil {\nreturn err\n}\n", expr)
+		} else {
+			g.printf("if err := w.WriteDataFixed(%s[:]); err != nil {\nreturn err\n}\n", expr)
+		}
+	case *schema.OptionalType:
+		g.printf("if %s == nil {\n", expr)
+		g.printf("if err := w.WriteBool(false); err != nil {\nreturn err\n}\n")
+		g.printf("} else {\n")
+		g.printf("if err := w.WriteBool(true); err != nil {\nreturn err\n}\n")
+		g.marshal("(*"+expr+")", ty.Subtype(), depth)
+		g.printf("}\n")
+	case *schema.ArrayType:
+		i := fmt.Sprintf("i%d", depth)
+		if ty.Length() == 0 {
+			g.printf("if err := w.WriteUint(uint64(len(%s))); err != nil {\nreturn err\n}\n", expr)
+		}
+		g.printf("for %s := range %s {\n", i, expr)
+		g.marshal(fmt.Sprintf("%s[%s]", expr, i), ty.Member(), depth+1)
+		g.printf("}\n")
+	case *schema.MapType:
+		k, v := fmt.Sprintf("k%d", depth), fmt.Sprintf("v%d", depth)
+		keys := fmt.Sprintf("keys%d", depth)
+		g.printf("if err := w.WriteUint(uint64(len(%s))); err != nil {\nreturn err\n}\n", expr)
+		g.printf("if w.Canonical() {\n")
+		g.printf("%s := make([]%s, 0, len(%s))\n", keys, typeName(ty.Key()), expr)
+		g.printf("for %s := range %s {\n%s = append(%s, %s)\n}\n", k, expr, keys, keys, k)
+		if ty.Key().Kind() == schema.Bool {
+			g.printf("sort.Slice(%s, func(i, j int) bool { return !%s[i] && %s[j] })\n",
+				keys, keys, keys)
+		} else {
+			g.printf("sort.Slice(%s, func(i, j int) bool { return %s[i] < %s[j] })\n",
+				keys, keys, keys)
+		}
+		g.printf("for _, %s := range %s {\n%s := %s[%s]\n", k, keys, v, expr, k)
+		g.marshal(k, ty.Key(), depth+1)
+		g.marshal(v, ty.Value(), depth+1)
+		g.printf("}\n} else {\n")
+		g.printf("for %s, %s := range %s {\n", k, v, expr)
+		g.marshal(k, ty.Key(), depth+1)
+		g.marshal(v, ty.Value(), depth+1)
+		g.printf("}\n}\n")
+	case *schema.StructType:
+		for _, field := range ty.Fields() {
+			g.marshal(expr+"."+capitalize(field.Name()), field.Type(), depth)
+		}
+	case *schema.NamedUserType:
+		if g.unions[ty.Name()] {
+			g.printf("if err := marshal%s(w, %s); err != nil {\nreturn err\n}\n",
+				ty.Name(), expr)
+		} else {
+			g.printf("if err := %s.Marshal(w); err != nil {\nreturn err\n}\n", expr)
+		}
+	default:
+		panic(fmt.Sprintf("Unimplemented schema type: %T", ty))
+	}
+}
+
+// Emits statements which read a value of the given schema type into the
+// (addressable) Go expression expr, whose Go type is goType.
+func (g *staticGen) unmarshal(expr, goType string, ty schema.Type, depth int) {
+	switch ty := ty.(type) {
+	case *schema.PrimitiveType, *primitive:
+		if ty.Kind() == schema.Void {
+			return
+		}
+		g.printf("if v, err := r.Read%s(); err != nil {\nreturn err\n} else {\n",
+			primitiveMethods[ty.Kind()])
+		g.printf("%s = %s(v)\n}\n", expr, goType)
+	case *schema.DataType:
+		if ty.Length() == 0 {
+			g.printf("if v, err := r.ReadData(); err != nil {\nreturn err\n} else {\n")
+			g.printf("%s = v\n}\n", expr)
+		} else {
+			g.printf("if err := r.ReadDataFixed(%s[:]); err != nil {\nreturn err\n}\n", expr)
+		}
+	case *schema.OptionalType:
+		g.printf("if ok, err := r.ReadOptional(); err != nil {\nreturn err\n} else if ok {\n")
+		g.printf("%s = new(%s)\n", expr, typeName(ty.Subtype()))
+		g.unmarshal("(*"+expr+")", typeName(ty.Subtype()), ty.Subtype(), depth)
+		g.printf("} else {\n%s = nil\n}\n", expr)
+	case *schema.ArrayType:
+		i := fmt.Sprintf("i%d", depth)
+		if ty.Length() == 0 {
+			g.printf("if n, err := r.ReadArrayLength(); err != nil {\nreturn err\n} else {\n")
+			g.printf("%s = make(%s, n)\n}\n", expr, goType)
+		}
+		g.printf("for %s := range %s {\n", i, expr)
+		g.unmarshal(fmt.Sprintf("%s[%s]", expr, i),
+			typeName(ty.Member()), ty.Member(), depth+1)
+		g.printf("}\n")
+	case *schema.MapType:
+		n := fmt.Sprintf("n%d", depth)
+		k, v := fmt.Sprintf("k%d", depth), fmt.Sprintf("v%d", depth)
+		g.printf("{\n%s, err := r.ReadMapSize()\n", n)
+		g.printf("if err != nil {\nreturn err\n}\n")
+		g.printf("%s = make(%s, %s)\n", expr, goType, n)
+		g.printf("for ; %s > 0; %s-- {\n", n, n)
+		g.printf("var %s %s\n", k, typeName(ty.Key()))
+		g.printf("var %s %s\n", v, typeName(ty.Value()))
+		g.unmarshal(k, typeName(ty.Key()), ty.Key(), depth+1)
+		g.printf("if _, ok := %s[%s]; ok {\n", expr, k)
+		g.printf("return fmt.Errorf(\"Encountered duplicate map key: %%v\", %s)\n}\n", k)
+		g.unmarshal(v, typeName(ty.Value()), ty.Value(), depth+1)
+		g.printf("%s[%s] = %s\n", expr, k, v)
+		g.printf("}\n}\n")
+	case *schema.StructType:
+		for _, field := range ty.Fields() {
+			g.unmarshal(expr+"."+capitalize(field.Name()),
+				typeName(field.Type()), field.Type(), depth)
+		}
+	case *schema.NamedUserType:
+		if g.unions[ty.Name()] {
+			g.printf("if v, err := unmarshal%s(r); err != nil {\nreturn err\n} else {\n",
+				ty.Name())
+			g.printf("%s = v\n}\n", expr)
+		} else {
+			g.printf("if err := %s.Unmarshal(r); err != nil {\nreturn err\n}\n", expr)
+		}
+	default:
+		panic(fmt.Sprintf("Unimplemented schema type: %T", ty))
+	}
+}
+
+// Returns the Go type used to represent a schema type, matching the "type"
+// template.
+func typeName(ty schema.Type) string {
+	switch ty := ty.(type) {
+	case *schema.PrimitiveType:
+		return primitiveType(ty.Kind())
+	case *schema.DataType:
+		if ty.Length() == 0 {
+			return "[]byte"
+		}
+		return fmt.Sprintf("[%d]byte", ty.Length())
+	case *schema.ArrayType:
+		if ty.Length() == 0 {
+			return "[]" + typeName(ty.Member())
+		}
+		return fmt.Sprintf("[%d]%s", ty.Length(), typeName(ty.Member()))
+	case *schema.StructType:
+		var fields []string
+		for _, field := range ty.Fields() {
+			fields = append(fields, fmt.Sprintf("%s %s %s",
+				capitalize(field.Name()), typeName(field.Type()),
+				structTag(field.Name())))
+		}
+		return "struct {\n" + strings.Join(fields, "\n") + "\n}"
+	case *schema.NamedUserType:
+		return ty.Name()
+	case *schema.MapType:
+		return "map[" + typeName(ty.Key()) + "]" + typeName(ty.Value())
+	case *schema.OptionalType:
+		return "*" + typeName(ty.Subtype())
+	default:
+		panic(fmt.Sprintf("Unimplemented schema type: %T", ty))
+	}
+}
+
+// Reports whether a schema type contains a map, whose generated code depends on
+// the fmt and sort packages.
+func containsMap(ty schema.Type) bool {
+	switch ty := ty.(type) {
+	case *schema.MapType:
+		return true
+	case *schema.ArrayType:
+		return containsMap(ty.Member())
+	case *schema.OptionalType:
+		return containsMap(ty.Subtype())
+	case *schema.StructType:
+		for _, field := range ty.Fields() {
+			if containsMap(field.Type()) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,108 @@
+package bare
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// A custom encoding for a type, registered with RegisterCodec.
+type Codec struct {
+	t      reflect.Type
+	encode EncodeFunc
+	decode DecodeFunc
+
+	mu     sync.RWMutex
+	schema string
+}
+
+var codecs sync.Map // map[reflect.Type]*Codec
+
+// Registers a custom encoding for a type, typically one from another package
+// which cannot implement Marshalable and Unmarshalable, which is used wherever
+// the type appears instead of the encoding derived from its kind. Codecs take
+// precedence over Marshalable and Unmarshalable.
+//
+// Codecs must be registered during initialization, from an init function or a
+// package-level variable, before the type is first marshaled or unmarshaled on
+// its own or as part of another type: types are only looked up once.
+// RegisterCodec panics if either function is nil, or if the type has already
+// been registered or used, but this check is not synchronized with Marshal and
+// Unmarshal, and cannot detect a type being used concurrently by other
+// goroutines.
+func RegisterCodec(t reflect.Type, encode EncodeFunc, decode DecodeFunc) *Codec {
+	if encode == nil || decode == nil {
+		panic(fmt.Errorf("Codec for type %s is missing an encode or decode function", t))
+	}
+	if _, ok := encodeFuncCache.Load(t); ok {
+		panic(fmt.Errorf("Type %s has already been marshaled", t))
+	}
+	if _, ok := decodeFuncCache.Load(t); ok {
+		panic(fmt.Errorf("Type %s has already been unmarshaled", t))
+	}
+
+	c := &Codec{t: t, encode: encode, decode: decode}
+	if _, loaded := codecs.LoadOrStore(t, c); loaded {
+		panic(fmt.Errorf("Type %s has already been registered", t))
+	}
+	return c
+}
+
+// Registers a custom encoding for the type T, like RegisterCodec, given
+// functions which write and read values of T through pointers.
+//
+//	bare.RegisterCodecOf(func(w *bare.Writer, d *time.Duration) error {
+//		return w.WriteI64(int64(*d))
+//	}, func(r *bare.Reader, d *time.Duration) error {
+//		i, err := r.ReadI64()
+//		*d = time.Duration(i)
+//		return err
+//	}).WithSchema("i64")
+func RegisterCodecOf[T any](encode func(w *Writer, v *T) error,
+	decode func(r *Reader, v *T) error) *Codec {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	if encode == nil || decode == nil {
+		panic(fmt.Errorf("Codec for type %s is missing an encode or decode function", t))
+	}
+	return RegisterCodec(t, func(w *Writer, v reflect.Value) error {
+		if v.CanAddr() {
+			return encode(w, v.Addr().Interface().(*T))
+		}
+		// e.g. map values
+		val := v.Interface().(T)
+		return encode(w, &val)
+	}, func(r *Reader, v reflect.Value) error {
+		return decode(r, v.Addr().Interface().(*T))
+	})
+}
+
+// Returns the codec registered for a type.
+func CodecFor(t reflect.Type) (*Codec, bool) {
+	c, ok := codecs.Load(t)
+	if !ok {
+		return nil, false
+	}
+	return c.(*Codec), true
+}
+
+// Returns the type the codec is registered for.
+func (c *Codec) Type() reflect.Type {
+	return c.t
+}
+
+// Sets the BARE schema language representation of the encoding, such as
+// "string" or "struct { seconds: i64 nanos: u32 }", which the schema package
+// uses to describe the type. Without one, the type has no known schema.
+func (c *Codec) WithSchema(schema string) *Codec {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.schema = schema
+	return c
+}
+
+// Returns the schema set with WithSchema, or an empty string.
+func (c *Codec) Schema() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.schema
+}
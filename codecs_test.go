@@ -0,0 +1,164 @@
+package bare
+
+import (
+	"errors"
+	"math/big"
+	"net"
+	"net/netip"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// A type from "another package", encoded as the number of tenths
+type tenths struct {
+	n int
+}
+
+// A type with both Marshalable and a codec
+type overridden uint8
+
+func (o *overridden) Marshal(w *Writer) error {
+	return errors.New("Marshal should not be called")
+}
+
+func init() {
+	RegisterCodecOf(func(w *Writer, v *tenths) error {
+		return w.WriteUint(uint64(v.n))
+	}, func(r *Reader, v *tenths) error {
+		n, err := r.ReadUint()
+		v.n = int(n)
+		return err
+	}).WithSchema("uint")
+
+	RegisterCodec(reflect.TypeOf(overridden(0)),
+		func(w *Writer, v reflect.Value) error {
+			return w.WriteU8(uint8(v.Uint()) + 1)
+		}, func(r *Reader, v reflect.Value) error {
+			i, err := r.ReadU8()
+			v.SetUint(uint64(i - 1))
+			return err
+		})
+
+	RegisterStandardCodecs()
+}
+
+func TestCodec(t *testing.T) {
+	type record struct {
+		Value  tenths
+		Values map[string]tenths
+	}
+	val := record{tenths{300}, map[string]tenths{"a": {1}}}
+	data, err := Marshal(&val)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0xAC, 0x02, 0x01, 0x01, 'a', 0x01}, data)
+
+	var decoded record
+	err = Unmarshal(data, &decoded)
+	assert.Nil(t, err)
+	assert.Equal(t, val, decoded)
+
+	c, ok := CodecFor(reflect.TypeOf(tenths{}))
+	assert.True(t, ok)
+	assert.Equal(t, "uint", c.Schema())
+	_, ok = CodecFor(reflect.TypeOf(0))
+	assert.False(t, ok)
+}
+
+func TestCodecOverridesMarshalable(t *testing.T) {
+	// Codecs for u8 types are not written as data either
+	vals := []overridden{1, 2}
+	data, err := Marshal(&vals)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0x02, 0x02, 0x03}, data)
+
+	var decoded []overridden
+	err = Unmarshal(data, &decoded)
+	assert.Nil(t, err)
+	assert.Equal(t, vals, decoded)
+}
+
+func TestRegisterCodecPanics(t *testing.T) {
+	type missing uint8
+	assert.PanicsWithError(t,
+		"Codec for type bare.missing is missing an encode or decode function",
+		func() {
+			RegisterCodec(reflect.TypeOf(missing(0)), nil,
+				func(r *Reader, v reflect.Value) error { return nil })
+		})
+	assert.PanicsWithError(t,
+		"Codec for type bare.missing is missing an encode or decode function",
+		func() {
+			RegisterCodecOf(func(w *Writer, v *missing) error { return nil }, nil)
+		})
+	_, ok := CodecFor(reflect.TypeOf(missing(0)))
+	assert.False(t, ok)
+
+	assert.Panics(t, func() {
+		RegisterCodecOf(func(w *Writer, v *tenths) error { return nil },
+			func(r *Reader, v *tenths) error { return nil })
+	})
+
+	type used uint8
+	var u used
+	_, err := Marshal(&u)
+	assert.Nil(t, err)
+	assert.Panics(t, func() {
+		RegisterCodecOf(func(w *Writer, v *used) error { return nil },
+			func(r *Reader, v *used) error { return nil })
+	})
+}
+
+func TestStandardCodecs(t *testing.T) {
+	type record struct {
+		Time  time.Time
+		IP    net.IP
+		Addr  netip.Addr
+		URL   url.URL
+		Count *big.Int
+	}
+	u, _ := url.Parse("https://example.org/path?q=1")
+	val := record{
+		Time:  time.Date(2020, 5, 17, 13, 4, 5, 600, time.FixedZone("", 3600)),
+		IP:    net.ParseIP("192.0.2.1"),
+		Addr:  netip.MustParseAddr("2001:db8::1"),
+		URL:   *u,
+		Count: big.NewInt(0).Lsh(big.NewInt(1), 100),
+	}
+	data, err := Marshal(&val)
+	assert.Nil(t, err)
+
+	var decoded record
+	err = Unmarshal(data, &decoded)
+	assert.Nil(t, err)
+	assert.True(t, val.Time.Equal(decoded.Time))
+	assert.Equal(t, "2020-05-17T13:04:05.0000006+01:00",
+		decoded.Time.Format(time.RFC3339Nano))
+	assert.Equal(t, net.IP{192, 0, 2, 1}, decoded.IP)
+	assert.Equal(t, val.Addr, decoded.Addr)
+	assert.Equal(t, val.URL, decoded.URL)
+	assert.Equal(t, 0, val.Count.Cmp(decoded.Count))
+
+	_, err = Marshal(&record{Time: time.Date(10000, 1, 1, 0, 0, 0, 0, time.UTC)})
+	assert.EqualError(t, errors.Unwrap(err), "Year 10000 is outside the range of RFC 3339")
+
+	// Decoded addresses do not refer to the input
+	var ip net.IP
+	input := []byte{0x04, 192, 0, 2, 1}
+	err = UnmarshalNoCopy(input, &ip)
+	assert.Nil(t, err)
+	input[1] = 10
+	assert.Equal(t, net.IP{192, 0, 2, 1}, ip)
+
+	err = Unmarshal([]byte{0x03, 0x01, 0x02, 0x03}, &ip)
+	assert.EqualError(t, errors.Unwrap(err), "Invalid IP address length 3")
+	var i big.Int
+	err = Unmarshal([]byte{0x02, 'x', 'y'}, &i)
+	assert.EqualError(t, errors.Unwrap(err), `Invalid integer "xy"`)
+
+	// Calling it again does nothing
+	RegisterStandardCodecs()
+}
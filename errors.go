@@ -8,6 +8,34 @@ import (
 
 var ErrInvalidStr = errors.New("String contains invalid UTF-8 sequences")
 
+// Returned in strict mode when a varint is encoded with more bytes than
+// necessary, e.g. 0x80 0x00 for zero.
+var ErrNonCanonical = errors.New("Varint is not minimally encoded")
+
+// Matches the TrailingDataError returned when a message is followed by more
+// data and DecodeOptions.DisallowTrailingData is set. Use errors.Is to check
+// for it.
+var ErrTrailingData = errors.New("Trailing data after message")
+
+// Returned when a message is followed by more data and
+// DecodeOptions.DisallowTrailingData is set.
+type TrailingDataError struct {
+	// Length of the message, in bytes
+	Offset int64
+	// Number of bytes after the message. For messages read from an io.Reader,
+	// the bytes are only counted up to the MaxUnmarshalBytes limit.
+	Bytes int64
+}
+
+func (e *TrailingDataError) Error() string {
+	return fmt.Sprintf("%d bytes of trailing data after message at offset %d",
+		e.Bytes, e.Offset)
+}
+
+func (e *TrailingDataError) Is(target error) bool {
+	return target == ErrTrailingData
+}
+
 type UnsupportedTypeError struct {
 	Type reflect.Type
 }
@@ -15,3 +43,182 @@ type UnsupportedTypeError struct {
 func (e *UnsupportedTypeError) Error() string {
 	return fmt.Sprintf("Unsupported type for marshaling: %s\n", e.Type.String())
 }
+
+// Returned when a message cannot be decoded. It describes the value which
+// failed to decode and wraps the underlying error.
+type DecodeError struct {
+	// Path to the value from the root of the message, made of Go type names,
+	// struct field names, indices and map keys, e.g.
+	// "Customer.orders[3].quantity"
+	Path string
+	// Offset of the value from the start of the input, in bytes
+	Offset int64
+	// Go type of the value
+	Type reflect.Type
+	// The underlying error
+	Err error
+}
+
+// Returns the BARE type which was expected at the location of the error.
+func (e *DecodeError) Expected() string {
+	return typeName(e.Type)
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("%s: decoding %s at offset %d: %s",
+		e.Path, e.Expected(), e.Offset, e.Err.Error())
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// Returned when a value cannot be encoded. It describes the value which
+// failed to encode and wraps the underlying error.
+type EncodeError struct {
+	// Path to the value from the root of the message. See DecodeError.
+	Path string
+	// Go type of the value
+	Type reflect.Type
+	// The underlying error
+	Err error
+}
+
+// Returns the BARE type the value was being encoded as.
+func (e *EncodeError) Expected() string {
+	return typeName(e.Type)
+}
+
+func (e *EncodeError) Error() string {
+	return fmt.Sprintf("%s: encoding %s: %s",
+		e.Path, e.Expected(), e.Err.Error())
+}
+
+func (e *EncodeError) Unwrap() error {
+	return e.Err
+}
+
+// Attributes an error to the value at the given path segment, relative to the
+// value being decoded by the caller.
+func wrapDecodeError(err error, seg string, t reflect.Type, offset int64) error {
+	if de, ok := err.(*DecodeError); ok {
+		de.Path = seg + de.Path
+		return de
+	}
+	return &DecodeError{Path: seg, Offset: offset, Type: t, Err: err}
+}
+
+// Attributes an error to the value at the given path segment, relative to the
+// value being encoded by the caller.
+func wrapEncodeError(err error, seg string, t reflect.Type) error {
+	if ee, ok := err.(*EncodeError); ok {
+		ee.Path = seg + ee.Path
+		return ee
+	}
+	return &EncodeError{Path: seg, Type: t, Err: err}
+}
+
+// Path segments used in DecodeError and EncodeError.
+
+func rootSegment(t reflect.Type) string {
+	if t.Name() != "" {
+		return t.Name()
+	}
+	return t.String()
+}
+
+func fieldSegment(field reflect.StructField) string {
+	if tag := field.Tag.Get("bare"); tag != "" {
+		return "." + tag
+	}
+	return "." + field.Name
+}
+
+func indexSegment(i int) string {
+	return fmt.Sprintf("[%d]", i)
+}
+
+func keySegment(key reflect.Value) string {
+	if key.Kind() == reflect.String {
+		return fmt.Sprintf("[%q]", key.String())
+	}
+	return fmt.Sprintf("[%v]", key.Interface())
+}
+
+func unionSegment(t reflect.Type) string {
+	return ".(" + rootSegment(t) + ")"
+}
+
+// Returns the name of the BARE type a Go type is encoded as. Named aggregate
+// types are given by name.
+func typeName(t reflect.Type) string {
+	switch t {
+	case intType:
+		return "int"
+	case uintType:
+		return "uint"
+	}
+
+	if reflect.PtrTo(t).Implements(unmarshalableInterface) ||
+		reflect.PtrTo(t).Implements(marshalableInterface) {
+		return rootSegment(t)
+	}
+
+	switch t.Kind() {
+	case reflect.Struct, reflect.Interface,
+		reflect.Array, reflect.Slice, reflect.Map:
+		if t.Name() != "" {
+			return t.Name()
+		}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return "optional<" + typeName(t.Elem()) + ">"
+	case reflect.Struct:
+		return "struct"
+	case reflect.Interface:
+		return "union"
+	case reflect.Array:
+		if typeName(t.Elem()) == "u8" {
+			return fmt.Sprintf("data<%d>", t.Len())
+		}
+		return fmt.Sprintf("[%d]%s", t.Len(), typeName(t.Elem()))
+	case reflect.Slice:
+		if typeName(t.Elem()) == "u8" {
+			return "data"
+		}
+		return "[]" + typeName(t.Elem())
+	case reflect.Map:
+		return "map[" + typeName(t.Key()) + "]" + typeName(t.Elem())
+	case reflect.Uint8:
+		return "u8"
+	case reflect.Uint16:
+		return "u16"
+	case reflect.Uint32:
+		return "u32"
+	case reflect.Uint64:
+		return "u64"
+	case reflect.Uint:
+		return "uint"
+	case reflect.Int8:
+		return "i8"
+	case reflect.Int16:
+		return "i16"
+	case reflect.Int32:
+		return "i32"
+	case reflect.Int64:
+		return "i64"
+	case reflect.Int:
+		return "int"
+	case reflect.Float32:
+		return "f32"
+	case reflect.Float64:
+		return "f64"
+	case reflect.Bool:
+		return "bool"
+	case reflect.String:
+		return "string"
+	}
+	return t.String()
+}
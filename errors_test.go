@@ -0,0 +1,97 @@
+package bare
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type errOrder struct {
+	OrderId  int64 `bare:"orderId"`
+	Quantity int32 `bare:"quantity"`
+}
+
+type errCustomer struct {
+	Name     string            `bare:"name"`
+	Orders   []errOrder        `bare:"orders"`
+	Metadata map[string]*uint8 `bare:"metadata"`
+}
+
+func TestDecodeErrorPath(t *testing.T) {
+	payload := []byte{
+		0x04, 0x4d, 0x61, 0x72, 0x79, // name
+		0x02, // orders
+		0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x05, 0x00, 0x00, 0x00,
+		0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x05, 0x00,
+	}
+	var val errCustomer
+	err := Unmarshal(payload, &val)
+
+	var de *DecodeError
+	assert.True(t, errors.As(err, &de))
+	assert.Equal(t, "errCustomer.orders[1].quantity", de.Path)
+	assert.Equal(t, int64(26), de.Offset)
+	assert.Equal(t, reflect.TypeOf(int32(0)), de.Type)
+	assert.Equal(t, "i32", de.Expected())
+	assert.True(t, errors.Is(err, io.ErrUnexpectedEOF))
+	assert.EqualError(t, err, "errCustomer.orders[1].quantity: "+
+		"decoding i32 at offset 26: unexpected EOF")
+}
+
+func TestDecodeErrorMapValue(t *testing.T) {
+	payload := []byte{
+		0x00, // name
+		0x00, // orders
+		0x01, // metadata
+		0x03, 0x6b, 0x65, 0x79,
+		0x02,
+	}
+	var val errCustomer
+	err := Unmarshal(payload, &val)
+
+	var de *DecodeError
+	assert.True(t, errors.As(err, &de))
+	assert.Equal(t, `errCustomer.metadata["key"]`, de.Path)
+	assert.Equal(t, int64(7), de.Offset)
+	assert.Equal(t, "optional<u8>", de.Expected())
+	assert.EqualError(t, de.Err, "Invalid optional value: 0x2")
+}
+
+func TestDecodeErrorUnion(t *testing.T) {
+	type T struct {
+		NameAge NameAge
+	}
+	var val T
+	err := Unmarshal([]byte{0x00, 0x04, 0x4d}, &val)
+
+	var de *DecodeError
+	assert.True(t, errors.As(err, &de))
+	assert.Equal(t, "T.NameAge.(Name)", de.Path)
+	assert.Equal(t, int64(1), de.Offset)
+	assert.Equal(t, "string", de.Expected())
+
+	err = Unmarshal([]byte{0x13}, &val)
+	assert.True(t, errors.As(err, &de))
+	assert.Equal(t, "T.NameAge", de.Path)
+	assert.Equal(t, "NameAge", de.Expected())
+	assert.EqualError(t, de.Err, "Invalid union tag 19 for type NameAge")
+}
+
+func TestEncodeErrorPath(t *testing.T) {
+	type T struct {
+		Values []NameAge `bare:"values"`
+	}
+	val := T{Values: []NameAge{Name("Mary"), nil}}
+	_, err := Marshal(&val)
+
+	var ee *EncodeError
+	assert.True(t, errors.As(err, &ee))
+	assert.Equal(t, "T.values[1]", ee.Path)
+	assert.Equal(t, "NameAge", ee.Expected())
+	assert.EqualError(t, ee.Err, "Nil value for union type NameAge")
+}
@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	bare "git.sr.ht/~runxiyu/go-bareish"
+	"git.sr.ht/~runxiyu/go-bareish/example/static"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -35,6 +36,96 @@ func BenchmarkUnmarshal(b *testing.B) {
 
 }
 
+// The static benchmarks use code generated with the -static option, which
+// bypasses reflection below the root of the message.
+
+func BenchmarkMarshalStatic(b *testing.B) {
+	person, _ := makeStaticCustomer(b)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		_, err := bare.Marshal(person)
+		if err != nil {
+			panic(err)
+		}
+	}
+}
+
+func BenchmarkUnmarshalStatic(b *testing.B) {
+	_, buf := makeStaticCustomer(b)
+	var person static.Person
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		err := bare.Unmarshal(buf, &person)
+		if err != nil {
+			panic(err)
+		}
+	}
+}
+
+// The data benchmarks encode large byte slices and arrays, which are written
+// and read all at once.
+
+var dataOptions = bare.DecodeOptions{MaxArrayLength: 64 * 1024}
+
+type blob struct {
+	Key  PublicKey
+	Data []byte
+}
+
+func makeBlob(b *testing.B) (*blob, []byte) {
+	val := &blob{Data: make([]byte, 64*1024)}
+	for i := range val.Data {
+		val.Data[i] = byte(i)
+	}
+	buf, err := bare.Marshal(val)
+	assert.Nil(b, err)
+
+	b.SetBytes(int64(len(buf)))
+	return val, buf
+}
+
+func BenchmarkMarshalData(b *testing.B) {
+	val, _ := makeBlob(b)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		_, err := bare.Marshal(val)
+		if err != nil {
+			panic(err)
+		}
+	}
+}
+
+func BenchmarkUnmarshalData(b *testing.B) {
+	_, buf := makeBlob(b)
+	var val blob
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		err := dataOptions.Unmarshal(buf, &val)
+		if err != nil {
+			panic(err)
+		}
+	}
+}
+
+func BenchmarkUnmarshalDataNoCopy(b *testing.B) {
+	_, buf := makeBlob(b)
+	var val blob
+	opts := dataOptions
+	opts.NoCopy = true
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		err := opts.Unmarshal(buf, &val)
+		if err != nil {
+			panic(err)
+		}
+	}
+}
+
 func makeCustomer(b *testing.B) (Person, []byte) {
 	buf, err := ioutil.ReadFile("customer.bin")
 	assert.Nil(b, err)
@@ -47,3 +138,16 @@ func makeCustomer(b *testing.B) (Person, []byte) {
 
 	return person, buf
 }
+
+func makeStaticCustomer(b *testing.B) (static.Person, []byte) {
+	buf, err := ioutil.ReadFile("customer.bin")
+	assert.Nil(b, err)
+
+	b.SetBytes(int64(len(buf)))
+
+	var person static.Person
+	err = bare.Unmarshal(buf, &person)
+	assert.Nil(b, err)
+
+	return person, buf
+}
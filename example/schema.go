@@ -106,6 +106,22 @@ func (t Department) String() string {
 	panic(errors.New("Invalid Department value"))
 }
 
+func (t Department) IsValid() bool {
+	switch t {
+	case ACCOUNTING:
+		return true
+	case ADMINISTRATION:
+		return true
+	case CUSTOMER_SERVICE:
+		return true
+	case DEVELOPMENT:
+		return true
+	case JSMITH:
+		return true
+	}
+	return false
+}
+
 type Person interface {
 	bare.Union
 }
@@ -0,0 +1,565 @@
+package static
+
+// Code generated by go-bare/cmd/gen, DO NOT EDIT.
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	bare "git.sr.ht/~runxiyu/go-bareish"
+)
+
+type PublicKey [128]byte
+
+func (t *PublicKey) Decode(data []byte) error {
+	return bare.Unmarshal(data, t)
+}
+
+func (t *PublicKey) Encode() ([]byte, error) {
+	return bare.Marshal(t)
+}
+
+func (t *PublicKey) Marshal(w *bare.Writer) error {
+	if err := w.Enter(); err != nil {
+		return err
+	}
+	defer w.Leave()
+	if err := w.WriteDataFixed((*t)[:]); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (t *PublicKey) Unmarshal(r *bare.Reader) error {
+	if err := r.Enter(); err != nil {
+		return err
+	}
+	defer r.Leave()
+	if err := r.ReadDataFixed((*t)[:]); err != nil {
+		return err
+	}
+	return nil
+}
+
+type Customer struct {
+	Name    string  `bare:"name"`
+	Email   string  `bare:"email"`
+	Address Address `bare:"address"`
+	Orders  []struct {
+		OrderId  int64 `bare:"orderId"`
+		Quantity int32 `bare:"quantity"`
+	} `bare:"orders"`
+	Metadata map[string][]byte `bare:"metadata"`
+}
+
+func (t *Customer) Decode(data []byte) error {
+	return bare.Unmarshal(data, t)
+}
+
+func (t *Customer) Encode() ([]byte, error) {
+	return bare.Marshal(t)
+}
+
+func (t *Customer) Marshal(w *bare.Writer) error {
+	if err := w.Enter(); err != nil {
+		return err
+	}
+	defer w.Leave()
+	if err := w.WriteString(string(t.Name)); err != nil {
+		return err
+	}
+	if err := w.WriteString(string(t.Email)); err != nil {
+		return err
+	}
+	if err := t.Address.Marshal(w); err != nil {
+		return err
+	}
+	if err := w.WriteUint(uint64(len(t.Orders))); err != nil {
+		return err
+	}
+	for i0 := range t.Orders {
+		if err := w.WriteI64(int64(t.Orders[i0].OrderId)); err != nil {
+			return err
+		}
+		if err := w.WriteI32(int32(t.Orders[i0].Quantity)); err != nil {
+			return err
+		}
+	}
+	if err := w.WriteUint(uint64(len(t.Metadata))); err != nil {
+		return err
+	}
+	if w.Canonical() {
+		keys0 := make([]string, 0, len(t.Metadata))
+		for k0 := range t.Metadata {
+			keys0 = append(keys0, k0)
+		}
+		sort.Slice(keys0, func(i, j int) bool { return keys0[i] < keys0[j] })
+		for _, k0 := range keys0 {
+			v0 := t.Metadata[k0]
+			if err := w.WriteString(string(k0)); err != nil {
+				return err
+			}
+			if err := w.WriteData(v0); err != nil {
+				return err
+			}
+		}
+	} else {
+		for k0, v0 := range t.Metadata {
+			if err := w.WriteString(string(k0)); err != nil {
+				return err
+			}
+			if err := w.WriteData(v0); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (t *Customer) Unmarshal(r *bare.Reader) error {
+	if err := r.Enter(); err != nil {
+		return err
+	}
+	defer r.Leave()
+	if v, err := r.ReadString(); err != nil {
+		return err
+	} else {
+		t.Name = string(v)
+	}
+	if v, err := r.ReadString(); err != nil {
+		return err
+	} else {
+		t.Email = string(v)
+	}
+	if err := t.Address.Unmarshal(r); err != nil {
+		return err
+	}
+	if n, err := r.ReadArrayLength(); err != nil {
+		return err
+	} else {
+		t.Orders = make([]struct {
+			OrderId  int64 `bare:"orderId"`
+			Quantity int32 `bare:"quantity"`
+		}, n)
+	}
+	for i0 := range t.Orders {
+		if v, err := r.ReadI64(); err != nil {
+			return err
+		} else {
+			t.Orders[i0].OrderId = int64(v)
+		}
+		if v, err := r.ReadI32(); err != nil {
+			return err
+		} else {
+			t.Orders[i0].Quantity = int32(v)
+		}
+	}
+	{
+		n0, err := r.ReadMapSize()
+		if err != nil {
+			return err
+		}
+		t.Metadata = make(map[string][]byte, n0)
+		for ; n0 > 0; n0-- {
+			var k0 string
+			var v0 []byte
+			if v, err := r.ReadString(); err != nil {
+				return err
+			} else {
+				k0 = string(v)
+			}
+			if _, ok := t.Metadata[k0]; ok {
+				return fmt.Errorf("Encountered duplicate map key: %v", k0)
+			}
+			if v, err := r.ReadData(); err != nil {
+				return err
+			} else {
+				v0 = v
+			}
+			t.Metadata[k0] = v0
+		}
+	}
+	return nil
+}
+
+type Employee struct {
+	Name       string            `bare:"name"`
+	Email      string            `bare:"email"`
+	Address    Address           `bare:"address"`
+	Department Department        `bare:"department"`
+	HireDate   Time              `bare:"hireDate"`
+	PublicKey  *PublicKey        `bare:"publicKey"`
+	Metadata   map[string][]byte `bare:"metadata"`
+}
+
+func (t *Employee) Decode(data []byte) error {
+	return bare.Unmarshal(data, t)
+}
+
+func (t *Employee) Encode() ([]byte, error) {
+	return bare.Marshal(t)
+}
+
+func (t *Employee) Marshal(w *bare.Writer) error {
+	if err := w.Enter(); err != nil {
+		return err
+	}
+	defer w.Leave()
+	if err := w.WriteString(string(t.Name)); err != nil {
+		return err
+	}
+	if err := w.WriteString(string(t.Email)); err != nil {
+		return err
+	}
+	if err := t.Address.Marshal(w); err != nil {
+		return err
+	}
+	if err := t.Department.Marshal(w); err != nil {
+		return err
+	}
+	if err := t.HireDate.Marshal(w); err != nil {
+		return err
+	}
+	if t.PublicKey == nil {
+		if err := w.WriteBool(false); err != nil {
+			return err
+		}
+	} else {
+		if err := w.WriteBool(true); err != nil {
+			return err
+		}
+		if err := (*t.PublicKey).Marshal(w); err != nil {
+			return err
+		}
+	}
+	if err := w.WriteUint(uint64(len(t.Metadata))); err != nil {
+		return err
+	}
+	if w.Canonical() {
+		keys0 := make([]string, 0, len(t.Metadata))
+		for k0 := range t.Metadata {
+			keys0 = append(keys0, k0)
+		}
+		sort.Slice(keys0, func(i, j int) bool { return keys0[i] < keys0[j] })
+		for _, k0 := range keys0 {
+			v0 := t.Metadata[k0]
+			if err := w.WriteString(string(k0)); err != nil {
+				return err
+			}
+			if err := w.WriteData(v0); err != nil {
+				return err
+			}
+		}
+	} else {
+		for k0, v0 := range t.Metadata {
+			if err := w.WriteString(string(k0)); err != nil {
+				return err
+			}
+			if err := w.WriteData(v0); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (t *Employee) Unmarshal(r *bare.Reader) error {
+	if err := r.Enter(); err != nil {
+		return err
+	}
+	defer r.Leave()
+	if v, err := r.ReadString(); err != nil {
+		return err
+	} else {
+		t.Name = string(v)
+	}
+	if v, err := r.ReadString(); err != nil {
+		return err
+	} else {
+		t.Email = string(v)
+	}
+	if err := t.Address.Unmarshal(r); err != nil {
+		return err
+	}
+	if err := t.Department.Unmarshal(r); err != nil {
+		return err
+	}
+	if err := t.HireDate.Unmarshal(r); err != nil {
+		return err
+	}
+	if ok, err := r.ReadOptional(); err != nil {
+		return err
+	} else if ok {
+		t.PublicKey = new(PublicKey)
+		if err := (*t.PublicKey).Unmarshal(r); err != nil {
+			return err
+		}
+	} else {
+		t.PublicKey = nil
+	}
+	{
+		n0, err := r.ReadMapSize()
+		if err != nil {
+			return err
+		}
+		t.Metadata = make(map[string][]byte, n0)
+		for ; n0 > 0; n0-- {
+			var k0 string
+			var v0 []byte
+			if v, err := r.ReadString(); err != nil {
+				return err
+			} else {
+				k0 = string(v)
+			}
+			if _, ok := t.Metadata[k0]; ok {
+				return fmt.Errorf("Encountered duplicate map key: %v", k0)
+			}
+			if v, err := r.ReadData(); err != nil {
+				return err
+			} else {
+				v0 = v
+			}
+			t.Metadata[k0] = v0
+		}
+	}
+	return nil
+}
+
+type TerminatedEmployee struct{}
+
+func (t *TerminatedEmployee) Decode(data []byte) error {
+	return bare.Unmarshal(data, t)
+}
+
+func (t *TerminatedEmployee) Encode() ([]byte, error) {
+	return bare.Marshal(t)
+}
+
+func (t *TerminatedEmployee) Marshal(w *bare.Writer) error {
+	if err := w.Enter(); err != nil {
+		return err
+	}
+	defer w.Leave()
+	return nil
+}
+
+func (t *TerminatedEmployee) Unmarshal(r *bare.Reader) error {
+	if err := r.Enter(); err != nil {
+		return err
+	}
+	defer r.Leave()
+	return nil
+}
+
+type Address struct {
+	Address [4]string `bare:"address"`
+	City    string    `bare:"city"`
+	State   string    `bare:"state"`
+	Country string    `bare:"country"`
+}
+
+func (t *Address) Decode(data []byte) error {
+	return bare.Unmarshal(data, t)
+}
+
+func (t *Address) Encode() ([]byte, error) {
+	return bare.Marshal(t)
+}
+
+func (t *Address) Marshal(w *bare.Writer) error {
+	if err := w.Enter(); err != nil {
+		return err
+	}
+	defer w.Leave()
+	for i0 := range t.Address {
+		if err := w.WriteString(string(t.Address[i0])); err != nil {
+			return err
+		}
+	}
+	if err := w.WriteString(string(t.City)); err != nil {
+		return err
+	}
+	if err := w.WriteString(string(t.State)); err != nil {
+		return err
+	}
+	if err := w.WriteString(string(t.Country)); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (t *Address) Unmarshal(r *bare.Reader) error {
+	if err := r.Enter(); err != nil {
+		return err
+	}
+	defer r.Leave()
+	for i0 := range t.Address {
+		if v, err := r.ReadString(); err != nil {
+			return err
+		} else {
+			t.Address[i0] = string(v)
+		}
+	}
+	if v, err := r.ReadString(); err != nil {
+		return err
+	} else {
+		t.City = string(v)
+	}
+	if v, err := r.ReadString(); err != nil {
+		return err
+	} else {
+		t.State = string(v)
+	}
+	if v, err := r.ReadString(); err != nil {
+		return err
+	} else {
+		t.Country = string(v)
+	}
+	return nil
+}
+
+type Department uint
+
+const (
+	ACCOUNTING       Department = 0
+	ADMINISTRATION   Department = 1
+	CUSTOMER_SERVICE Department = 2
+	DEVELOPMENT      Department = 3
+	JSMITH           Department = 99
+)
+
+func (t Department) String() string {
+	switch t {
+	case ACCOUNTING:
+		return "ACCOUNTING"
+	case ADMINISTRATION:
+		return "ADMINISTRATION"
+	case CUSTOMER_SERVICE:
+		return "CUSTOMER_SERVICE"
+	case DEVELOPMENT:
+		return "DEVELOPMENT"
+	case JSMITH:
+		return "JSMITH"
+	}
+	panic(errors.New("Invalid Department value"))
+}
+
+func (t Department) IsValid() bool {
+	switch t {
+	case ACCOUNTING:
+		return true
+	case ADMINISTRATION:
+		return true
+	case CUSTOMER_SERVICE:
+		return true
+	case DEVELOPMENT:
+		return true
+	case JSMITH:
+		return true
+	}
+	return false
+}
+
+func (t *Department) Marshal(w *bare.Writer) error {
+	if err := w.CheckEnum(*t); err != nil {
+		return err
+	}
+	if err := w.WriteUint(uint64(*t)); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (t *Department) Unmarshal(r *bare.Reader) error {
+	if v, err := r.ReadUint(); err != nil {
+		return err
+	} else {
+		*t = Department(v)
+	}
+	return r.CheckEnum(*t)
+}
+
+type Person interface {
+	bare.Union
+}
+
+func (_ Customer) IsUnion() {}
+
+func (_ Employee) IsUnion() {}
+
+func (_ TerminatedEmployee) IsUnion() {}
+
+func marshalPerson(w *bare.Writer, v Person) error {
+	switch v := v.(type) {
+	case Customer:
+		if err := w.WriteUint(0); err != nil {
+			return err
+		}
+		return v.Marshal(w)
+	case *Customer:
+		if err := w.WriteUint(0); err != nil {
+			return err
+		}
+		return v.Marshal(w)
+	case Employee:
+		if err := w.WriteUint(1); err != nil {
+			return err
+		}
+		return v.Marshal(w)
+	case *Employee:
+		if err := w.WriteUint(1); err != nil {
+			return err
+		}
+		return v.Marshal(w)
+	case TerminatedEmployee:
+		if err := w.WriteUint(2); err != nil {
+			return err
+		}
+		return v.Marshal(w)
+	case *TerminatedEmployee:
+		if err := w.WriteUint(2); err != nil {
+			return err
+		}
+		return v.Marshal(w)
+	case nil:
+		return errors.New("Nil value for union type Person")
+	}
+	return fmt.Errorf("Invalid union value: %T", v)
+}
+
+func unmarshalPerson(r *bare.Reader) (Person, error) {
+	tag, err := r.ReadUint()
+	if err != nil {
+		return nil, err
+	}
+	switch tag {
+	case 0:
+		v := new(Customer)
+		if err := v.Unmarshal(r); err != nil {
+			return nil, err
+		}
+		return v, nil
+	case 1:
+		v := new(Employee)
+		if err := v.Unmarshal(r); err != nil {
+			return nil, err
+		}
+		return v, nil
+	case 2:
+		v := new(TerminatedEmployee)
+		if err := v.Unmarshal(r); err != nil {
+			return nil, err
+		}
+		return v, nil
+	}
+	return nil, fmt.Errorf("Invalid union tag %d for type Person", tag)
+}
+
+func init() {
+	bare.RegisterUnion((*Person)(nil)).
+		Member(*new(Customer), 0).
+		Member(*new(Employee), 1).
+		Member(*new(TerminatedEmployee), 2)
+
+}
@@ -0,0 +1,31 @@
+package static
+
+//go:generate go run git.sr.ht/~runxiyu/go-bareish/cmd/gen -static -p static -s Time ../schema.bare schema.go
+
+import (
+	"fmt"
+	"time"
+
+	bare "git.sr.ht/~runxiyu/go-bareish"
+)
+
+type Time time.Time
+
+func (t *Time) Unmarshal(r *bare.Reader) error {
+	st, err := r.ReadString()
+	if err != nil {
+		return fmt.Errorf("Time.Unmarshal: read string: %e", err)
+	}
+
+	tm, err := time.Parse(time.RFC3339, st)
+	if err != nil {
+		return fmt.Errorf("Time.Unmarshal: parse time: %e", err)
+	}
+
+	*t = Time(tm)
+	return nil
+}
+
+func (t *Time) Marshal(w *bare.Writer) error {
+	return w.WriteString(time.Time(*t).Format(time.RFC3339))
+}
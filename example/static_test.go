@@ -0,0 +1,62 @@
+package example
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	bare "git.sr.ht/~runxiyu/go-bareish"
+	"git.sr.ht/~runxiyu/go-bareish/example/static"
+)
+
+// Decodes a message with the code generated with -static, encodes it again
+// with it, and checks that the reflective codecs agree on both.
+func assertStaticMatches(t *testing.T, buf []byte) int {
+	opts := bare.EncodeOptions{Canonical: true}
+
+	var person Person
+	n, err := bare.UnmarshalPrefix(buf, &person)
+	assert.Nil(t, err)
+	var staticPerson static.Person
+	staticN, err := bare.UnmarshalPrefix(buf, &staticPerson)
+	assert.Nil(t, err)
+	assert.Equal(t, n, staticN)
+
+	data, err := opts.Marshal(&person)
+	assert.Nil(t, err)
+	staticData, err := opts.Marshal(&staticPerson)
+	assert.Nil(t, err)
+	assert.Equal(t, data, staticData)
+	return n
+}
+
+func TestStaticMatchesReflection(t *testing.T) {
+	for _, file := range []string{
+		"customer.bin", "employee.bin", "terminated.bin", "people.bin",
+	} {
+		t.Run(file, func(t *testing.T) {
+			buf, err := ioutil.ReadFile(file)
+			assert.Nil(t, err)
+			for len(buf) > 0 {
+				n := assertStaticMatches(t, buf)
+				if n == 0 {
+					break
+				}
+				buf = buf[n:]
+			}
+		})
+	}
+
+	// The fixtures have no optional values, nor maps with several entries
+	buf, err := ioutil.ReadFile("employee.bin")
+	assert.Nil(t, err)
+	var person Person
+	assert.Nil(t, bare.Unmarshal(buf, &person))
+	employee := person.(*Employee)
+	employee.PublicKey = &PublicKey{0x01, 0x02, 0x03}
+	employee.Metadata = map[string][]byte{"b": {0x02}, "a": {0x01}, "c": nil}
+	buf, err = bare.Marshal(&person)
+	assert.Nil(t, err)
+	assertStaticMatches(t, buf)
+}
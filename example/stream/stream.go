@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"strings"
@@ -12,9 +13,16 @@ import (
 )
 
 func main() {
-	var person example.Person
-	var err error
-	for ; err == nil; err = bare.UnmarshalReader(os.Stdin, &person) {
+	dec := bare.NewDecoder(os.Stdin)
+	for {
+		var person example.Person
+		err := dec.Decode(&person)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			log.Fatalf("decode: %e", err)
+		}
+
 		switch person := person.(type) {
 		case *example.Customer:
 			var addrs []string
@@ -62,5 +70,4 @@ Hire date: %s
 			log.Println("Terminated employee (no data)")
 		}
 	}
-	log.Printf("Error: %e", err)
 }
@@ -23,3 +23,7 @@ func (t *Time) Unmarshal(r *bare.Reader) error {
 	*t = Time(tm)
 	return nil
 }
+
+func (t *Time) Marshal(w *bare.Writer) error {
+	return w.WriteString(time.Time(*t).Format(time.RFC3339))
+}
@@ -0,0 +1,31 @@
+package bare_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	bare "git.sr.ht/~runxiyu/go-bareish"
+	"git.sr.ht/~runxiyu/go-bareish/internal/inittest/encodefirst"
+	_ "git.sr.ht/~runxiyu/go-bareish/internal/inittest/registerlater"
+	"git.sr.ht/~runxiyu/go-bareish/internal/inittest/shapes"
+)
+
+func TestUnionRegisteredAfterUse(t *testing.T) {
+	// encodefirst was initialized before registerlater
+	assert.EqualError(t, errors.Unwrap(encodefirst.MarshalErr),
+		"Union type Shape is not registered")
+	assert.EqualError(t, errors.Unwrap(encodefirst.UnmarshalErr),
+		"Union type Shape is not registered")
+
+	// The codecs built then see the registration now
+	drawing := shapes.Drawing{Shapes: []shapes.Shape{shapes.Circle{Radius: 1}}}
+	data, err := bare.Marshal(&drawing)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x01, 0x00, 0x01}, data)
+
+	var decoded shapes.Drawing
+	assert.NoError(t, bare.Unmarshal(data, &decoded))
+	assert.Equal(t, []shapes.Shape{&shapes.Circle{Radius: 1}}, decoded.Shapes)
+}
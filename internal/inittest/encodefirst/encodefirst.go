@@ -0,0 +1,18 @@
+// Package encodefirst marshals and unmarshals shapes.Drawing during package
+// initialization, before registerlater, which imports it, registers its
+// union.
+package encodefirst
+
+import (
+	bare "git.sr.ht/~runxiyu/go-bareish"
+	"git.sr.ht/~runxiyu/go-bareish/internal/inittest/shapes"
+)
+
+// The errors of marshaling and unmarshaling a drawing during initialization.
+var MarshalErr, UnmarshalErr error
+
+func init() {
+	drawing := shapes.Drawing{Shapes: []shapes.Shape{shapes.Circle{Radius: 1}}}
+	_, MarshalErr = bare.Marshal(&drawing)
+	UnmarshalErr = bare.Unmarshal([]byte{0x01, 0x00, 0x01}, &drawing)
+}
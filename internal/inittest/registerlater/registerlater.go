@@ -0,0 +1,15 @@
+// Package registerlater registers the shapes.Shape union. It imports
+// encodefirst, which is therefore initialized first, so the union is
+// registered after encodefirst has used it.
+package registerlater
+
+import (
+	bare "git.sr.ht/~runxiyu/go-bareish"
+	_ "git.sr.ht/~runxiyu/go-bareish/internal/inittest/encodefirst"
+	"git.sr.ht/~runxiyu/go-bareish/internal/inittest/shapes"
+)
+
+func init() {
+	bare.RegisterUnion((*shapes.Shape)(nil)).
+		Member(*new(shapes.Circle), 0)
+}
@@ -0,0 +1,25 @@
+// Package shapes declares a union which is registered by another package, for
+// testing codecs used before their unions are registered.
+package shapes
+
+import bare "git.sr.ht/~runxiyu/go-bareish"
+
+type Shape interface {
+	bare.Union
+}
+
+type Circle struct {
+	Radius uint8
+}
+
+type Square struct {
+	Side uint8
+}
+
+func (Circle) IsUnion() {}
+func (Square) IsUnion() {}
+
+// A message containing the union, whose codec is built on first use.
+type Drawing struct {
+	Shapes []Shape
+}
@@ -2,39 +2,280 @@ package bare
 
 import (
 	"errors"
+	"fmt"
 	"io"
+	"io/ioutil"
+	"sync/atomic"
 )
 
 var (
 	maxUnmarshalBytes uint64 = 1024 * 1024 * 32 /* 32 MiB */
 	maxArrayLength    uint64 = 1024 * 4         /* 4096 elements */
 	maxMapSize        uint64 = 1024
+	maxMarshalBytes   uint64 = 0 /* unlimited */
 )
 
-// MaxUnmarshalBytes sets the maximum size of a message decoded by unmarshal.
-// By default, this is set to 32 MiB.
+const (
+	defaultMaxDepth    uint64 = 1024
+	defaultMaxElements uint64 = 1024 * 1024
+)
+
+// MaxUnmarshalBytes sets the default maximum size of a message decoded by
+// unmarshal. By default, this is set to 32 MiB.
 func MaxUnmarshalBytes(bytes uint64) {
-	maxUnmarshalBytes = bytes
+	atomic.StoreUint64(&maxUnmarshalBytes, bytes)
 }
 
-// MaxArrayLength sets maximum number of elements in array. Defaults to 4096 elements
+// MaxArrayLength sets the default maximum number of elements in array.
+// Defaults to 4096 elements
 func MaxArrayLength(length uint64) {
-	maxArrayLength = length
+	atomic.StoreUint64(&maxArrayLength, length)
 }
 
-// MaxMapSize sets maximum size of map. Defaults to 1024 key/value pairs
+// MaxMapSize sets the default maximum size of map. Defaults to 1024 key/value
+// pairs
 func MaxMapSize(size uint64) {
-	maxMapSize = size
+	atomic.StoreUint64(&maxMapSize, size)
+}
+
+// MaxMarshalBytes sets the default maximum size of a message encoded by
+// marshal. By default, or if set to zero, messages are not limited.
+func MaxMarshalBytes(bytes uint64) {
+	atomic.StoreUint64(&maxMarshalBytes, bytes)
 }
 
-// Use MaxUnmarshalBytes to prevent this error from occuring on messages which
-// are large by design.
+// Use MaxUnmarshalBytes or MaxMarshalBytes to prevent this error from occuring
+// on messages which are large by design.
 var ErrLimitExceeded = errors.New("Maximum message size exceeded")
 
+// Limits applied while decoding a single message. Any limit left at zero is
+// replaced with the package default: MaxUnmarshalBytes, MaxArrayLength and
+// MaxMapSize set the defaults of the corresponding fields, and the remaining
+// fields have fixed defaults documented below.
+//
+// Unlike the package-level setters, options only affect the calls they are
+// passed to, so libraries may tune them without affecting each other.
+type DecodeOptions struct {
+	// Maximum size of a message read from an io.Reader.
+	MaxUnmarshalBytes uint64
+	// Maximum number of elements in a single array.
+	MaxArrayLength uint64
+	// Maximum number of key/value pairs in a single map.
+	MaxMapSize uint64
+	// Maximum length of a single string, in bytes. Defaults to
+	// MaxUnmarshalBytes.
+	MaxStringLength uint64
+	// Maximum nesting depth of structs, arrays, maps, optionals and unions.
+	// Defaults to 1024.
+	MaxDepth uint64
+	// Maximum total number of array elements and map entries allocated for
+	// the whole message. Defaults to 1048576.
+	MaxElements uint64
+	// Unions used to decode union types. Defaults to DefaultRegistry.
+	Registry *Registry
+	// Makes Unmarshal and UnmarshalReader return a TrailingDataError if the
+	// input does not end with the message. UnmarshalPrefix and Decoder, which
+	// expect more data to follow, ignore it.
+	DisallowTrailingData bool
+	// Rejects messages which are valid but not in canonical form: varints
+	// encoded with more bytes than necessary and values of enums (see Enum)
+	// which are not among their values. Implies DisallowTrailingData.
+	//
+	// Bools and optionals other than 0 or 1 and duplicate map keys are
+	// rejected whether or not this is set.
+	Strict bool
+	// Makes data decoded from a byte slice (by Unmarshal, UnmarshalPrefix or
+	// a reader created with NewBytesReader) refer to the slice rather than a
+	// copy of it. The slice must not be modified while such values are in
+	// use.
+	NoCopy bool
+	// Makes strings decoded from a byte slice refer to the slice rather than
+	// a copy of it, using package unsafe. As Go strings are immutable, the
+	// slice must never be modified afterwards.
+	UnsafeStrings bool
+}
+
+func (o DecodeOptions) withDefaults() DecodeOptions {
+	if o.MaxUnmarshalBytes == 0 {
+		o.MaxUnmarshalBytes = atomic.LoadUint64(&maxUnmarshalBytes)
+	}
+	if o.MaxArrayLength == 0 {
+		o.MaxArrayLength = atomic.LoadUint64(&maxArrayLength)
+	}
+	if o.MaxMapSize == 0 {
+		o.MaxMapSize = atomic.LoadUint64(&maxMapSize)
+	}
+	if o.MaxStringLength == 0 {
+		o.MaxStringLength = o.MaxUnmarshalBytes
+	}
+	if o.MaxDepth == 0 {
+		o.MaxDepth = defaultMaxDepth
+	}
+	if o.MaxElements == 0 {
+		o.MaxElements = defaultMaxElements
+	}
+	if o.Registry == nil {
+		o.Registry = DefaultRegistry
+	}
+	return o
+}
+
+// Returns a new BARE primitive reader wrapping the given io.Reader, which
+// applies these options to messages unmarshaled from it.
+func (o DecodeOptions) NewReader(base io.Reader) *Reader {
+	r := NewReader(base)
+	r.opts = o.withDefaults()
+	return r
+}
+
+// Returns a new BARE primitive reader which reads from a byte slice and
+// applies these options to messages unmarshaled from it.
+func (o DecodeOptions) NewBytesReader(data []byte) *Reader {
+	r := NewBytesReader(data)
+	r.opts = o.withDefaults()
+	return r
+}
+
+// Returns a new decoder that reads from r and applies these options to each
+// message.
+func (o DecodeOptions) NewDecoder(r io.Reader) *Decoder {
+	d := NewDecoder(r)
+	d.opts = o
+	return d
+}
+
+// Unmarshals a BARE message into val using these options. See Unmarshal for
+// details.
+func (o DecodeOptions) Unmarshal(data []byte, val interface{}) error {
+	n, err := o.UnmarshalPrefix(data, val)
+	if err == nil && (o.DisallowTrailingData || o.Strict) && n < len(data) {
+		return &TrailingDataError{Offset: int64(n), Bytes: int64(len(data) - n)}
+	}
+	return err
+}
+
+// Unmarshals the BARE message at the start of data into val using these
+// options, and returns its length in bytes. See UnmarshalPrefix for details.
+func (o DecodeOptions) UnmarshalPrefix(data []byte, val interface{}) (int, error) {
+	r := o.NewBytesReader(data)
+	err := UnmarshalBareReader(r, val)
+	return int(r.Offset()), err
+}
+
+// Unmarshals a BARE message into val from a reader using these options. See
+// UnmarshalReader for details.
+func (o DecodeOptions) UnmarshalReader(r io.Reader, val interface{}) error {
+	o = o.withDefaults()
+	lr := newLimitedReader(r, o.MaxUnmarshalBytes)
+	br := o.NewReader(lr)
+	if err := UnmarshalBareReader(br, val); err != nil {
+		return err
+	}
+	if !o.DisallowTrailingData && !o.Strict {
+		return nil
+	}
+	if _, err := lr.R.ReadByte(); err == io.EOF {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	n, _ := io.Copy(ioutil.Discard, io.LimitReader(lr.R, int64(o.MaxUnmarshalBytes)))
+	return &TrailingDataError{Offset: br.Offset(), Bytes: n + 1}
+}
+
+// Accounts for entering a nested aggregate value, enforcing the configured
+// maximum depth. Custom Unmarshalable implementations which may recurse should
+// call Enter before decoding their contents, and Leave once done.
+func (r *Reader) Enter() error {
+	if r.depth >= r.opts.MaxDepth {
+		return fmt.Errorf("Nesting depth exceeds configured limit of %d",
+			r.opts.MaxDepth)
+	}
+	r.depth++
+	return nil
+}
+
+// Accounts for leaving a nested value entered with Enter.
+func (r *Reader) Leave() {
+	r.depth--
+}
+
+// Accounts for entering a nested aggregate value while encoding, enforcing
+// the configured maximum depth, so that values which refer to themselves
+// through pointers fail to encode rather than recursing forever. Custom
+// Marshalable implementations which may recurse should call Enter before
+// encoding their contents, and Leave once done.
+func (w *Writer) Enter() error {
+	max := w.opts.MaxDepth
+	if max == 0 {
+		max = defaultMaxDepth
+	}
+	if w.depth >= max {
+		return fmt.Errorf("Nesting depth exceeds configured limit of %d", max)
+	}
+	w.depth++
+	return nil
+}
+
+// Accounts for leaving a nested value entered with Enter.
+func (w *Writer) Leave() {
+	w.depth--
+}
+
+// Reads the length of an array, enforcing the configured limits.
+func (r *Reader) ReadArrayLength() (uint64, error) {
+	len, err := r.ReadUint()
+	if err != nil {
+		return 0, err
+	}
+	if len > r.opts.MaxArrayLength {
+		return 0, fmt.Errorf("Array length %d exceeds configured limit of %d",
+			len, r.opts.MaxArrayLength)
+	}
+	return len, r.Allocate(len)
+}
+
+// Reads the size of a map, enforcing the configured limits.
+func (r *Reader) ReadMapSize() (uint64, error) {
+	size, err := r.ReadUint()
+	if err != nil {
+		return 0, err
+	}
+	if size > r.opts.MaxMapSize {
+		return 0, fmt.Errorf("Map size %d exceeds configured limit of %d",
+			size, r.opts.MaxMapSize)
+	}
+	return size, r.Allocate(size)
+}
+
+// Starts a new message, whose array elements and map entries are counted
+// against MaxElements separately from those of earlier messages. It does
+// nothing while inside a nested value (see Enter), as the message is then part
+// of an enclosing one. UnmarshalBareReader calls it for each message; other
+// decoders reading several messages from one reader should too.
+func (r *Reader) BeginMessage() {
+	if r.depth == 0 {
+		r.elements = 0
+	}
+}
+
+// Accounts for n elements allocated for an array or map, enforcing
+// MaxElements. ReadArrayLength and ReadMapSize call it for the elements they
+// read the number of; decoders of fixed-length arrays should call it for
+// theirs.
+func (r *Reader) Allocate(n uint64) error {
+	r.elements += n
+	if r.elements > r.opts.MaxElements {
+		return fmt.Errorf("Total element count exceeds configured limit of %d",
+			r.opts.MaxElements)
+	}
+	return nil
+}
+
 // Identical to io.LimitedReader, except it returns our custom error instead of
 // EOF if the limit is reached.
 type limitedReader struct {
-	R io.Reader
+	R byteReader
 	N uint64
 }
 
@@ -50,6 +291,21 @@ func (l *limitedReader) Read(p []byte) (n int, err error) {
 	return
 }
 
-func newLimitedReader(r io.Reader) *limitedReader {
-	return &limitedReader{r, maxUnmarshalBytes}
+func (l *limitedReader) ReadByte() (byte, error) {
+	if l.N <= 0 {
+		return 0, ErrLimitExceeded
+	}
+	b, err := l.R.ReadByte()
+	if err == nil {
+		l.N--
+	}
+	return b, err
+}
+
+func newLimitedReader(r io.Reader, n uint64) *limitedReader {
+	br, ok := r.(byteReader)
+	if !ok {
+		br = &simpleByteReader{Reader: r}
+	}
+	return &limitedReader{br, n}
 }
@@ -0,0 +1,98 @@
+package bare
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeOptionsArrayLength(t *testing.T) {
+	var val []uint8
+	payload := []byte{0x04, 0x11, 0x22, 0x33, 0x44}
+
+	opts := DecodeOptions{MaxArrayLength: 2}
+	err := opts.Unmarshal(payload, &val)
+	assert.EqualError(t, errors.Unwrap(err), "Array length 4 exceeds configured limit of 2")
+
+	opts = DecodeOptions{MaxArrayLength: 4}
+	err = opts.Unmarshal(payload, &val)
+	assert.Nil(t, err)
+	assert.Equal(t, []uint8{0x11, 0x22, 0x33, 0x44}, val)
+}
+
+func TestDecodeOptionsMapSize(t *testing.T) {
+	var val map[uint8]uint8
+	opts := DecodeOptions{MaxMapSize: 1}
+	err := opts.Unmarshal([]byte{0x02, 0x01, 0x11, 0x02, 0x22}, &val)
+	assert.EqualError(t, errors.Unwrap(err), "Map size 2 exceeds configured limit of 1")
+}
+
+func TestDecodeOptionsStringLength(t *testing.T) {
+	var val string
+	payload := []byte{0x04, 0x4d, 0x61, 0x72, 0x79}
+
+	opts := DecodeOptions{MaxStringLength: 3}
+	err := opts.Unmarshal(payload, &val)
+	assert.EqualError(t, errors.Unwrap(err), "String length 4 exceeds configured limit of 3")
+
+	opts = DecodeOptions{MaxStringLength: 4}
+	err = opts.Unmarshal(payload, &val)
+	assert.Nil(t, err)
+	assert.Equal(t, "Mary", val)
+}
+
+func TestDecodeOptionsDepth(t *testing.T) {
+	var val [][]int8
+	payload := []byte{0x01, 0x01, 0x42}
+
+	opts := DecodeOptions{MaxDepth: 1}
+	err := opts.Unmarshal(payload, &val)
+	assert.EqualError(t, errors.Unwrap(err), "Nesting depth exceeds configured limit of 1")
+
+	opts = DecodeOptions{MaxDepth: 2}
+	err = opts.Unmarshal(payload, &val)
+	assert.Nil(t, err)
+	assert.Equal(t, [][]int8{{0x42}}, val)
+
+	// Failing to enter a value does not count towards the depth
+	r := DecodeOptions{MaxDepth: 1}.NewBytesReader(nil)
+	assert.Nil(t, r.Enter())
+	assert.NotNil(t, r.Enter())
+	r.Leave()
+	assert.Nil(t, r.Enter())
+}
+
+func TestDecodeOptionsElements(t *testing.T) {
+	var val [][]int8
+	payload := []byte{0x02, 0x01, 0x11, 0x01, 0x22}
+
+	opts := DecodeOptions{MaxElements: 3}
+	err := opts.Unmarshal(payload, &val)
+	assert.EqualError(t, errors.Unwrap(err), "Total element count exceeds configured limit of 3")
+
+	opts = DecodeOptions{MaxElements: 4}
+	err = opts.Unmarshal(payload, &val)
+	assert.Nil(t, err)
+
+	// The count is reset for each message read from the same reader
+	r := opts.NewReader(bytes.NewReader(append(payload, payload...)))
+	for x := 0; x < 2; x++ {
+		err = UnmarshalBareReader(r, &val)
+		assert.Nil(t, err)
+	}
+}
+
+func TestDecodeOptionsUnmarshalBytes(t *testing.T) {
+	var val uint64
+	payload := []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08}
+
+	opts := DecodeOptions{MaxUnmarshalBytes: 4}
+	err := opts.UnmarshalReader(bytes.NewReader(payload), &val)
+	assert.True(t, errors.Is(err, ErrLimitExceeded))
+
+	dec := opts.NewDecoder(bytes.NewReader(payload))
+	err = dec.Decode(&val)
+	assert.True(t, errors.Is(err, ErrLimitExceeded))
+}
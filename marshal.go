@@ -1,11 +1,11 @@
 package bare
 
 import (
-	"bytes"
 	"errors"
 	"fmt"
 	"reflect"
 	"sync"
+	"sync/atomic"
 )
 
 // A type which implements this interface will be responsible for marshaling
@@ -16,9 +16,8 @@ type Marshalable interface {
 
 var encoderBufferPool = sync.Pool{
 	New: func() interface{} {
-		buf := &bytes.Buffer{}
-		buf.Grow(32)
-		return buf
+		buf := make([]byte, 0, 32)
+		return &buf
 	},
 }
 
@@ -28,21 +27,67 @@ var encoderBufferPool = sync.Pool{
 // stored under the "bare" key in the struct field's tag.
 //
 // As a special case, if the field tag is "-", the field is always omitted.
+//
+// Use EncodeOptions to encode messages in canonical form.
 func Marshal(val interface{}) ([]byte, error) {
-	// reuse buffers from previous serializations
-	b := encoderBufferPool.Get().(*bytes.Buffer)
-	defer func() {
-		b.Reset()
-		encoderBufferPool.Put(b)
-	}()
+	return EncodeOptions{}.Marshal(val)
+}
+
+// Appends the BARE encoding of a value (val, which must be a pointer) to dst
+// and returns the extended slice, which is only reallocated if dst lacks the
+// capacity. On error, dst is returned as it was. See Marshal for details.
+func AppendMarshal(dst []byte, val interface{}) ([]byte, error) {
+	return EncodeOptions{}.AppendMarshal(dst, val)
+}
+
+// Returns the length of the BARE encoding of a value (val, which must be a
+// pointer), as Marshal would encode it, without encoding it. Custom
+// Marshalable types are asked to write themselves, and their output is
+// counted.
+func EncodedSize(val interface{}) (int, error) {
+	return EncodeOptions{}.EncodedSize(val)
+}
+
+// Writes the BARE encoding of a value (val, which must be a pointer) to the
+// start of buf and returns its length. If the message does not fit, an error
+// wrapping io.ErrShortBuffer is returned. See Marshal for details.
+func MarshalTo(buf []byte, val interface{}) (int, error) {
+	return EncodeOptions{}.MarshalTo(buf, val)
+}
+
+// Writers used by marshalPooled, which would otherwise be its only allocation
+var bytesWriterPool = sync.Pool{
+	New: func() interface{} {
+		return &Writer{}
+	},
+}
 
-	w := NewWriter(b)
+// Marshals val with a pooled writer set to init, and returns its output and the
+// number of bytes written.
+func marshalPooled(init Writer, val interface{}) ([]byte, int64, error) {
+	w := bytesWriterPool.Get().(*Writer)
+	*w = init
 	err := MarshalWriter(w, val)
+	buf, n := w.buf, w.written
+	*w = Writer{}
+	bytesWriterPool.Put(w)
+	return buf, n, err
+}
+
+func marshal(opts EncodeOptions, val interface{}) ([]byte, error) {
+	// reuse buffers from previous serializations
+	bp := encoderBufferPool.Get().(*[]byte)
+	defer encoderBufferPool.Put(bp)
 
-	msg := make([]byte, b.Len())
-	copy(msg, b.Bytes())
+	buf, err := opts.AppendMarshal((*bp)[:0], val)
+	*bp = buf[:0]
+	if err != nil {
+		return nil, err
+	}
 
-	return msg, err
+	msg := make([]byte, len(buf))
+	copy(msg, buf)
+	return msg, nil
 }
 
 // Marshals a value (val, which must be a pointer) into a BARE message and
@@ -54,27 +99,89 @@ func MarshalWriter(w *Writer, val interface{}) error {
 		return errors.New("Expected val to be pointer type")
 	}
 
-	return getEncoder(t.Elem())(w, v.Elem())
+	max := w.opts.MaxMarshalBytes
+	if max == 0 {
+		max = atomic.LoadUint64(&maxMarshalBytes)
+	}
+	// The limit applies to the whole message, when nested in a custom
+	// Marshalable too
+	if max != 0 && w.limit == 0 {
+		w.limit = w.written + int64(max)
+		defer func() { w.limit = 0 }()
+	}
+
+	if err := getEncoder(t.Elem())(w, v.Elem()); err != nil {
+		return wrapEncodeError(err, rootSegment(t.Elem()), t.Elem())
+	}
+	return nil
 }
 
-type encodeFunc func(w *Writer, v reflect.Value) error
+// Encodes a value of a given type, such as a codec given to RegisterCodec. v
+// may not be addressable.
+type EncodeFunc func(w *Writer, v reflect.Value) error
 
-var encodeFuncCache sync.Map // map[reflect.Type]encodeFunc
+var encodeFuncCache sync.Map // map[reflect.Type]EncodeFunc
 
-// get decoder from cache
-func getEncoder(t reflect.Type) encodeFunc {
+// get encoder from cache
+func getEncoder(t reflect.Type) EncodeFunc {
 	if f, ok := encodeFuncCache.Load(t); ok {
-		return f.(encodeFunc)
+		return f.(EncodeFunc)
 	}
 
-	f := encoderFunc(t)
+	// Recursive types refer back to themselves while their encoder is being
+	// built. Store an indirect encoder which waits for the real one, so that
+	// such references terminate.
+	var (
+		wg sync.WaitGroup
+		f  EncodeFunc
+	)
+	wg.Add(1)
+	fi, loaded := encodeFuncCache.LoadOrStore(t,
+		EncodeFunc(func(w *Writer, v reflect.Value) error {
+			wg.Wait()
+			return f(w, v)
+		}))
+	if loaded {
+		return fi.(EncodeFunc)
+	}
+
+	defer func() {
+		if f == nil {
+			// Building the encoder panicked: fail the encoders already
+			// referring to it rather than leaving them waiting, and let the
+			// next caller try again
+			f = func(w *Writer, v reflect.Value) error {
+				return fmt.Errorf("Encoder for type %s could not be built", t)
+			}
+			encodeFuncCache.Delete(t)
+		}
+		wg.Done()
+	}()
+	if f = encoderFunc(t); f == nil {
+		panic(fmt.Errorf("No encoder for type %s", t))
+	}
 	encodeFuncCache.Store(t, f)
 	return f
 }
 
-var marshalableInterface = reflect.TypeOf((*Unmarshalable)(nil)).Elem()
+var marshalableInterface = reflect.TypeOf((*Marshalable)(nil)).Elem()
+
+// Reports whether a slice or array type is data: its elements are u8 values
+// without a custom encoding, which are read and written all at once.
+func isData(t reflect.Type) bool {
+	elem := t.Elem()
+	_, custom := CodecFor(elem)
+	return elem.Kind() == reflect.Uint8 && !custom &&
+		!reflect.PtrTo(elem).Implements(marshalableInterface) &&
+		!reflect.PtrTo(elem).Implements(unmarshalableInterface) &&
+		!elem.Implements(enumInterface)
+}
+
+func encoderFunc(t reflect.Type) EncodeFunc {
+	if c, ok := CodecFor(t); ok {
+		return c.encode
+	}
 
-func encoderFunc(t reflect.Type) encodeFunc {
 	if reflect.PtrTo(t).Implements(marshalableInterface) {
 		return func(w *Writer, v reflect.Value) error {
 			uv := v.Addr().Interface().(Marshalable)
@@ -92,12 +199,21 @@ func encoderFunc(t reflect.Type) encodeFunc {
 	case reflect.Struct:
 		return encodeStruct(t)
 	case reflect.Array:
+		if isData(t) {
+			return encodeDataArray(t)
+		}
 		return encodeArray(t)
 	case reflect.Slice:
+		if isData(t) {
+			return encodeData
+		}
 		return encodeSlice(t)
 	case reflect.Map:
 		return encodeMap(t)
 	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if t.Implements(enumInterface) {
+			return encodeEnum
+		}
 		return encodeUint
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
 		return encodeInt
@@ -114,8 +230,13 @@ func encoderFunc(t reflect.Type) encodeFunc {
 	}
 }
 
-func encodeOptional(t reflect.Type) encodeFunc {
+func encodeOptional(t reflect.Type) EncodeFunc {
 	return func(w *Writer, v reflect.Value) error {
+		if err := w.Enter(); err != nil {
+			return err
+		}
+		defer w.Leave()
+
 		if v.IsNil() {
 			return w.WriteBool(false)
 		}
@@ -124,68 +245,107 @@ func encodeOptional(t reflect.Type) encodeFunc {
 			return err
 		}
 
-		return getEncoder(t)(w, v.Elem())
+		if err := getEncoder(t)(w, v.Elem()); err != nil {
+			return wrapEncodeError(err, "", t)
+		}
+		return nil
 	}
 }
 
-func encodeStruct(t reflect.Type) encodeFunc {
+func encodeStruct(t reflect.Type) EncodeFunc {
 	n := t.NumField()
-	encoders := make([]encodeFunc, n)
+	encoders := make([]EncodeFunc, n)
+	segments := make([]string, n)
 	for i := 0; i < n; i++ {
 		field := t.Field(i)
 		if field.Tag.Get("bare") == "-" {
 			continue
 		}
 		encoders[i] = getEncoder(field.Type)
+		segments[i] = fieldSegment(field)
 	}
 
 	return func(w *Writer, v reflect.Value) error {
+		if err := w.Enter(); err != nil {
+			return err
+		}
+		defer w.Leave()
+
 		for i := 0; i < n; i++ {
 			if encoders[i] == nil {
 				continue
 			}
 			err := encoders[i](w, v.Field(i))
 			if err != nil {
-				return err
+				return wrapEncodeError(err, segments[i], t.Field(i).Type)
 			}
 		}
 		return nil
 	}
 }
 
-func encodeArray(t reflect.Type) encodeFunc {
-	f := getEncoder(t.Elem())
+func encodeArray(t reflect.Type) EncodeFunc {
+	elem := t.Elem()
+	f := getEncoder(elem)
 	len := t.Len()
 
 	return func(w *Writer, v reflect.Value) error {
+		if err := w.Enter(); err != nil {
+			return err
+		}
+		defer w.Leave()
+
 		for i := 0; i < len; i++ {
 			if err := f(w, v.Index(i)); err != nil {
-				return err
+				return wrapEncodeError(err, indexSegment(i), elem)
 			}
 		}
 		return nil
 	}
 }
 
-func encodeSlice(t reflect.Type) encodeFunc {
+func encodeSlice(t reflect.Type) EncodeFunc {
 	elem := t.Elem()
 	f := getEncoder(elem)
 
 	return func(w *Writer, v reflect.Value) error {
+		if err := w.Enter(); err != nil {
+			return err
+		}
+		defer w.Leave()
+
 		if err := w.WriteUint(uint64(v.Len())); err != nil {
 			return err
 		}
 
 		for i := 0; i < v.Len(); i++ {
 			if err := f(w, v.Index(i)); err != nil {
-				return err
+				return wrapEncodeError(err, indexSegment(i), elem)
 			}
 		}
 		return nil
 	}
 }
 
-func encodeMap(t reflect.Type) encodeFunc {
+// Encodes a slice of bytes all at once.
+func encodeData(w *Writer, v reflect.Value) error {
+	return w.WriteData(v.Bytes())
+}
+
+// Encodes an array of bytes all at once.
+func encodeDataArray(t reflect.Type) EncodeFunc {
+	return func(w *Writer, v reflect.Value) error {
+		if !v.CanAddr() {
+			// Only addressable arrays can be sliced, e.g. not map values
+			addr := reflect.New(t).Elem()
+			addr.Set(v)
+			v = addr
+		}
+		return w.WriteDataFixed(v.Slice(0, v.Len()).Bytes())
+	}
+}
+
+func encodeMap(t reflect.Type) EncodeFunc {
 	keyType := t.Key()
 	keyf := getEncoder(keyType)
 
@@ -193,53 +353,79 @@ func encodeMap(t reflect.Type) encodeFunc {
 	valf := getEncoder(valueType)
 
 	return func(w *Writer, v reflect.Value) error {
+		if err := w.Enter(); err != nil {
+			return err
+		}
+		defer w.Leave()
+
 		if err := w.WriteUint(uint64(v.Len())); err != nil {
 			return err
 		}
 
+		if w.opts.Canonical {
+			keys, err := sortedMapKeys(v)
+			if err != nil {
+				return err
+			}
+			for _, key := range keys {
+				if err := keyf(w, key); err != nil {
+					return wrapEncodeError(err, keySegment(key), keyType)
+				}
+				if err := valf(w, v.MapIndex(key)); err != nil {
+					return wrapEncodeError(err, keySegment(key), valueType)
+				}
+			}
+			return nil
+		}
+
 		iter := v.MapRange()
 		for iter.Next() {
 			if err := keyf(w, iter.Key()); err != nil {
-				return err
+				return wrapEncodeError(err, keySegment(iter.Key()), keyType)
 			}
 			if err := valf(w, iter.Value()); err != nil {
-				return err
+				return wrapEncodeError(err, keySegment(iter.Key()), valueType)
 			}
 		}
 		return nil
 	}
 }
 
-func encodeUnion(t reflect.Type) encodeFunc {
-	ut, ok := unionRegistry[t]
-	if !ok {
-		return func(w *Writer, v reflect.Value) error {
-			return fmt.Errorf("Union type %s is not registered", t.Name())
+// Union members are looked up in the registry of the writer on each call, so
+// that unions registered after the encoder was built are encoded too.
+func encodeUnion(t reflect.Type) EncodeFunc {
+	return func(w *Writer, v reflect.Value) error {
+		if err := w.Enter(); err != nil {
+			return err
 		}
-	}
-
-	encoders := make(map[uint64]encodeFunc)
-	for tag, t := range ut.types {
-		encoders[tag] = getEncoder(t)
-	}
+		defer w.Leave()
 
-	return func(w *Writer, v reflect.Value) error {
+		ut, ok := registryOr(w.opts.Registry).UnionFor(t)
+		if !ok {
+			return fmt.Errorf("Union type %s is not registered", t.Name())
+		}
+		if v.IsNil() {
+			return fmt.Errorf("Nil value for union type %s", t.Name())
+		}
 		t := v.Elem().Type()
 		if t.Kind() == reflect.Ptr {
 			// If T is a valid union value type, *T is valid too.
 			t = t.Elem()
 			v = v.Elem()
 		}
-		tag, ok := ut.tags[t]
+		tag, ok := ut.tagOf(t)
 		if !ok {
-			return fmt.Errorf("Invalid union value: %s", v.Elem().String())
+			return fmt.Errorf("Invalid union value: %s", v.Elem().Type())
 		}
 
 		if err := w.WriteUint(tag); err != nil {
 			return err
 		}
 
-		return encoders[tag](w, v.Elem())
+		if err := getEncoder(t)(w, v.Elem()); err != nil {
+			return wrapEncodeError(err, unionSegment(t), t)
+		}
+		return nil
 	}
 }
 
@@ -264,6 +450,13 @@ func encodeUint(w *Writer, v reflect.Value) error {
 	panic("not uint")
 }
 
+func encodeEnum(w *Writer, v reflect.Value) error {
+	if err := w.CheckEnum(v.Interface().(Enum)); err != nil {
+		return err
+	}
+	return encodeUint(w, v)
+}
+
 func encodeInt(w *Writer, v reflect.Value) error {
 	switch getIntKind(v.Type()) {
 	case reflect.Int:
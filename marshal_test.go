@@ -1,7 +1,10 @@
 package bare
 
 import (
+	"bytes"
+	"errors"
 	"io"
+	"math"
 	"reflect"
 	"testing"
 
@@ -324,3 +327,202 @@ func TestStream(t *testing.T) {
 		assert.Equal(t, x, int(newAge))
 	}
 }
+
+type Node struct {
+	Value    uint8
+	Children []Node
+	Next     *Node
+}
+
+func TestMarshalRecursive(t *testing.T) {
+	val := Node{
+		Value: 1,
+		Children: []Node{
+			{Value: 2},
+			{Value: 3, Next: &Node{Value: 4}},
+		},
+	}
+	data, err := Marshal(&val)
+	assert.Nil(t, err)
+	reference := []byte{
+		0x01, 0x02,
+		0x02, 0x00, 0x00,
+		0x03, 0x00, 0x01,
+		0x04, 0x00, 0x00,
+		0x00,
+	}
+	assert.Equal(t, reference, data)
+}
+
+func TestMarshalCyclic(t *testing.T) {
+	val := Node{Value: 1}
+	val.Next = &val
+	_, err := Marshal(&val)
+	var ee *EncodeError
+	assert.True(t, errors.As(err, &ee))
+	assert.EqualError(t, ee.Err, "Nesting depth exceeds configured limit of 1024")
+
+	val.Next = &Node{Value: 2}
+	_, err = EncodeOptions{MaxDepth: 2}.Marshal(&val)
+	assert.EqualError(t, errors.Unwrap(err), "Nesting depth exceeds configured limit of 2")
+	_, err = EncodeOptions{MaxDepth: 4}.Marshal(&val)
+	assert.Nil(t, err)
+}
+
+func TestBuildPanics(t *testing.T) {
+	type broken struct{}
+	type holder struct{ B broken }
+	// A codec without functions, which RegisterCodec rejects, makes building
+	// the codecs of both types panic
+	codecs.Store(reflect.TypeOf(broken{}), &Codec{t: reflect.TypeOf(broken{})})
+
+	// The codecs of both types are built again, rather than waiting for the
+	// ones which failed
+	for i := 0; i < 2; i++ {
+		assert.Panics(t, func() { Marshal(&holder{}) })
+		assert.Panics(t, func() { Unmarshal([]byte{}, &holder{}) })
+	}
+}
+
+func TestAppendMarshal(t *testing.T) {
+	type Coordinates struct {
+		X, Y, Z uint
+		Name    string
+	}
+	coords := Coordinates{1, 2, 3, "up"}
+
+	frame := []byte{0xFF}
+	frame, err := AppendMarshal(frame, &coords)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0xFF, 0x01, 0x02, 0x03, 0x02, 'u', 'p'}, frame)
+
+	// Nothing is appended on error
+	var f float32 = float32(math.NaN())
+	frame, err = AppendMarshal(frame, &f)
+	assert.NotNil(t, err)
+	assert.Equal(t, 7, len(frame))
+
+	buf := make([]byte, 0, 64)
+	allocs := testing.AllocsPerRun(16, func() {
+		_, err = AppendMarshal(buf, &coords)
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 0.0, allocs)
+}
+
+func TestMarshalTo(t *testing.T) {
+	type Coordinates struct{ X, Y, Z uint }
+	coords := Coordinates{1, 2, 300}
+
+	buf := make([]byte, 8)
+	n, err := MarshalTo(buf, &coords)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, n)
+	assert.Equal(t, []byte{0x01, 0x02, 0xAC, 0x02}, buf[:n])
+
+	n, err = MarshalTo(buf[:3], &coords)
+	assert.True(t, errors.Is(err, io.ErrShortBuffer))
+	assert.Equal(t, 0, n)
+	// The rest of buf is left alone, even if it has the capacity
+	assert.Equal(t, []byte{0x01, 0x02, 0xAC, 0x02}, buf[:4])
+
+	str := "hello"
+	_, err = MarshalTo(buf[:5], &str)
+	assert.True(t, errors.Is(err, io.ErrShortBuffer))
+}
+
+func TestEncodedSize(t *testing.T) {
+	type Record struct {
+		ID      uint
+		Name    string
+		Tags    map[string]int16
+		Person  NameAge
+		Custom  Custom
+		Skipped string `bare:"-"`
+		Parent  *Record
+	}
+	values := []interface{}{
+		new(uint8),
+		new(Uint),
+		&Record{Person: Name("")},
+		&Record{
+			ID:     300,
+			Name:   "こんにちは",
+			Tags:   map[string]int16{"a": 1, "bb": -2},
+			Person: Age(42),
+			Custom: 1,
+			Parent: &Record{Person: Name("Mary")},
+		},
+	}
+	for _, val := range values {
+		data, err := Marshal(val)
+		assert.Nil(t, err)
+		size, err := EncodedSize(val)
+		assert.Nil(t, err)
+		assert.Equal(t, len(data), size)
+	}
+
+	var f float32 = float32(math.NaN())
+	_, err := EncodedSize(&f)
+	assert.NotNil(t, err)
+}
+
+func TestMaxMarshalBytes(t *testing.T) {
+	str := "hello"
+	opts := EncodeOptions{MaxMarshalBytes: 5}
+	_, err := opts.Marshal(&str)
+	assert.True(t, errors.Is(err, ErrLimitExceeded))
+	_, err = opts.EncodedSize(&str)
+	assert.True(t, errors.Is(err, ErrLimitExceeded))
+
+	opts.MaxMarshalBytes = 6
+	data, err := opts.Marshal(&str)
+	assert.Nil(t, err)
+	assert.Equal(t, 6, len(data))
+
+	// Nothing past the limit is written, and it applies to each message
+	var buf bytes.Buffer
+	enc := EncodeOptions{MaxMarshalBytes: 4}.NewEncoder(&buf)
+	assert.Nil(t, enc.Encode(new(uint32)))
+	assert.Nil(t, enc.Encode(new(uint32)))
+	assert.True(t, errors.Is(enc.Encode(&str), ErrLimitExceeded))
+	assert.Equal(t, 9, buf.Len())
+
+	MaxMarshalBytes(3)
+	defer MaxMarshalBytes(0)
+	_, err = Marshal(new(uint32))
+	assert.True(t, errors.Is(err, ErrLimitExceeded))
+}
+
+func TestMarshalData(t *testing.T) {
+	type octet uint8
+	type Key [4]byte
+	type Blob []octet
+	type Message struct {
+		Key   Key
+		Keys  map[string]Key
+		Blob  Blob
+		Bytes [2]octet
+	}
+
+	msg := Message{
+		Key:   Key{1, 2, 3, 4},
+		Keys:  map[string]Key{"a": {5, 6, 7, 8}},
+		Blob:  Blob{9, 10},
+		Bytes: [2]octet{11, 12},
+	}
+	reference := []byte{
+		0x01, 0x02, 0x03, 0x04,
+		0x01, 0x01, 'a', 0x05, 0x06, 0x07, 0x08,
+		0x02, 0x09, 0x0A,
+		0x0B, 0x0C,
+	}
+	data, err := Marshal(&msg)
+	assert.Nil(t, err)
+	assert.Equal(t, reference, data)
+
+	var decoded Message
+	err = Unmarshal(data, &decoded)
+	assert.Nil(t, err)
+	assert.Equal(t, msg, decoded)
+}
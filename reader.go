@@ -2,12 +2,16 @@ package bare
 
 import (
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"math"
 	"unicode/utf8"
+	"unsafe"
 )
 
+var errOverflow = errors.New("Varint overflows a 64-bit integer")
+
 type byteReader interface {
 	io.Reader
 	io.ByteReader
@@ -15,8 +19,20 @@ type byteReader interface {
 
 // A Reader for BARE primitive types.
 type Reader struct {
-	base    byteReader
+	base    *countingReader
 	scratch [8]byte
+	// Storage for base and the byte reader it wraps, so that Reset does not
+	// allocate
+	counting countingReader
+	simple   simpleByteReader
+	// The input of readers created with NewBytesReader, which have no base,
+	// and the offset of the next byte to be read from it
+	data []byte
+	pos  int
+
+	opts     DecodeOptions
+	depth    uint64
+	elements uint64
 }
 
 type simpleByteReader struct {
@@ -24,90 +40,214 @@ type simpleByteReader struct {
 	scratch [1]byte
 }
 
-func (r simpleByteReader) ReadByte() (byte, error) {
-	// using reference type here saves us allocations
-	_, err := r.Read(r.scratch[:])
+func (r *simpleByteReader) ReadByte() (byte, error) {
+	// using a pointer receiver, the scratch buffer does not escape to the
+	// heap on each call
+	_, err := io.ReadFull(r.Reader, r.scratch[:])
 	return r.scratch[0], err
 }
 
+// Counts the number of bytes consumed from the underlying reader.
+type countingReader struct {
+	byteReader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.byteReader.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *countingReader) ReadByte() (byte, error) {
+	b, err := c.byteReader.ReadByte()
+	if err == nil {
+		c.n++
+	}
+	return b, err
+}
+
 // Returns a new BARE primitive reader wrapping the given io.Reader.
 func NewReader(base io.Reader) *Reader {
+	r := &Reader{opts: DecodeOptions{}.withDefaults()}
+	r.Reset(base)
+	return r
+}
+
+// Returns a new BARE primitive reader which reads from a byte slice. Reading
+// from a slice avoids the overhead of an io.Reader, and allows decoded values
+// to alias the slice; see DecodeOptions.NoCopy.
+func NewBytesReader(data []byte) *Reader {
+	return &Reader{
+		data: data,
+		opts: DecodeOptions{}.withDefaults(),
+	}
+}
+
+// Makes the reader read from base, from offset zero, keeping its options.
+func (r *Reader) Reset(base io.Reader) {
+	*r = Reader{opts: r.opts}
 	br, ok := base.(byteReader)
 	if !ok {
-		br = simpleByteReader{Reader: base}
+		r.simple.Reader = base
+		br = &r.simple
 	}
-	return &Reader{base: br}
+	r.counting.byteReader = br
+	r.base = &r.counting
 }
 
-func (r *Reader) ReadUint() (uint64, error) {
-	x, err := binary.ReadUvarint(r.base)
+// Makes the reader read from a byte slice, from offset zero, keeping its
+// options. See NewBytesReader.
+func (r *Reader) ResetBytes(data []byte) {
+	*r = Reader{
+		data: data,
+		opts: r.opts,
+	}
+}
+
+// Returns the number of bytes read from the underlying reader so far.
+func (r *Reader) Offset() int64 {
+	if r.base == nil {
+		return int64(r.pos)
+	}
+	return r.base.n
+}
+
+// Consumes the next n bytes of the input of a reader created with
+// NewBytesReader, returning them without copying. Like io.ReadFull, it
+// returns io.EOF if the input has ended, or io.ErrUnexpectedEOF if it ends
+// part way through.
+func (r *Reader) take(n uint64) ([]byte, error) {
+	if rem := uint64(len(r.data) - r.pos); n > rem {
+		r.pos = len(r.data)
+		if rem == 0 {
+			return nil, io.EOF
+		}
+		return nil, io.ErrUnexpectedEOF
+	}
+	end := r.pos + int(n)
+	b := r.data[r.pos:end:end]
+	r.pos = end
+	return b, nil
+}
+
+// Returns the next n bytes of input, which may be no more than the size of the
+// scratch buffer. The result is only valid until the next read.
+func (r *Reader) fixed(n int) ([]byte, error) {
+	if r.base == nil {
+		return r.take(uint64(n))
+	}
+	_, err := io.ReadAtLeast(r.base, r.scratch[:n], n)
+	return r.scratch[:n], err
+}
+
+func (r *Reader) readByte() (byte, error) {
+	if r.base != nil {
+		return r.base.ReadByte()
+	}
+	if r.pos >= len(r.data) {
+		return 0, io.EOF
+	}
+	b := r.data[r.pos]
+	r.pos++
+	return b, nil
+}
+
+// Reads an unsigned varint, which must be minimally encoded in strict mode.
+func (r *Reader) readUvarint() (uint64, error) {
+	var (
+		x     uint64
+		err   error
+		start = r.Offset()
+	)
+	if r.base == nil {
+		var n int
+		x, n = binary.Uvarint(r.data[r.pos:])
+		switch {
+		case n > 0:
+			r.pos += n
+		case n < 0:
+			r.pos -= n
+			err = errOverflow
+		case r.pos == len(r.data):
+			err = io.EOF
+		default:
+			r.pos = len(r.data)
+			err = io.ErrUnexpectedEOF
+		}
+	} else {
+		x, err = binary.ReadUvarint(r.base)
+	}
 	if err != nil {
 		return x, err
 	}
+	if r.opts.Strict && r.Offset()-start != int64(uvarintLen(x)) {
+		return 0, ErrNonCanonical
+	}
 	return x, nil
 }
 
+func (r *Reader) ReadUint() (uint64, error) {
+	return r.readUvarint()
+}
+
 func (r *Reader) ReadU8() (uint8, error) {
-	return r.base.ReadByte()
+	return r.readByte()
 }
 
 func (r *Reader) ReadU16() (uint16, error) {
-	var i uint16
-	if _, err := io.ReadAtLeast(r.base, r.scratch[:2], 2); err != nil {
-		return i, err
+	b, err := r.fixed(2)
+	if err != nil {
+		return 0, err
 	}
-	return binary.LittleEndian.Uint16(r.scratch[:]), nil
+	return binary.LittleEndian.Uint16(b), nil
 }
 
 func (r *Reader) ReadU32() (uint32, error) {
-	var i uint32
-	if _, err := io.ReadAtLeast(r.base, r.scratch[:4], 4); err != nil {
-		return i, err
+	b, err := r.fixed(4)
+	if err != nil {
+		return 0, err
 	}
-	return binary.LittleEndian.Uint32(r.scratch[:]), nil
+	return binary.LittleEndian.Uint32(b), nil
 }
 
 func (r *Reader) ReadU64() (uint64, error) {
-	var i uint64
-	if _, err := io.ReadAtLeast(r.base, r.scratch[:8], 8); err != nil {
-		return i, err
+	b, err := r.fixed(8)
+	if err != nil {
+		return 0, err
 	}
-	return binary.LittleEndian.Uint64(r.scratch[:]), nil
+	return binary.LittleEndian.Uint64(b), nil
 }
 
 func (r *Reader) ReadInt() (int64, error) {
-	return binary.ReadVarint(r.base)
+	// Signed varints are zig-zag encoded unsigned varints
+	ux, err := r.readUvarint()
+	x := int64(ux >> 1)
+	if ux&1 != 0 {
+		x = ^x
+	}
+	return x, err
 }
 
 func (r *Reader) ReadI8() (int8, error) {
-	b, err := r.base.ReadByte()
+	b, err := r.readByte()
 	return int8(b), err
 }
 
 func (r *Reader) ReadI16() (int16, error) {
-	var i int16
-	if _, err := io.ReadAtLeast(r.base, r.scratch[:2], 2); err != nil {
-		return i, err
-	}
-	return int16(binary.LittleEndian.Uint16(r.scratch[:])), nil
+	u, err := r.ReadU16()
+	return int16(u), err
 }
 
 func (r *Reader) ReadI32() (int32, error) {
-	var i int32
-	if _, err := io.ReadAtLeast(r.base, r.scratch[:4], 4); err != nil {
-		return i, err
-	}
-	return int32(binary.LittleEndian.Uint32(r.scratch[:])), nil
+	u, err := r.ReadU32()
+	return int32(u), err
 }
 
 func (r *Reader) ReadI64() (int64, error) {
-	var i int64
-	if _, err := io.ReadAtLeast(r.base, r.scratch[:], 8); err != nil {
-		return i, err
-	}
-	return int64(binary.LittleEndian.Uint64(r.scratch[:])), nil
+	u, err := r.ReadU64()
+	return int64(u), err
 }
-
 func (r *Reader) ReadF32() (float32, error) {
 	u, err := r.ReadU32()
 	f := math.Float32frombits(u)
@@ -139,19 +279,58 @@ func (r *Reader) ReadBool() (bool, error) {
 	return b == 1, nil
 }
 
+// Reads the flag which precedes an optional value, returning true if the value
+// is present.
+func (r *Reader) ReadOptional() (bool, error) {
+	b, err := r.ReadU8()
+	if err != nil {
+		return false, err
+	}
+
+	if b > 1 {
+		return false, fmt.Errorf("Invalid optional value: %#x", b)
+	}
+
+	return b == 1, nil
+}
+
 func (r *Reader) ReadString() (string, error) {
-	buf, err := r.ReadData()
+	l, err := r.ReadUint()
+	if err != nil {
+		return "", err
+	}
+	if l > r.opts.MaxStringLength {
+		return "", fmt.Errorf("String length %d exceeds configured limit of %d",
+			l, r.opts.MaxStringLength)
+	}
+	var buf []byte
+	if r.base == nil {
+		// The bytes are copied by the conversion to string below
+		buf, err = r.take(l)
+	} else {
+		buf, err = r.readData(l)
+	}
 	if err != nil {
 		return "", err
 	}
 	if !utf8.Valid(buf) {
 		return "", ErrInvalidStr
 	}
+	if r.base != nil || r.opts.UnsafeStrings {
+		// Either the buffer is ours alone, or the caller accepts that the
+		// string refers to the input
+		return *(*string)(unsafe.Pointer(&buf)), nil
+	}
 	return string(buf), nil
 }
 
 // Reads a fixed amount of arbitrary data, defined by the length of the slice.
 func (r *Reader) ReadDataFixed(dest []byte) error {
+	if r.base == nil {
+		buf, err := r.take(uint64(len(dest)))
+		copy(dest, buf)
+		return err
+	}
 	var amt int = 0
 	for amt < len(dest) {
 		n, err := r.base.Read(dest[amt:])
@@ -163,23 +342,52 @@ func (r *Reader) ReadDataFixed(dest []byte) error {
 	return nil
 }
 
-// Reads arbitrary data whose length is read from the message.
+// Reads arbitrary data whose length is read from the message. Its length is
+// limited like that of arrays, see ReadArrayLength. If the reader was created
+// with NewBytesReader and DecodeOptions.NoCopy is set, the data is a slice of
+// its input.
 func (r *Reader) ReadData() ([]byte, error) {
-	l, err := r.ReadUint()
+	l, err := r.ReadArrayLength()
 	if err != nil {
 		return nil, err
 	}
-	if l >= maxUnmarshalBytes {
-		return nil, ErrLimitExceeded
+	return r.readData(l)
+}
+
+// The initial size of the buffer for data read from a stream.
+const dataChunkSize = 64 * 1024
+
+func (r *Reader) readData(l uint64) ([]byte, error) {
+	if r.base == nil {
+		data, err := r.take(l)
+		if err != nil || r.opts.NoCopy {
+			return data, err
+		}
+		buf := make([]byte, l)
+		copy(buf, data)
+		return buf, nil
 	}
-	buf := make([]byte, l)
-	var amt uint64 = 0
-	for amt < l {
-		n, err := r.base.Read(buf[amt:])
-		if err != nil {
+
+	// The length has not been checked against the input yet, so the buffer
+	// grows as the data arrives rather than being allocated up front
+	size := l
+	if size > dataChunkSize {
+		size = dataChunkSize
+	}
+	buf := make([]byte, 0, size)
+	for uint64(len(buf)) < l {
+		if len(buf) == cap(buf) {
+			buf = append(buf, 0)[:len(buf)]
+		}
+		end := cap(buf)
+		if uint64(end) > l {
+			end = int(l)
+		}
+		n, err := r.base.Read(buf[len(buf):end])
+		buf = buf[:len(buf)+n]
+		if err != nil && uint64(len(buf)) < l {
 			return nil, err
 		}
-		amt += uint64(n)
 	}
 	return buf, nil
 }
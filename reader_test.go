@@ -3,6 +3,7 @@ package bare
 import (
 	"bytes"
 	"io"
+	"runtime"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -198,4 +199,141 @@ func TestReadData(t *testing.T) {
 	assert.Equal(t, v, ref[1:])
 	_, err = r.ReadData()
 	assert.Equal(t, err, io.EOF)
+
+	// A large length alone does not allocate a buffer of that size, and
+	// longer data is read in full
+	opts := DecodeOptions{MaxArrayLength: 1 << 30, MaxElements: 1 << 30}
+	r = opts.NewReader(bytes.NewReader([]byte{0x80, 0x80, 0x80, 0x08, 0x01}))
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	_, err = r.ReadData()
+	runtime.ReadMemStats(&after)
+	assert.Equal(t, err, io.EOF)
+	assert.Less(t, after.TotalAlloc-before.TotalAlloc, uint64(1<<20))
+
+	data := make([]byte, 3*dataChunkSize+1)
+	data[len(data)-1] = 0x42
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	assert.Nil(t, w.WriteData(data))
+	r = opts.NewReader(onlyReader{bytes.NewReader(buf.Bytes())})
+	v, err = r.ReadData()
+	assert.Nil(t, err)
+	assert.Equal(t, data, v)
+
+	// The length is limited like that of arrays
+	r = DecodeOptions{MaxArrayLength: 2}.NewReader(bytes.NewReader(ref))
+	_, err = r.ReadData()
+	assert.EqualError(t, err, "Array length 3 exceeds configured limit of 2")
+}
+
+func TestBytesReader(t *testing.T) {
+	r := NewBytesReader([]byte{
+		0xB7, 0x26, // uint
+		0xf1, 0x14, // int
+		0x42,       // u8
+		0xFE, 0xCA, // u16
+		0x2E, 0xFB, 0xFF, 0xFF, // i32
+		0x71, 0x2D, 0xA7, 0x44, // f32
+		0x01,             // bool
+		0x02, 0x68, 0x69, // string
+		0x02, 0x13, 0x37, // data
+		0x42, 0x43, // data<2>
+		0x80,
+	})
+
+	vu, err := r.ReadUint()
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0x1337), vu)
+	vi, err := r.ReadInt()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(-1337), vi)
+	u8, err := r.ReadU8()
+	assert.Nil(t, err)
+	assert.Equal(t, uint8(0x42), u8)
+	u16, err := r.ReadU16()
+	assert.Nil(t, err)
+	assert.Equal(t, uint16(0xCAFE), u16)
+	i32, err := r.ReadI32()
+	assert.Nil(t, err)
+	assert.Equal(t, int32(-1234), i32)
+	f32, err := r.ReadF32()
+	assert.Nil(t, err)
+	assert.Equal(t, float32(1337.42), f32)
+	b, err := r.ReadBool()
+	assert.Nil(t, err)
+	assert.True(t, b)
+	str, err := r.ReadString()
+	assert.Nil(t, err)
+	assert.Equal(t, "hi", str)
+	data, err := r.ReadData()
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0x13, 0x37}, data)
+	fixed := make([]byte, 2)
+	err = r.ReadDataFixed(fixed)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0x42, 0x43}, fixed)
+	assert.Equal(t, int64(24), r.Offset())
+
+	// Truncated values
+	_, err = r.ReadUint()
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+	assert.Equal(t, int64(25), r.Offset())
+	_, err = r.ReadUint()
+	assert.Equal(t, io.EOF, err)
+	_, err = r.ReadU8()
+	assert.Equal(t, io.EOF, err)
+
+	r = NewBytesReader([]byte{0xFE})
+	_, err = r.ReadU16()
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+
+	r = NewBytesReader([]byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0x7F})
+	_, err = r.ReadUint()
+	assert.Equal(t, errOverflow, err)
+}
+
+// Implements io.Reader only, which the reader reads bytes from one at a time
+type onlyReader struct {
+	r *bytes.Reader
+}
+
+func (r onlyReader) Read(p []byte) (int, error) {
+	return r.r.Read(p)
+}
+
+func TestReaderReset(t *testing.T) {
+	r := DecodeOptions{Strict: true}.NewReader(bytes.NewReader([]byte{0x01}))
+	v, err := r.ReadU8()
+	assert.Nil(t, err)
+	assert.Equal(t, uint8(1), v)
+
+	r.Reset(onlyReader{bytes.NewReader([]byte{0x80, 0x00})})
+	assert.Equal(t, int64(0), r.Offset())
+	// Options are kept
+	_, err = r.ReadUint()
+	assert.Equal(t, ErrNonCanonical, err)
+
+	r.ResetBytes([]byte{0x02})
+	assert.Equal(t, int64(0), r.Offset())
+	v, err = r.ReadU8()
+	assert.Nil(t, err)
+	assert.Equal(t, uint8(2), v)
+	assert.Equal(t, int64(1), r.Offset())
+}
+
+func TestReaderAllocs(t *testing.T) {
+	payload := []byte{0xB7, 0x26, 0x42, 0xFE, 0xCA, 0x2E, 0xFB, 0xFF, 0xFF, 0x01}
+	src := bytes.NewReader(nil)
+	r := NewReader(onlyReader{src})
+	allocs := testing.AllocsPerRun(16, func() {
+		src.Reset(payload)
+		r.Reset(onlyReader{src})
+		r.ReadUint()
+		r.ReadU8()
+		r.ReadU16()
+		r.ReadI32()
+		r.ReadBool()
+	})
+	assert.Equal(t, 0.0, allocs)
 }
@@ -7,8 +7,11 @@ type SchemaType interface {
 }
 
 type UserDefinedType struct {
-	name string
-	type_ Type
+	name     string
+	type_    Type
+	pos      Pos
+	end      Pos
+	comments []Comment
 }
 
 func (udt *UserDefinedType) Name() string {
@@ -19,10 +22,24 @@ func (udt *UserDefinedType) Type() Type {
 	return udt.type_
 }
 
+// Returns the position of its name.
+func (udt *UserDefinedType) Pos() Pos {
+	return udt.pos
+}
+
+// Returns the comments of the declaration: those on the lines before it,
+// within it and at the end of its last line.
+func (udt *UserDefinedType) Comments() []Comment {
+	return udt.comments
+}
+
 type UserDefinedEnum struct {
-	name   string
-	kind   TypeKind
-	values []EnumValue
+	name     string
+	kind     TypeKind
+	values   []EnumValue
+	pos      Pos
+	end      Pos
+	comments []Comment
 }
 
 func (ude *UserDefinedEnum) Name() string {
@@ -37,9 +54,20 @@ func (ude *UserDefinedEnum) Values() []EnumValue {
 	return ude.values
 }
 
+// Returns the position of its name.
+func (ude *UserDefinedEnum) Pos() Pos {
+	return ude.pos
+}
+
+// Returns the comments of the declaration. See UserDefinedType.Comments.
+func (ude *UserDefinedEnum) Comments() []Comment {
+	return ude.comments
+}
+
 type EnumValue struct {
 	name  string
 	value uint
+	pos   Pos
 }
 
 func (ev *EnumValue) Name() string {
@@ -50,6 +78,11 @@ func (ev *EnumValue) Value() uint {
 	return ev.value
 }
 
+// Returns the position of its name.
+func (ev *EnumValue) Pos() Pos {
+	return ev.pos
+}
+
 type TypeKind int
 
 const (
@@ -157,14 +190,21 @@ type Type interface {
 
 type PrimitiveType struct {
 	kind TypeKind
+	pos  Pos
 }
 
 func (pt *PrimitiveType) Kind() TypeKind {
 	return pt.kind
 }
 
+// Returns the position of the first token of the type.
+func (pt *PrimitiveType) Pos() Pos {
+	return pt.pos
+}
+
 type OptionalType struct {
 	subtype Type
+	pos     Pos
 }
 
 func (ot *OptionalType) Kind() TypeKind {
@@ -175,8 +215,14 @@ func (ot *OptionalType) Subtype() Type {
 	return ot.subtype
 }
 
+// Returns the position of the first token of the type.
+func (ot *OptionalType) Pos() Pos {
+	return ot.pos
+}
+
 type DataType struct {
 	length uint
+	pos    Pos
 }
 
 func (dt *DataType) Kind() TypeKind {
@@ -190,9 +236,15 @@ func (dt *DataType) Length() uint {
 	return dt.length
 }
 
+// Returns the position of the first token of the type.
+func (dt *DataType) Pos() Pos {
+	return dt.pos
+}
+
 type MapType struct {
 	key   Type
 	value Type
+	pos   Pos
 }
 
 func (mt *MapType) Kind() TypeKind {
@@ -207,9 +259,15 @@ func (mt *MapType) Value() Type {
 	return mt.value
 }
 
+// Returns the position of the first token of the type.
+func (mt *MapType) Pos() Pos {
+	return mt.pos
+}
+
 type ArrayType struct {
 	member Type
 	length uint
+	pos    Pos
 }
 
 func (at *ArrayType) Kind() TypeKind {
@@ -227,8 +285,15 @@ func (at *ArrayType) Length() uint {
 	return at.length
 }
 
+// Returns the position of the first token of the type.
+func (at *ArrayType) Pos() Pos {
+	return at.pos
+}
+
 type UnionType struct {
 	types []UnionSubtype
+	pos   Pos
+	end   Pos
 }
 
 func (ut *UnionType) Kind() TypeKind {
@@ -239,9 +304,15 @@ func (ut *UnionType) Types() []UnionSubtype {
 	return ut.types
 }
 
+// Returns the position of the first token of the type.
+func (ut *UnionType) Pos() Pos {
+	return ut.pos
+}
+
 type UnionSubtype struct {
 	subtype Type
 	tag     uint64
+	pos     Pos
 }
 
 func (ust *UnionSubtype) Type() Type {
@@ -252,8 +323,15 @@ func (ust *UnionSubtype) Tag() uint64 {
 	return ust.tag
 }
 
+// Returns the position of its type.
+func (ust *UnionSubtype) Pos() Pos {
+	return ust.pos
+}
+
 type StructType struct {
 	fields []StructField
+	pos    Pos
+	end    Pos
 }
 
 func (st *StructType) Kind() TypeKind {
@@ -264,9 +342,15 @@ func (st *StructType) Fields() []StructField {
 	return st.fields
 }
 
+// Returns the position of the first token of the type.
+func (st *StructType) Pos() Pos {
+	return st.pos
+}
+
 type StructField struct {
-	name string
+	name  string
 	type_ Type
+	pos   Pos
 }
 
 func (sf *StructField) Name() string {
@@ -277,11 +361,18 @@ func (sf *StructField) Type() Type {
 	return sf.type_
 }
 
+// Returns the position of its name.
+func (sf *StructField) Pos() Pos {
+	return sf.pos
+}
+
 // This has not been compared with the list of user-defined types and is not
 // guaranteed to actually exist; the consumer of this type must perform this
-// lookup itself.
+// lookup itself, or use Check to resolve it.
 type NamedUserType struct {
 	name string
+	decl SchemaType
+	pos  Pos
 }
 
 func (nut *NamedUserType) Kind() TypeKind {
@@ -291,3 +382,14 @@ func (nut *NamedUserType) Kind() TypeKind {
 func (nut *NamedUserType) Name() string {
 	return nut.name
 }
+
+// Returns the declaration of the type, or nil if the schema has not been
+// resolved with Check or the type does not exist.
+func (nut *NamedUserType) Decl() SchemaType {
+	return nut.decl
+}
+
+// Returns the position of the first token of the type.
+func (nut *NamedUserType) Pos() Pos {
+	return nut.pos
+}
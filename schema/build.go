@@ -0,0 +1,178 @@
+package schema
+
+import "fmt"
+
+// The constructors below build schemas without parsing a document. The nodes
+// they return have no position, and Check should be used to validate and
+// resolve the result like a parsed schema.
+
+// Returns a user-defined type with the given name and type.
+func NewUserDefinedType(name string, ty Type) *UserDefinedType {
+	return &UserDefinedType{name: name, type_: ty}
+}
+
+// Returns a user-defined enum of the given kind, which must be UINT, U8, U16,
+// U32 or U64. See EnumBuilder to number the values automatically.
+func NewUserDefinedEnum(name string, kind TypeKind, values []EnumValue) *UserDefinedEnum {
+	switch kind {
+	case UINT, U8, U16, U32, U64:
+	default:
+		panic(fmt.Errorf("Invalid enum type %s", kind))
+	}
+	return &UserDefinedEnum{name: name, kind: kind, values: values}
+}
+
+// Returns an enum value with the given name and value.
+func NewEnumValue(name string, value uint) EnumValue {
+	return EnumValue{name: name, value: value}
+}
+
+// Returns a primitive type of the given kind, which must be one of UINT
+// through Void.
+func NewPrimitiveType(kind TypeKind) *PrimitiveType {
+	if kind < UINT || kind > Void {
+		panic(fmt.Errorf("Invalid primitive type %s", kind))
+	}
+	return &PrimitiveType{kind: kind}
+}
+
+// Returns an optional type of the given subtype.
+func NewOptionalType(subtype Type) *OptionalType {
+	return &OptionalType{subtype: subtype}
+}
+
+// Returns a data type of the given length, or of variable length if it is
+// zero.
+func NewDataType(length uint) *DataType {
+	return &DataType{length: length}
+}
+
+// Returns a map type with the given key and value types.
+func NewMapType(key, value Type) *MapType {
+	return &MapType{key: key, value: value}
+}
+
+// Returns an array of the given length, or a slice if it is zero.
+func NewArrayType(member Type, length uint) *ArrayType {
+	return &ArrayType{member: member, length: length}
+}
+
+// Returns a union of the given subtypes. See UnionBuilder to number the
+// subtypes automatically.
+func NewUnionType(types []UnionSubtype) *UnionType {
+	return &UnionType{types: types}
+}
+
+// Returns a union subtype with the given type and tag.
+func NewUnionSubtype(ty Type, tag uint64) UnionSubtype {
+	return UnionSubtype{subtype: ty, tag: tag}
+}
+
+// Returns a struct type with the given fields. See StructBuilder to add them
+// one at a time.
+func NewStructType(fields []StructField) *StructType {
+	return &StructType{fields: fields}
+}
+
+// Returns a struct field with the given name and type.
+func NewStructField(name string, ty Type) StructField {
+	return StructField{name: name, type_: ty}
+}
+
+// Returns a reference to the user-defined type with the given name.
+func NewNamedUserType(name string) *NamedUserType {
+	return &NamedUserType{name: name}
+}
+
+// Builds a struct type one field at a time:
+//
+//	st := schema.NewStructBuilder().
+//		Field("id", schema.NewPrimitiveType(schema.U64)).
+//		Field("name", schema.NewPrimitiveType(schema.String)).
+//		Build()
+type StructBuilder struct {
+	fields []StructField
+}
+
+// Returns a builder for a struct without fields.
+func NewStructBuilder() *StructBuilder {
+	return &StructBuilder{}
+}
+
+// Adds a field to the end of the struct.
+func (sb *StructBuilder) Field(name string, ty Type) *StructBuilder {
+	sb.fields = append(sb.fields, NewStructField(name, ty))
+	return sb
+}
+
+// Returns the struct type with the fields added so far.
+func (sb *StructBuilder) Build() *StructType {
+	fields := make([]StructField, len(sb.fields))
+	copy(fields, sb.fields)
+	return NewStructType(fields)
+}
+
+// Builds a union type one subtype at a time. Like in the schema language,
+// each subtype is given the tag after the previous one unless one is given
+// explicitly.
+type UnionBuilder struct {
+	types []UnionSubtype
+	next  uint64
+}
+
+// Returns a builder for a union without subtypes.
+func NewUnionBuilder() *UnionBuilder {
+	return &UnionBuilder{}
+}
+
+// Adds a subtype with the tag after the previous one, or 0 for the first.
+func (ub *UnionBuilder) Type(ty Type) *UnionBuilder {
+	return ub.TypeTag(ty, ub.next)
+}
+
+// Adds a subtype with the given tag.
+func (ub *UnionBuilder) TypeTag(ty Type, tag uint64) *UnionBuilder {
+	ub.types = append(ub.types, NewUnionSubtype(ty, tag))
+	ub.next = tag + 1
+	return ub
+}
+
+// Returns the union type with the subtypes added so far.
+func (ub *UnionBuilder) Build() *UnionType {
+	types := make([]UnionSubtype, len(ub.types))
+	copy(types, ub.types)
+	return NewUnionType(types)
+}
+
+// Builds an enum one value at a time. Like in the schema language, each value
+// is the one after the previous one unless it is given explicitly.
+type EnumBuilder struct {
+	name   string
+	kind   TypeKind
+	values []EnumValue
+	next   uint
+}
+
+// Returns a builder for an enum of the given kind. See NewUserDefinedEnum.
+func NewEnumBuilder(name string, kind TypeKind) *EnumBuilder {
+	return &EnumBuilder{name: name, kind: kind}
+}
+
+// Adds a value after the previous one, or 0 for the first.
+func (eb *EnumBuilder) Value(name string) *EnumBuilder {
+	return eb.ValueOf(name, eb.next)
+}
+
+// Adds a value with the given value.
+func (eb *EnumBuilder) ValueOf(name string, value uint) *EnumBuilder {
+	eb.values = append(eb.values, NewEnumValue(name, value))
+	eb.next = value + 1
+	return eb
+}
+
+// Returns the enum with the values added so far.
+func (eb *EnumBuilder) Build() *UserDefinedEnum {
+	values := make([]EnumValue, len(eb.values))
+	copy(values, eb.values)
+	return NewUserDefinedEnum(eb.name, eb.kind, values)
+}
@@ -0,0 +1,61 @@
+package schema
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildSchema(t *testing.T) {
+	str := NewPrimitiveType(String)
+	types := []SchemaType{
+		NewEnumBuilder("Department", U8).
+			Value("ACCOUNTING").
+			Value("ADMINISTRATION").
+			ValueOf("JSMITH", 99).
+			Value("JDOE").
+			Build(),
+		NewUserDefinedType("Customer", NewStructBuilder().
+			Field("name", str).
+			Field("keys", NewArrayType(NewDataType(128), 4)).
+			Field("metadata", NewMapType(str, NewDataType(0))).
+			Field("department", NewOptionalType(NewNamedUserType("Department"))).
+			Build()),
+		NewUserDefinedType("Person", NewUnionBuilder().
+			Type(NewNamedUserType("Customer")).
+			TypeTag(NewPrimitiveType(Void), 5).
+			Type(NewArrayType(str, 0)).
+			Build()),
+	}
+	assert.Empty(t, Check(types))
+
+	ude := types[0].(*UserDefinedEnum)
+	assert.Equal(t, uint(100), ude.Values()[3].Value())
+	ut := types[2].(*UserDefinedType).Type().(*UnionType)
+	assert.Equal(t, uint64(6), ut.Types()[2].Tag())
+
+	var buf bytes.Buffer
+	assert.NoError(t, Format(&buf, types))
+	assert.Equal(t, `enum Department u8 {
+	ACCOUNTING
+	ADMINISTRATION
+	JSMITH = 99
+	JDOE
+}
+
+type Customer {
+	name: string
+	keys: [4]data<128>
+	metadata: map[string]data
+	department: optional<Department>
+}
+
+type Person (Customer | void = 5 | []string)
+`, buf.String())
+}
+
+func TestBuildInvalid(t *testing.T) {
+	assert.Panics(t, func() { NewPrimitiveType(Struct) })
+	assert.Panics(t, func() { NewUserDefinedEnum("Signed", I8, nil) })
+}
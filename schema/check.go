@@ -0,0 +1,278 @@
+package schema
+
+import "sort"
+
+// Checks that a parsed schema is valid, and resolves each NamedUserType to the
+// declaration it refers to (see NamedUserType.Decl). Parse only checks the
+// syntax of a document; Check reports:
+//
+//   - references to types which are not declared
+//   - types, struct fields, enum values and union tags declared twice
+//   - enum values which do not fit in the enum's type
+//   - map keys which are not of a primitive type other than f32, f64 and void
+//   - void types outside of unions
+//   - structs without fields and unions without members
+//   - types which contain themselves without optional, [], map or union
+//     indirection, and so have no finite encoding
+//
+// All of the problems found are returned as *ErrInvalid errors, in the order
+// they appear in the schema. The schema is valid if none are returned.
+func Check(types []SchemaType) []error {
+	c := &checker{decls: make(map[string]SchemaType, len(types))}
+
+	for _, st := range types {
+		if prev, ok := c.decls[st.Name()]; ok {
+			c.errorf(schemaTypePos(st), "Duplicate type %s, previously declared at %s",
+				st.Name(), schemaTypePos(prev))
+			continue
+		}
+		c.decls[st.Name()] = st
+	}
+
+	for _, st := range types {
+		switch st := st.(type) {
+		case *UserDefinedType:
+			c.checkType(st.Type(), inDecl)
+		case *UserDefinedEnum:
+			c.checkEnum(st)
+		}
+	}
+
+	c.checkRecursion(types)
+
+	sort.SliceStable(c.errs, func(i, j int) bool {
+		a, b := c.errs[i].(*ErrInvalid).Pos, c.errs[j].(*ErrInvalid).Pos
+		return a.Line < b.Line || (a.Line == b.Line && a.Column < b.Column)
+	})
+	return c.errs
+}
+
+type checker struct {
+	decls map[string]SchemaType
+	errs  []error
+}
+
+func (c *checker) errorf(pos Pos, format string, args ...interface{}) {
+	c.errs = append(c.errs, errorf(pos, format, args...))
+}
+
+func schemaTypePos(st SchemaType) Pos {
+	switch st := st.(type) {
+	case *UserDefinedType:
+		return st.Pos()
+	case *UserDefinedEnum:
+		return st.Pos()
+	}
+	return Pos{}
+}
+
+func typePos(ty Type) Pos {
+	switch ty := ty.(type) {
+	case *PrimitiveType:
+		return ty.Pos()
+	case *OptionalType:
+		return ty.Pos()
+	case *DataType:
+		return ty.Pos()
+	case *MapType:
+		return ty.Pos()
+	case *ArrayType:
+		return ty.Pos()
+	case *UnionType:
+		return ty.Pos()
+	case *StructType:
+		return ty.Pos()
+	case *NamedUserType:
+		return ty.Pos()
+	}
+	return Pos{}
+}
+
+// Where a type appears, which determines whether it may be void.
+type site int
+
+const (
+	// The type of a user-defined type
+	inDecl site = iota
+	// A member of a union
+	inUnion
+	// Anywhere else
+	inOther
+)
+
+func (c *checker) checkType(ty Type, where site) {
+	switch ty := ty.(type) {
+	case *PrimitiveType:
+		if ty.Kind() == Void && where == inOther {
+			c.errorf(ty.Pos(), "Void type outside of a union")
+		}
+	case *OptionalType:
+		c.checkType(ty.Subtype(), inOther)
+	case *ArrayType:
+		c.checkType(ty.Member(), inOther)
+	case *MapType:
+		c.checkType(ty.Key(), inOther)
+		c.checkType(ty.Value(), inOther)
+		c.checkMapKey(ty.Key())
+	case *UnionType:
+		if len(ty.Types()) == 0 {
+			c.errorf(ty.Pos(), "Union type has no members")
+		}
+		tags := make(map[uint64]bool)
+		for _, ust := range ty.Types() {
+			if tags[ust.Tag()] {
+				c.errorf(ust.Pos(), "Duplicate union tag %d", ust.Tag())
+			}
+			tags[ust.Tag()] = true
+			c.checkType(ust.Type(), inUnion)
+		}
+	case *StructType:
+		if len(ty.Fields()) == 0 {
+			c.errorf(ty.Pos(), "Struct type has no fields")
+		}
+		names := make(map[string]bool)
+		for _, field := range ty.Fields() {
+			if names[field.Name()] {
+				c.errorf(field.Pos(), "Duplicate struct field %s", field.Name())
+			}
+			names[field.Name()] = true
+			c.checkType(field.Type(), inOther)
+		}
+	case *NamedUserType:
+		decl, ok := c.decls[ty.Name()]
+		if !ok {
+			c.errorf(ty.Pos(), "Unknown type %s", ty.Name())
+			return
+		}
+		ty.decl = decl
+		if where == inOther {
+			if target, _ := c.resolve(ty); target != nil && target.Kind() == Void {
+				c.errorf(ty.Pos(), "Void type %s used outside of a union", ty.Name())
+			}
+		}
+	}
+}
+
+// Follows named user types to the type they are an alias of. Returns the enum
+// instead if the type is an enum, or neither if the type does not exist or
+// the aliases are cyclic.
+func (c *checker) resolve(ty Type) (Type, *UserDefinedEnum) {
+	for n := 0; n <= len(c.decls); n++ {
+		named, ok := ty.(*NamedUserType)
+		if !ok {
+			return ty, nil
+		}
+		switch decl := c.decls[named.Name()].(type) {
+		case *UserDefinedType:
+			ty = decl.Type()
+		case *UserDefinedEnum:
+			return nil, decl
+		default:
+			return nil, nil
+		}
+	}
+	return nil, nil
+}
+
+func (c *checker) checkMapKey(key Type) {
+	ty, enum := c.resolve(key)
+	if enum != nil || ty == nil {
+		return
+	}
+	switch ty.Kind() {
+	case F32, F64, Void, DataArray, DataSlice, Optional, Array, Slice, Map,
+		Union, Struct:
+		c.errorf(typePos(key), "Invalid map key type")
+	}
+}
+
+func (c *checker) checkEnum(ude *UserDefinedEnum) {
+	var max uint64
+	switch ude.Kind() {
+	case U8:
+		max = 1<<8 - 1
+	case U16:
+		max = 1<<16 - 1
+	case U32:
+		max = 1<<32 - 1
+	}
+
+	names := make(map[string]bool)
+	values := make(map[uint]string)
+	for _, ev := range ude.Values() {
+		if names[ev.Name()] {
+			c.errorf(ev.Pos(), "Duplicate enum value %s", ev.Name())
+		}
+		names[ev.Name()] = true
+
+		if prev, ok := values[ev.Value()]; ok {
+			c.errorf(ev.Pos(), "Value %d of %s is already used by %s",
+				ev.Value(), ev.Name(), prev)
+		} else {
+			values[ev.Value()] = ev.Name()
+		}
+
+		if max != 0 && uint64(ev.Value()) > max {
+			c.errorf(ev.Pos(), "Value %d of %s overflows the enum type",
+				ev.Value(), ev.Name())
+		}
+	}
+}
+
+// Reports the user-defined types which cannot be encoded in a finite number
+// of bytes, because they always contain themselves.
+func (c *checker) checkRecursion(types []SchemaType) {
+	finite := make(map[string]bool)
+	for changed := true; changed; {
+		changed = false
+		for _, st := range types {
+			udt, ok := st.(*UserDefinedType)
+			if !ok || finite[udt.Name()] {
+				continue
+			}
+			if c.finite(udt.Type(), finite) {
+				finite[udt.Name()] = true
+				changed = true
+			}
+		}
+	}
+
+	for _, st := range types {
+		udt, ok := st.(*UserDefinedType)
+		if ok && !finite[udt.Name()] && c.decls[udt.Name()] == st {
+			c.errorf(udt.Pos(), "Type %s contains itself and has no finite encoding",
+				udt.Name())
+		}
+	}
+}
+
+// Reports whether a type has a finite encoding, given the user-defined types
+// already known to have one.
+func (c *checker) finite(ty Type, known map[string]bool) bool {
+	switch ty := ty.(type) {
+	case *ArrayType:
+		return ty.Length() == 0 || c.finite(ty.Member(), known)
+	case *UnionType:
+		for _, ust := range ty.Types() {
+			if c.finite(ust.Type(), known) {
+				return true
+			}
+		}
+		return false
+	case *StructType:
+		for _, field := range ty.Fields() {
+			if !c.finite(field.Type(), known) {
+				return false
+			}
+		}
+		return true
+	case *NamedUserType:
+		if _, ok := c.decls[ty.Name()].(*UserDefinedType); ok {
+			return known[ty.Name()]
+		}
+		// Enums, and unknown types which are reported separately
+		return true
+	}
+	// Primitives, data, and optional and map types which may be empty
+	return true
+}
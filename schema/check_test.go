@@ -0,0 +1,82 @@
+package schema
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckValid(t *testing.T) {
+	types, err := Parse(strings.NewReader(`
+		type Void void
+		enum Color u8 {
+			RED
+			BLUE = 255
+		}
+		type Name string
+		type Node {
+			value: uint
+			children: []Node
+			next: optional<Node>
+			colors: map[Color]Name
+		}
+		type Tree (Node | Void | [2]Tree)
+	`))
+	assert.NoError(t, err)
+	assert.Empty(t, Check(types))
+
+	node := types[3].(*UserDefinedType).Type().(*StructType)
+	children := node.Fields()[1].Type().(*ArrayType)
+	assert.Equal(t, types[3], children.Member().(*NamedUserType).Decl())
+}
+
+func TestCheckErrors(t *testing.T) {
+	types, err := Parse(strings.NewReader(`
+type Foo {
+	a: Missing
+	a: u8
+	b: void
+	c: map[f32]string
+	d: map[Foo]string
+	e: []Empty
+	f: optional<Nothing>
+}
+type Foo u8
+type Empty {}
+type Nothing void
+enum Color u8 {
+	RED = 1
+	GREEN = 1
+	RED = 2
+	BLUE = 256
+}
+type Choice (u8 | u16 = 0)
+type Loop {
+	next: Loop
+}
+type Pair [2]Loop
+`))
+	assert.NoError(t, err)
+
+	var messages []string
+	for _, err := range Check(types) {
+		messages = append(messages, err.Error())
+	}
+	assert.Equal(t, []string{
+		"3:5: Unknown type Missing",
+		"4:2: Duplicate struct field a",
+		"5:5: Void type outside of a union",
+		"6:9: Invalid map key type",
+		"7:9: Invalid map key type",
+		"9:14: Void type Nothing used outside of a union",
+		"11:6: Duplicate type Foo, previously declared at 2:6",
+		"12:12: Struct type has no fields",
+		"16:2: Value 1 of GREEN is already used by RED",
+		"17:2: Duplicate enum value RED",
+		"18:2: Value 256 of BLUE overflows the enum type",
+		"20:19: Duplicate union tag 0",
+		"21:6: Type Loop contains itself and has no finite encoding",
+		"24:6: Type Pair contains itself and has no finite encoding",
+	}, messages)
+}
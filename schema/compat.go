@@ -0,0 +1,439 @@
+package schema
+
+import (
+	"fmt"
+	"strings"
+)
+
+// How a change to a schema affects the messages encoded with it.
+type Compatibility int
+
+const (
+	// Messages are encoded the same way with both schemas. Names may differ,
+	// which matters to representations such as JSON but not to BARE.
+	WireCompatible Compatibility = iota
+	// Messages encoded with the old schema can be decoded with the new one,
+	// but not always the other way around, such as when a union member or an
+	// enum value is added.
+	BackwardCompatible
+	// Messages encoded with one schema cannot be decoded with the other.
+	Breaking
+)
+
+func (c Compatibility) String() string {
+	switch c {
+	case WireCompatible:
+		return "wire-compatible"
+	case BackwardCompatible:
+		return "backward-compatible"
+	case Breaking:
+		return "breaking"
+	}
+	return fmt.Sprintf("Compatibility(%d)", int(c))
+}
+
+func (c Compatibility) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+// A difference between two versions of a schema.
+type Change struct {
+	// Where the change is, such as Customer.orders[].quantity. Union members
+	// are written .(Name) or .(tag), enum values .NAME, map keys and values
+	// [key] and [value], and the Nth field of a struct .#N when another field
+	// takes its place.
+	Path          string
+	Compatibility Compatibility
+	Message       string
+	// The positions of the changed node in each schema, if it is in it
+	Old, New Pos
+}
+
+func (c Change) String() string {
+	return fmt.Sprintf("%s: %s (%s)", c.Path, c.Message, c.Compatibility)
+}
+
+// Returns the least compatible classification of a list of changes, which is
+// WireCompatible if there are none.
+func Overall(changes []Change) Compatibility {
+	compat := WireCompatible
+	for _, c := range changes {
+		if c.Compatibility > compat {
+			compat = c.Compatibility
+		}
+	}
+	return compat
+}
+
+// Compares two versions of a schema, and returns their differences with how
+// each affects the encoding of messages. The declarations of both schemas are
+// compared by name, following the types they refer to, so that each message
+// type of the old schema is checked against the type of the same name in the
+// new one. Both schemas should be valid (see Check).
+func Compare(old, new []SchemaType) []Change {
+	c := &comparer{
+		old:  make(map[string]SchemaType, len(old)),
+		new:  make(map[string]SchemaType, len(new)),
+		seen: make(map[[2]string]bool),
+	}
+	for _, st := range old {
+		c.old[st.Name()] = st
+	}
+	for _, st := range new {
+		c.new[st.Name()] = st
+	}
+
+	for _, o := range old {
+		n, ok := c.new[o.Name()]
+		if !ok {
+			c.add(o.Name(), Breaking, schemaTypePos(o), Pos{},
+				"Type %s removed", o.Name())
+			continue
+		}
+		c.compareDecl(o.Name(), o, n)
+	}
+	for _, n := range new {
+		if _, ok := c.old[n.Name()]; !ok {
+			c.add(n.Name(), WireCompatible, Pos{}, schemaTypePos(n),
+				"Type %s added", n.Name())
+		}
+	}
+	return c.changes
+}
+
+type comparer struct {
+	old, new map[string]SchemaType
+	// Pairs of differently named types already compared
+	seen    map[[2]string]bool
+	changes []Change
+}
+
+func (c *comparer) add(path string, compat Compatibility, old, new Pos,
+	format string, args ...interface{}) {
+	c.changes = append(c.changes, Change{
+		Path:          path,
+		Compatibility: compat,
+		Message:       fmt.Sprintf(format, args...),
+		Old:           old,
+		New:           new,
+	})
+}
+
+func (c *comparer) compareDecl(path string, o, n SchemaType) {
+	switch o := o.(type) {
+	case *UserDefinedType:
+		if n, ok := n.(*UserDefinedType); ok {
+			c.compareType(path, o.Type(), n.Type())
+			return
+		}
+		c.compareEnumType(path, n.(*UserDefinedEnum), o.Type(), true)
+	case *UserDefinedEnum:
+		if n, ok := n.(*UserDefinedEnum); ok {
+			c.compareEnum(path, o, n)
+			return
+		}
+		c.compareEnumType(path, o, n.(*UserDefinedType).Type(), false)
+	}
+}
+
+// Compares an enum with a type in the other schema, which is the new one if
+// enumIsNew is false.
+func (c *comparer) compareEnumType(path string, ude *UserDefinedEnum, ty Type, enumIsNew bool) {
+	compat := Breaking
+	if pt, ok := c.resolve(ty, !enumIsNew).(*PrimitiveType); ok && pt.Kind() == ude.Kind() {
+		compat = WireCompatible
+	}
+	from, to := "enum "+ude.Name(), describe(ty)
+	oldPos, newPos := ude.Pos(), typePos(ty)
+	if enumIsNew {
+		from, to = to, from
+		oldPos, newPos = newPos, oldPos
+	}
+	c.add(path, compat, oldPos, newPos, "Type changed from %s to %s", from, to)
+}
+
+// Follows a named type to the type it declares, or returns the enum it
+// declares as a type of the same kind.
+func (c *comparer) resolve(ty Type, old bool) Type {
+	decls := c.new
+	if old {
+		decls = c.old
+	}
+	for n := 0; n <= len(decls); n++ {
+		named, ok := ty.(*NamedUserType)
+		if !ok {
+			return ty
+		}
+		switch decl := decls[named.Name()].(type) {
+		case *UserDefinedType:
+			ty = decl.Type()
+		case *UserDefinedEnum:
+			return &PrimitiveType{kind: decl.Kind()}
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+func (c *comparer) compareType(path string, o, n Type) {
+	on, oNamed := o.(*NamedUserType)
+	nn, nNamed := n.(*NamedUserType)
+	if oNamed || nNamed {
+		c.compareNamed(path, o, n, on, nn)
+		return
+	}
+
+	if o.Kind() != n.Kind() {
+		c.add(path, Breaking, typePos(o), typePos(n),
+			"Type changed from %s to %s", describe(o), describe(n))
+		return
+	}
+
+	switch o := o.(type) {
+	case *DataType:
+		if o.Length() != n.(*DataType).Length() {
+			c.add(path, Breaking, o.Pos(), typePos(n),
+				"Type changed from %s to %s", describe(o), describe(n))
+		}
+	case *OptionalType:
+		c.compareType(path, o.Subtype(), n.(*OptionalType).Subtype())
+	case *ArrayType:
+		n := n.(*ArrayType)
+		if o.Length() != n.Length() {
+			c.add(path, Breaking, o.Pos(), n.Pos(),
+				"Array length changed from %d to %d", o.Length(), n.Length())
+			return
+		}
+		c.compareType(path+"[]", o.Member(), n.Member())
+	case *MapType:
+		n := n.(*MapType)
+		c.compareType(path+"[key]", o.Key(), n.Key())
+		c.compareType(path+"[value]", o.Value(), n.Value())
+	case *UnionType:
+		c.compareUnion(path, o, n.(*UnionType))
+	case *StructType:
+		c.compareStruct(path, o, n.(*StructType))
+	}
+}
+
+// Compares two types of which at least one is a named type.
+func (c *comparer) compareNamed(path string, o, n Type, on, nn *NamedUserType) {
+	var oDecl, nDecl SchemaType
+	if on != nil {
+		if oDecl = c.old[on.Name()]; oDecl == nil {
+			return
+		}
+	}
+	if nn != nil {
+		if nDecl = c.new[nn.Name()]; nDecl == nil {
+			return
+		}
+	}
+
+	if on != nil && nn != nil {
+		if on.Name() == nn.Name() {
+			// Compared along with the declarations of the schema
+			return
+		}
+		key := [2]string{on.Name(), nn.Name()}
+		if c.seen[key] {
+			return
+		}
+		c.seen[key] = true
+		c.add(path, WireCompatible, on.Pos(), nn.Pos(),
+			"Type changed from %s to %s", on.Name(), nn.Name())
+		c.compareDecl(path, oDecl, nDecl)
+		return
+	}
+
+	// A named type replaced with its definition, or the other way around
+	if ude, ok := oDecl.(*UserDefinedEnum); ok {
+		c.compareEnumType(path, ude, n, false)
+	} else if ude, ok := nDecl.(*UserDefinedEnum); ok {
+		c.compareEnumType(path, ude, o, true)
+	} else if oDecl != nil {
+		c.compareType(path, oDecl.(*UserDefinedType).Type(), n)
+	} else {
+		c.compareType(path, o, nDecl.(*UserDefinedType).Type())
+	}
+}
+
+func (c *comparer) compareStruct(path string, o, n *StructType) {
+	oldFields := make(map[string]int)
+	for i, field := range o.Fields() {
+		oldFields[field.Name()] = i
+	}
+	newFields := make(map[string]int)
+	for i, field := range n.Fields() {
+		newFields[field.Name()] = i
+	}
+
+	for i, of := range o.Fields() {
+		fieldPath := path + "." + of.Name()
+		j, kept := newFields[of.Name()]
+		if kept && j != i {
+			c.add(fieldPath, Breaking, of.Pos(), n.Fields()[j].Pos(),
+				"Field %s moved from position %d to %d", of.Name(), i+1, j+1)
+			c.compareType(fieldPath, of.Type(), n.Fields()[j].Type())
+		}
+		if i >= len(n.Fields()) {
+			if !kept {
+				c.add(fieldPath, Breaking, of.Pos(), Pos{},
+					"Field %s removed", of.Name())
+			}
+			continue
+		}
+
+		nf := n.Fields()[i]
+		_, replaced := oldFields[nf.Name()]
+		switch {
+		case nf.Name() == of.Name():
+			c.compareType(fieldPath, of.Type(), nf.Type())
+		case !kept && !replaced:
+			c.add(fieldPath, WireCompatible, of.Pos(), nf.Pos(),
+				"Field %s renamed to %s", of.Name(), nf.Name())
+			c.compareType(fieldPath, of.Type(), nf.Type())
+		default:
+			if !kept {
+				c.add(fieldPath, Breaking, of.Pos(), Pos{},
+					"Field %s removed", of.Name())
+			}
+			// Another field takes the place of this one in messages
+			c.compareType(fmt.Sprintf("%s.#%d", path, i+1), of.Type(), nf.Type())
+		}
+	}
+	for i, nf := range n.Fields() {
+		if _, ok := oldFields[nf.Name()]; ok {
+			continue
+		}
+		if i < len(o.Fields()) {
+			if _, kept := newFields[o.Fields()[i].Name()]; !kept {
+				// Reported as renamed
+				continue
+			}
+		}
+		c.add(path+"."+nf.Name(), Breaking, Pos{}, nf.Pos(),
+			"Field %s added", nf.Name())
+	}
+}
+
+func (c *comparer) compareUnion(path string, o, n *UnionType) {
+	oldTags := make(map[uint64]*UnionSubtype)
+	oldNames := make(map[string]uint64)
+	for i := range o.Types() {
+		ust := &o.Types()[i]
+		oldTags[ust.Tag()] = ust
+		if named, ok := ust.Type().(*NamedUserType); ok {
+			oldNames[named.Name()] = ust.Tag()
+		}
+	}
+	newTags := make(map[uint64]*UnionSubtype)
+	for i := range n.Types() {
+		newTags[n.Types()[i].Tag()] = &n.Types()[i]
+	}
+
+	for i := range o.Types() {
+		ou := &o.Types()[i]
+		memberPath := path + ".(" + memberName(ou) + ")"
+		nu, ok := newTags[ou.Tag()]
+		if !ok {
+			c.add(memberPath, Breaking, ou.Pos(), Pos{},
+				"Member %s with tag %d removed", describe(ou.Type()), ou.Tag())
+			continue
+		}
+		on, oNamed := ou.Type().(*NamedUserType)
+		nn, nNamed := nu.Type().(*NamedUserType)
+		if oNamed && nNamed && on.Name() != nn.Name() {
+			if tag, ok := oldNames[nn.Name()]; ok {
+				c.add(memberPath, Breaking, ou.Pos(), nu.Pos(),
+					"Tag %d changed from %s to %s, which had tag %d",
+					ou.Tag(), on.Name(), nn.Name(), tag)
+				continue
+			}
+		}
+		c.compareType(memberPath, ou.Type(), nu.Type())
+	}
+	for i := range n.Types() {
+		nu := &n.Types()[i]
+		if _, ok := oldTags[nu.Tag()]; !ok {
+			c.add(path+".("+memberName(nu)+")", BackwardCompatible, Pos{}, nu.Pos(),
+				"Member %s added with tag %d", describe(nu.Type()), nu.Tag())
+		}
+	}
+}
+
+func memberName(ust *UnionSubtype) string {
+	if named, ok := ust.Type().(*NamedUserType); ok {
+		return named.Name()
+	}
+	return fmt.Sprintf("%d", ust.Tag())
+}
+
+func (c *comparer) compareEnum(path string, o, n *UserDefinedEnum) {
+	if o.Kind() != n.Kind() {
+		c.add(path, Breaking, o.Pos(), n.Pos(), "Enum type changed from %s to %s",
+			primitiveNames[o.Kind()], primitiveNames[n.Kind()])
+	}
+
+	oldNames := make(map[string]uint)
+	oldValues := make(map[uint]*EnumValue)
+	for i := range o.Values() {
+		ev := &o.Values()[i]
+		oldNames[ev.Name()] = ev.Value()
+		oldValues[ev.Value()] = ev
+	}
+	newNames := make(map[string]*EnumValue)
+	newValues := make(map[uint]*EnumValue)
+	for i := range n.Values() {
+		ev := &n.Values()[i]
+		newNames[ev.Name()] = ev
+		newValues[ev.Value()] = ev
+	}
+
+	for i := range o.Values() {
+		ov := &o.Values()[i]
+		valuePath := path + "." + ov.Name()
+		if nv, ok := newNames[ov.Name()]; ok {
+			if nv.Value() != ov.Value() {
+				c.add(valuePath, Breaking, ov.Pos(), nv.Pos(),
+					"Value of %s changed from %d to %d",
+					ov.Name(), ov.Value(), nv.Value())
+			}
+		} else if nv, ok := newValues[ov.Value()]; ok && !hasName(oldNames, nv.Name()) {
+			c.add(valuePath, WireCompatible, ov.Pos(), nv.Pos(),
+				"Value %d renamed from %s to %s", ov.Value(), ov.Name(), nv.Name())
+		} else {
+			c.add(valuePath, Breaking, ov.Pos(), Pos{},
+				"Value %s (%d) removed", ov.Name(), ov.Value())
+		}
+	}
+	for i := range n.Values() {
+		nv := &n.Values()[i]
+		if _, ok := oldNames[nv.Name()]; ok {
+			continue
+		}
+		if _, ok := oldValues[nv.Value()]; ok {
+			// Renamed, or reported with the value it replaces
+			continue
+		}
+		c.add(path+"."+nv.Name(), BackwardCompatible, Pos{}, nv.Pos(),
+			"Value %s (%d) added", nv.Name(), nv.Value())
+	}
+}
+
+func hasName(names map[string]uint, name string) bool {
+	_, ok := names[name]
+	return ok
+}
+
+// Returns a short description of a type for messages.
+func describe(ty Type) string {
+	switch ty.(type) {
+	case *StructType:
+		return "struct"
+	case *UnionType:
+		return "union"
+	}
+	return strings.Replace(FormatType(ty), "\n", " ", -1)
+}
@@ -0,0 +1,185 @@
+package schema
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func compare(t *testing.T, old, new string) []string {
+	o, err := Parse(strings.NewReader(old))
+	assert.NoError(t, err)
+	n, err := Parse(strings.NewReader(new))
+	assert.NoError(t, err)
+
+	var changes []string
+	for _, c := range Compare(o, n) {
+		changes = append(changes, c.String())
+	}
+	return changes
+}
+
+func TestCompareIdentical(t *testing.T) {
+	src := `
+		enum Color { RED GREEN }
+		type Node { value: Color children: []Node }
+		type Message (Node | u8)`
+	assert.Empty(t, compare(t, src, src))
+}
+
+func TestCompare(t *testing.T) {
+	changes := compare(t, `
+		enum Color u8 {
+			RED
+			GREEN
+			BLUE
+			CYAN
+		}
+		type Customer {
+			name: string
+			email: string
+			age: u32
+			key: data<16>
+			tags: [4]string
+		}
+		type Person (Customer | Employee | void)
+		type Employee { id: uint }
+		type Removed u8
+	`, `
+		enum Color u8 {
+			RED
+			VERDE
+			BLUE = 3
+			MAGENTA
+		}
+		type Customer {
+			email: string
+			name: string
+			age: u64
+			key: data<32>
+			tags: [8]string
+			extra: bool
+		}
+		type Person (Customer | Worker | void | string)
+		type Worker { id: uint }
+		type Added u8
+	`)
+	assert.Equal(t, []string{
+		"Color.GREEN: Value 1 renamed from GREEN to VERDE (wire-compatible)",
+		"Color.BLUE: Value of BLUE changed from 2 to 3 (breaking)",
+		"Color.CYAN: Value CYAN (3) removed (breaking)",
+		"Color.MAGENTA: Value MAGENTA (4) added (backward-compatible)",
+		"Customer.name: Field name moved from position 1 to 2 (breaking)",
+		"Customer.email: Field email moved from position 2 to 1 (breaking)",
+		"Customer.age: Type changed from u32 to u64 (breaking)",
+		"Customer.key: Type changed from data<16> to data<32> (breaking)",
+		"Customer.tags: Array length changed from 4 to 8 (breaking)",
+		"Customer.extra: Field extra added (breaking)",
+		"Person.(Employee): Type changed from Employee to Worker (wire-compatible)",
+		"Person.(3): Member string added with tag 3 (backward-compatible)",
+		"Employee: Type Employee removed (breaking)",
+		"Removed: Type Removed removed (breaking)",
+		"Worker: Type Worker added (wire-compatible)",
+		"Added: Type Added added (wire-compatible)",
+	}, changes)
+}
+
+func TestCompareMovedFields(t *testing.T) {
+	changes := compare(t, `
+		type Moved { a: u32 b: string }
+		type Swapped { a: u8 b: u16 }
+		type Replaced { a: u8 b: u16 }
+	`, `
+		type Moved { b: string a: u64 }
+		type Swapped { b: u16 a: u8 }
+		type Replaced { b: u16 c: bool }
+	`)
+	assert.Equal(t, []string{
+		"Moved.a: Field a moved from position 1 to 2 (breaking)",
+		"Moved.a: Type changed from u32 to u64 (breaking)",
+		"Moved.#1: Type changed from u32 to string (breaking)",
+		"Moved.b: Field b moved from position 2 to 1 (breaking)",
+		"Moved.#2: Type changed from string to u64 (breaking)",
+		"Swapped.a: Field a moved from position 1 to 2 (breaking)",
+		"Swapped.#1: Type changed from u8 to u16 (breaking)",
+		"Swapped.b: Field b moved from position 2 to 1 (breaking)",
+		"Swapped.#2: Type changed from u16 to u8 (breaking)",
+		"Replaced.a: Field a removed (breaking)",
+		"Replaced.#1: Type changed from u8 to u16 (breaking)",
+		"Replaced.b: Field b moved from position 2 to 1 (breaking)",
+		"Replaced.#2: Type changed from u16 to bool (breaking)",
+		"Replaced.c: Field c added (breaking)",
+	}, changes)
+}
+
+func TestCompareUnionTags(t *testing.T) {
+	changes := compare(t, `
+		type A { a: u8 }
+		type B { b: u8 }
+		type U (A | B)
+	`, `
+		type A { a: u8 }
+		type B { b: u8 }
+		type U (B | A)
+	`)
+	assert.Equal(t, []string{
+		"U.(A): Tag 0 changed from A to B, which had tag 1 (breaking)",
+		"U.(B): Tag 1 changed from B to A, which had tag 0 (breaking)",
+	}, changes)
+
+	changes = compare(t, `type U (u8 | string = 2)`, `type U (u8)`)
+	assert.Equal(t, []string{
+		"U.(2): Member string with tag 2 removed (breaking)",
+	}, changes)
+}
+
+func TestCompareNamedTypes(t *testing.T) {
+	changes := compare(t, `
+		enum Kind { A B }
+		type Time string
+		type Event {
+			kind: Kind
+			at: Time
+			next: optional<Event>
+			labels: map[string]Label
+		}
+		type Label { text: string }
+	`, `
+		type Kind uint
+		type Event {
+			kind: Kind
+			at: string
+			next: optional<Event>
+			labels: map[string]{ text: string }
+		}
+	`)
+	assert.Equal(t, []string{
+		"Kind: Type changed from enum Kind to uint (wire-compatible)",
+		"Time: Type Time removed (breaking)",
+		"Label: Type Label removed (breaking)",
+	}, changes)
+
+	changes = compare(t, `
+		type Event { kind: Kind }
+		enum Kind u8 { A }
+	`, `
+		type Event { kind: u16 }
+	`)
+	assert.Equal(t, []string{
+		"Event.kind: Type changed from enum Kind to u16 (breaking)",
+		"Kind: Type Kind removed (breaking)",
+	}, changes)
+}
+
+func TestOverall(t *testing.T) {
+	assert.Equal(t, WireCompatible, Overall(nil))
+	assert.Equal(t, BackwardCompatible, Overall([]Change{
+		{Compatibility: WireCompatible},
+		{Compatibility: BackwardCompatible},
+	}))
+	assert.Equal(t, Breaking, Overall([]Change{
+		{Compatibility: Breaking},
+		{Compatibility: BackwardCompatible},
+	}))
+}
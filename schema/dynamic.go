@@ -0,0 +1,674 @@
+package schema
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+
+	bare "git.sr.ht/~runxiyu/go-bareish"
+)
+
+// Returned when a dynamic value cannot be decoded or encoded according to a
+// schema. It describes the value which failed and wraps the underlying error.
+type ValueError struct {
+	// Path to the value from the root type, made of schema type names,
+	// struct field names, indices and union tags, e.g.
+	// "Customer.orders[3].quantity"
+	Path string
+	// Offset of the value from the start of the input, in bytes, or -1 if
+	// the error occurred while encoding
+	Offset int64
+	// The underlying error
+	Err error
+}
+
+func (e *ValueError) Error() string {
+	if e.Offset < 0 {
+		return fmt.Sprintf("%s: %s", e.Path, e.Err.Error())
+	}
+	return fmt.Sprintf("%s: at offset %d: %s", e.Path, e.Offset, e.Err.Error())
+}
+
+func (e *ValueError) Unwrap() error {
+	return e.Err
+}
+
+func wrapValueError(err error, seg string, offset int64) error {
+	if ve, ok := err.(*ValueError); ok {
+		ve.Path = seg + ve.Path
+		return ve
+	}
+	return &ValueError{Path: seg, Offset: offset, Err: err}
+}
+
+// Decodes a message of the named user-defined type from data, according to
+// the given schema types rather than a Go type. Like bare.Unmarshal with
+// DisallowTrailingData, it returns a *bare.TrailingDataError if data does not
+// end with the message; use ReadDynamic to decode a prefix of the input.
+func DecodeDynamic(types []SchemaType, root string, data []byte) (Value, error) {
+	r := bare.NewBytesReader(data)
+	v, err := ReadDynamic(r, types, root)
+	if err != nil {
+		return nil, err
+	}
+	if n := r.Offset(); n < int64(len(data)) {
+		return nil, &bare.TrailingDataError{Offset: n, Bytes: int64(len(data)) - n}
+	}
+	return v, nil
+}
+
+// Encodes a value of the named user-defined type according to the given
+// schema types. See DecodeDynamic.
+func EncodeDynamic(types []SchemaType, root string, val Value) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := WriteDynamic(bare.NewWriter(&buf), types, root, val); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Reads a message of the named user-defined type from a bare.Reader. The
+// limits configured on the reader apply to each message separately. See
+// DecodeDynamic.
+func ReadDynamic(r *bare.Reader, types []SchemaType, root string) (Value, error) {
+	r.BeginMessage()
+	d := newDynamic(types)
+	offset := r.Offset()
+	st, err := d.Lookup(root)
+	if err != nil {
+		return nil, wrapValueError(err, root, offset)
+	}
+	v, err := d.decodeSchemaType(r, st)
+	if err != nil {
+		return nil, wrapValueError(err, root, offset)
+	}
+	return v, nil
+}
+
+// Writes a value of the named user-defined type to a bare.Writer. See
+// EncodeDynamic.
+func WriteDynamic(w *bare.Writer, types []SchemaType, root string, val Value) error {
+	d := newDynamic(types)
+	st, err := d.Lookup(root)
+	if err != nil {
+		return wrapValueError(err, root, -1)
+	}
+	if err := d.encodeSchemaType(w, st, val); err != nil {
+		return wrapValueError(err, root, -1)
+	}
+	return nil
+}
+
+// Looks up the user-defined types of a schema by name, and resolves the named
+// user types which refer to them.
+type Resolver struct {
+	types map[string]SchemaType
+}
+
+// Returns a resolver for references to the given user-defined types, which
+// should have passed Check: a resolver only reports the errors it comes across
+// while resolving a type.
+func NewResolver(types []SchemaType) *Resolver {
+	r := &Resolver{types: make(map[string]SchemaType, len(types))}
+	for _, st := range types {
+		r.types[st.Name()] = st
+	}
+	return r
+}
+
+// Returns the user-defined type with the given name.
+func (r *Resolver) Lookup(name string) (SchemaType, error) {
+	st, ok := r.types[name]
+	if !ok {
+		return nil, fmt.Errorf("Unknown user type %s", name)
+	}
+	return st, nil
+}
+
+// Follows named user types, through any number of aliases, to the first type
+// which is not one. If they lead to an enum, it is returned instead. Exactly
+// one of the returned type and enum is non-nil unless there is an error.
+func (r *Resolver) Resolve(ty Type) (Type, *UserDefinedEnum, error) {
+	for n := 0; n <= len(r.types); n++ {
+		named, ok := ty.(*NamedUserType)
+		if !ok {
+			return ty, nil, nil
+		}
+		st, err := r.Lookup(named.Name())
+		if err != nil {
+			return nil, nil, err
+		}
+		switch st := st.(type) {
+		case *UserDefinedEnum:
+			return nil, st, nil
+		case *UserDefinedType:
+			ty = st.Type()
+		default:
+			return nil, nil, fmt.Errorf("Unsupported schema type %T", st)
+		}
+	}
+	return nil, nil, fmt.Errorf("Cyclic type alias %s", ty.(*NamedUserType).Name())
+}
+
+type dynamic struct {
+	*Resolver
+}
+
+func newDynamic(types []SchemaType) *dynamic {
+	return &dynamic{NewResolver(types)}
+}
+
+func (d *dynamic) decodeSchemaType(r *bare.Reader, st SchemaType) (Value, error) {
+	switch st := st.(type) {
+	case *UserDefinedType:
+		return d.decode(r, st.Type())
+	case *UserDefinedEnum:
+		return decodeEnum(r, st)
+	}
+	return nil, fmt.Errorf("Unsupported schema type %T", st)
+}
+
+func (d *dynamic) decode(r *bare.Reader, ty Type) (Value, error) {
+	switch ty := ty.(type) {
+	case *PrimitiveType:
+		return decodePrimitive(r, ty.Kind())
+	case *DataType:
+		if ty.Length() == 0 {
+			data, err := r.ReadData()
+			return DataValue(data), err
+		}
+		data := make([]byte, ty.Length())
+		err := r.ReadDataFixed(data)
+		return DataValue(data), err
+	case *OptionalType:
+		return d.decodeOptional(r, ty)
+	case *ArrayType:
+		return d.decodeList(r, ty)
+	case *MapType:
+		return d.decodeMap(r, ty)
+	case *UnionType:
+		return d.decodeUnion(r, ty)
+	case *StructType:
+		return d.decodeStruct(r, ty)
+	case *NamedUserType:
+		st, err := d.Lookup(ty.Name())
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeSchemaType(r, st)
+	}
+	return nil, fmt.Errorf("Unsupported type %T", ty)
+}
+
+func decodePrimitive(r *bare.Reader, kind TypeKind) (Value, error) {
+	switch kind {
+	case UINT:
+		v, err := r.ReadUint()
+		return UintValue(v), err
+	case U8:
+		v, err := r.ReadU8()
+		return UintValue(v), err
+	case U16:
+		v, err := r.ReadU16()
+		return UintValue(v), err
+	case U32:
+		v, err := r.ReadU32()
+		return UintValue(v), err
+	case U64:
+		v, err := r.ReadU64()
+		return UintValue(v), err
+	case INT:
+		v, err := r.ReadInt()
+		return IntValue(v), err
+	case I8:
+		v, err := r.ReadI8()
+		return IntValue(v), err
+	case I16:
+		v, err := r.ReadI16()
+		return IntValue(v), err
+	case I32:
+		v, err := r.ReadI32()
+		return IntValue(v), err
+	case I64:
+		v, err := r.ReadI64()
+		return IntValue(v), err
+	case F32:
+		v, err := r.ReadF32()
+		return FloatValue(v), err
+	case F64:
+		v, err := r.ReadF64()
+		return FloatValue(v), err
+	case Bool:
+		v, err := r.ReadBool()
+		return BoolValue(v), err
+	case String:
+		v, err := r.ReadString()
+		return StringValue(v), err
+	case Void:
+		return VoidValue{}, nil
+	}
+	return nil, fmt.Errorf("Unsupported primitive type %s", kind)
+}
+
+func decodeEnum(r *bare.Reader, ude *UserDefinedEnum) (Value, error) {
+	v, err := decodePrimitive(r, ude.Kind())
+	if err != nil {
+		return nil, err
+	}
+	value := uint(v.(UintValue))
+	for _, ev := range ude.Values() {
+		if ev.Value() == value {
+			return UserEnumValue{Name: ev.Name(), Value: value}, nil
+		}
+	}
+	// Values not listed in the schema are kept without a name
+	return UserEnumValue{Value: value}, nil
+}
+
+func (d *dynamic) decodeOptional(r *bare.Reader, ty *OptionalType) (Value, error) {
+	if err := r.Enter(); err != nil {
+		return nil, err
+	}
+	defer r.Leave()
+
+	ok, err := r.ReadOptional()
+	if err != nil || !ok {
+		return OptionalValue{}, err
+	}
+	offset := r.Offset()
+	v, err := d.decode(r, ty.Subtype())
+	if err != nil {
+		return nil, wrapValueError(err, "", offset)
+	}
+	return OptionalValue{Value: v}, nil
+}
+
+func (d *dynamic) decodeList(r *bare.Reader, ty *ArrayType) (Value, error) {
+	if err := r.Enter(); err != nil {
+		return nil, err
+	}
+	defer r.Leave()
+
+	n := uint64(ty.Length())
+	if n == 0 {
+		var err error
+		if n, err = r.ReadArrayLength(); err != nil {
+			return nil, err
+		}
+	} else if err := r.Allocate(n); err != nil {
+		return nil, err
+	}
+	list := make(ListValue, 0, n)
+	for i := uint64(0); i < n; i++ {
+		offset := r.Offset()
+		v, err := d.decode(r, ty.Member())
+		if err != nil {
+			return nil, wrapValueError(err, fmt.Sprintf("[%d]", i), offset)
+		}
+		list = append(list, v)
+	}
+	return list, nil
+}
+
+func (d *dynamic) decodeMap(r *bare.Reader, ty *MapType) (Value, error) {
+	if err := r.Enter(); err != nil {
+		return nil, err
+	}
+	defer r.Leave()
+
+	n, err := r.ReadMapSize()
+	if err != nil {
+		return nil, err
+	}
+	m := make(MapValue, 0, n)
+	seen := make(map[Value]struct{}, n)
+	for i := uint64(0); i < n; i++ {
+		offset := r.Offset()
+		k, err := d.decode(r, ty.Key())
+		if err != nil {
+			return nil, wrapValueError(err, fmt.Sprintf("[#%d]", i), offset)
+		}
+		seg := keySegment(k, i)
+		if isScalar(k) {
+			if _, ok := seen[k]; ok {
+				return nil, wrapValueError(
+					errors.New("Duplicate map key"), seg, offset)
+			}
+			seen[k] = struct{}{}
+		}
+		offset = r.Offset()
+		v, err := d.decode(r, ty.Value())
+		if err != nil {
+			return nil, wrapValueError(err, seg, offset)
+		}
+		m = append(m, MapEntry{Key: k, Value: v})
+	}
+	return m, nil
+}
+
+func (d *dynamic) decodeUnion(r *bare.Reader, ty *UnionType) (Value, error) {
+	if err := r.Enter(); err != nil {
+		return nil, err
+	}
+	defer r.Leave()
+
+	tag, err := r.ReadUint()
+	if err != nil {
+		return nil, err
+	}
+	for _, ust := range ty.Types() {
+		if ust.Tag() != tag {
+			continue
+		}
+		offset := r.Offset()
+		v, err := d.decode(r, ust.Type())
+		if err != nil {
+			return nil, wrapValueError(err, unionSegment(ust), offset)
+		}
+		return UnionValue{Tag: tag, Value: v}, nil
+	}
+	return nil, fmt.Errorf("Invalid union tag %d", tag)
+}
+
+func (d *dynamic) decodeStruct(r *bare.Reader, ty *StructType) (Value, error) {
+	if err := r.Enter(); err != nil {
+		return nil, err
+	}
+	defer r.Leave()
+
+	sv := make(StructValue, 0, len(ty.Fields()))
+	for _, field := range ty.Fields() {
+		offset := r.Offset()
+		v, err := d.decode(r, field.Type())
+		if err != nil {
+			return nil, wrapValueError(err, "."+field.Name(), offset)
+		}
+		sv = append(sv, FieldValue{Name: field.Name(), Value: v})
+	}
+	return sv, nil
+}
+
+func (d *dynamic) encodeSchemaType(w *bare.Writer, st SchemaType, val Value) error {
+	switch st := st.(type) {
+	case *UserDefinedType:
+		return d.encode(w, st.Type(), val)
+	case *UserDefinedEnum:
+		return encodeEnum(w, st, val)
+	}
+	return fmt.Errorf("Unsupported schema type %T", st)
+}
+
+func (d *dynamic) encode(w *bare.Writer, ty Type, val Value) error {
+	switch ty := ty.(type) {
+	case *PrimitiveType:
+		return encodePrimitive(w, ty.Kind(), val)
+	case *DataType:
+		data, ok := val.(DataValue)
+		if !ok {
+			return unexpectedValue("data", val)
+		}
+		if ty.Length() == 0 {
+			return w.WriteData(data)
+		}
+		if uint(len(data)) != ty.Length() {
+			return fmt.Errorf("Expected %d bytes of data, got %d",
+				ty.Length(), len(data))
+		}
+		return w.WriteDataFixed(data)
+	case *OptionalType:
+		return d.encodeOptional(w, ty, val)
+	case *ArrayType:
+		return d.encodeList(w, ty, val)
+	case *MapType:
+		return d.encodeMap(w, ty, val)
+	case *UnionType:
+		return d.encodeUnion(w, ty, val)
+	case *StructType:
+		return d.encodeStruct(w, ty, val)
+	case *NamedUserType:
+		st, err := d.Lookup(ty.Name())
+		if err != nil {
+			return err
+		}
+		return d.encodeSchemaType(w, st, val)
+	}
+	return fmt.Errorf("Unsupported type %T", ty)
+}
+
+func encodePrimitive(w *bare.Writer, kind TypeKind, val Value) error {
+	switch kind {
+	case UINT, U8, U16, U32, U64:
+		v, ok := val.(UintValue)
+		if !ok {
+			return unexpectedValue("uint", val)
+		}
+		switch kind {
+		case UINT:
+			return w.WriteUint(uint64(v))
+		case U8:
+			if v > math.MaxUint8 {
+				return outOfRange(val, kind)
+			}
+			return w.WriteU8(uint8(v))
+		case U16:
+			if v > math.MaxUint16 {
+				return outOfRange(val, kind)
+			}
+			return w.WriteU16(uint16(v))
+		case U32:
+			if v > math.MaxUint32 {
+				return outOfRange(val, kind)
+			}
+			return w.WriteU32(uint32(v))
+		}
+		return w.WriteU64(uint64(v))
+	case INT, I8, I16, I32, I64:
+		v, ok := val.(IntValue)
+		if !ok {
+			return unexpectedValue("int", val)
+		}
+		switch kind {
+		case INT:
+			return w.WriteInt(int64(v))
+		case I8:
+			if v < math.MinInt8 || v > math.MaxInt8 {
+				return outOfRange(val, kind)
+			}
+			return w.WriteI8(int8(v))
+		case I16:
+			if v < math.MinInt16 || v > math.MaxInt16 {
+				return outOfRange(val, kind)
+			}
+			return w.WriteI16(int16(v))
+		case I32:
+			if v < math.MinInt32 || v > math.MaxInt32 {
+				return outOfRange(val, kind)
+			}
+			return w.WriteI32(int32(v))
+		}
+		return w.WriteI64(int64(v))
+	case F32, F64:
+		v, ok := val.(FloatValue)
+		if !ok {
+			return unexpectedValue("float", val)
+		}
+		if kind == F32 {
+			return w.WriteF32(float32(v))
+		}
+		return w.WriteF64(float64(v))
+	case Bool:
+		v, ok := val.(BoolValue)
+		if !ok {
+			return unexpectedValue("bool", val)
+		}
+		return w.WriteBool(bool(v))
+	case String:
+		v, ok := val.(StringValue)
+		if !ok {
+			return unexpectedValue("string", val)
+		}
+		return w.WriteString(string(v))
+	case Void:
+		if _, ok := val.(VoidValue); !ok {
+			return unexpectedValue("void", val)
+		}
+		return nil
+	}
+	return fmt.Errorf("Unsupported primitive type %s", kind)
+}
+
+func encodeEnum(w *bare.Writer, ude *UserDefinedEnum, val Value) error {
+	v, ok := val.(UserEnumValue)
+	if !ok {
+		return unexpectedValue("enum", val)
+	}
+	value := v.Value
+	if v.Name != "" {
+		found := false
+		for _, ev := range ude.Values() {
+			if ev.Name() == v.Name {
+				value = ev.Value()
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("Unknown value %s for enum %s", v.Name, ude.Name())
+		}
+	}
+	return encodePrimitive(w, ude.Kind(), UintValue(value))
+}
+
+func (d *dynamic) encodeOptional(w *bare.Writer, ty *OptionalType, val Value) error {
+	v, ok := val.(OptionalValue)
+	if !ok {
+		return unexpectedValue("optional", val)
+	}
+	if v.Value == nil {
+		return w.WriteU8(0)
+	}
+	if err := w.WriteU8(1); err != nil {
+		return err
+	}
+	if err := d.encode(w, ty.Subtype(), v.Value); err != nil {
+		return wrapValueError(err, "", -1)
+	}
+	return nil
+}
+
+func (d *dynamic) encodeList(w *bare.Writer, ty *ArrayType, val Value) error {
+	list, ok := val.(ListValue)
+	if !ok {
+		return unexpectedValue("list", val)
+	}
+	if ty.Length() == 0 {
+		if err := w.WriteUint(uint64(len(list))); err != nil {
+			return err
+		}
+	} else if uint(len(list)) != ty.Length() {
+		return fmt.Errorf("Expected %d list items, got %d",
+			ty.Length(), len(list))
+	}
+	for i, v := range list {
+		if err := d.encode(w, ty.Member(), v); err != nil {
+			return wrapValueError(err, fmt.Sprintf("[%d]", i), -1)
+		}
+	}
+	return nil
+}
+
+func (d *dynamic) encodeMap(w *bare.Writer, ty *MapType, val Value) error {
+	m, ok := val.(MapValue)
+	if !ok {
+		return unexpectedValue("map", val)
+	}
+	if err := w.WriteUint(uint64(len(m))); err != nil {
+		return err
+	}
+	for i, entry := range m {
+		if err := d.encode(w, ty.Key(), entry.Key); err != nil {
+			return wrapValueError(err, fmt.Sprintf("[#%d]", i), -1)
+		}
+		if err := d.encode(w, ty.Value(), entry.Value); err != nil {
+			return wrapValueError(err, keySegment(entry.Key, uint64(i)), -1)
+		}
+	}
+	return nil
+}
+
+func (d *dynamic) encodeUnion(w *bare.Writer, ty *UnionType, val Value) error {
+	v, ok := val.(UnionValue)
+	if !ok {
+		return unexpectedValue("union", val)
+	}
+	for _, ust := range ty.Types() {
+		if ust.Tag() != v.Tag {
+			continue
+		}
+		if err := w.WriteUint(v.Tag); err != nil {
+			return err
+		}
+		if err := d.encode(w, ust.Type(), v.Value); err != nil {
+			return wrapValueError(err, unionSegment(ust), -1)
+		}
+		return nil
+	}
+	return fmt.Errorf("Invalid union tag %d", v.Tag)
+}
+
+func (d *dynamic) encodeStruct(w *bare.Writer, ty *StructType, val Value) error {
+	sv, ok := val.(StructValue)
+	if !ok {
+		return unexpectedValue("struct", val)
+	}
+	for _, field := range ty.Fields() {
+		v, ok := sv.Field(field.Name())
+		if !ok {
+			return wrapValueError(errors.New("Missing struct field"),
+				"."+field.Name(), -1)
+		}
+		if err := d.encode(w, field.Type(), v); err != nil {
+			return wrapValueError(err, "."+field.Name(), -1)
+		}
+	}
+	return nil
+}
+
+func unexpectedValue(expected string, val Value) error {
+	return fmt.Errorf("Expected %s value, got %T", expected, val)
+}
+
+func outOfRange(val Value, kind TypeKind) error {
+	return fmt.Errorf("Value %v out of range for %s", val, kind)
+}
+
+func isScalar(val Value) bool {
+	switch val.(type) {
+	case UintValue, IntValue, FloatValue, BoolValue, StringValue, UserEnumValue:
+		return true
+	}
+	return false
+}
+
+func keySegment(key Value, i uint64) string {
+	switch key := key.(type) {
+	case StringValue:
+		return fmt.Sprintf("[%q]", string(key))
+	case UintValue, IntValue, FloatValue, BoolValue:
+		return fmt.Sprintf("[%v]", key)
+	case UserEnumValue:
+		if key.Name != "" {
+			return fmt.Sprintf("[%s]", key.Name)
+		}
+		return fmt.Sprintf("[%d]", key.Value)
+	}
+	return fmt.Sprintf("[#%d]", i)
+}
+
+func unionSegment(ust UnionSubtype) string {
+	if named, ok := ust.Type().(*NamedUserType); ok {
+		return fmt.Sprintf(".(%s)", named.Name())
+	}
+	return fmt.Sprintf(".(%d)", ust.Tag())
+}
@@ -0,0 +1,228 @@
+package schema
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	bare "git.sr.ht/~runxiyu/go-bareish"
+)
+
+const dynamicSchema = `
+	enum Color {
+		RED
+		GREEN
+		BLUE = 5
+	}
+
+	type Point {
+		x: i8
+		y: u16
+	}
+
+	type Shape {
+		name: string
+		color: Color
+		points: []Point
+		tags: map[string]optional<data<2>>
+		extra: (Point | string = 4 | void)
+	}
+
+	type Tree {
+		value: uint
+		children: []Tree
+	}
+`
+
+var dynamicPayload = []byte{
+	0x03, 0x61, 0x62, 0x63, // name
+	0x05,             // color
+	0x02,             // points
+	0xFF, 0x01, 0x00, // {-1, 1}
+	0x02, 0x00, 0x01, // {2, 256}
+	0x02,                         // tags
+	0x01, 0x61, 0x01, 0x13, 0x37, // "a": 0x1337
+	0x01, 0x62, 0x00, // "b": nil
+	0x04, 0x01, 0x7A, // extra
+}
+
+var dynamicValue = StructValue{
+	{"name", StringValue("abc")},
+	{"color", UserEnumValue{Name: "BLUE", Value: 5}},
+	{"points", ListValue{
+		StructValue{{"x", IntValue(-1)}, {"y", UintValue(1)}},
+		StructValue{{"x", IntValue(2)}, {"y", UintValue(256)}},
+	}},
+	{"tags", MapValue{
+		{StringValue("a"), OptionalValue{DataValue{0x13, 0x37}}},
+		{StringValue("b"), OptionalValue{}},
+	}},
+	{"extra", UnionValue{Tag: 4, Value: StringValue("z")}},
+}
+
+func parseDynamicSchema(t *testing.T) []SchemaType {
+	types, err := Parse(strings.NewReader(dynamicSchema))
+	assert.NoError(t, err)
+	return types
+}
+
+func TestDecodeDynamic(t *testing.T) {
+	types := parseDynamicSchema(t)
+
+	val, err := DecodeDynamic(types, "Shape", dynamicPayload)
+	assert.NoError(t, err)
+	assert.Equal(t, dynamicValue, val)
+
+	name, ok := val.(StructValue).Field("name")
+	assert.True(t, ok)
+	assert.Equal(t, StringValue("abc"), name)
+
+	val, err = DecodeDynamic(types, "Color", []byte{0x01})
+	assert.NoError(t, err)
+	assert.Equal(t, UserEnumValue{Name: "GREEN", Value: 1}, val)
+
+	val, err = DecodeDynamic(types, "Color", []byte{0x02})
+	assert.NoError(t, err)
+	assert.Equal(t, UserEnumValue{Value: 2}, val)
+}
+
+func TestDecodeDynamicRecursive(t *testing.T) {
+	types := parseDynamicSchema(t)
+
+	val, err := DecodeDynamic(types, "Tree", []byte{0x01, 0x01, 0x02, 0x00})
+	assert.NoError(t, err)
+	assert.Equal(t, StructValue{
+		{"value", UintValue(1)},
+		{"children", ListValue{
+			StructValue{{"value", UintValue(2)}, {"children", ListValue{}}},
+		}},
+	}, val)
+}
+
+func TestDecodeDynamicErrors(t *testing.T) {
+	types := parseDynamicSchema(t)
+
+	_, err := DecodeDynamic(types, "Unknown", dynamicPayload)
+	assert.EqualError(t, err, "Unknown: at offset 0: Unknown user type Unknown")
+
+	payload := append([]byte{}, dynamicPayload...)
+	payload[len(payload)-3] = 0x03
+	_, err = DecodeDynamic(types, "Shape", payload)
+	var ve *ValueError
+	assert.True(t, errors.As(err, &ve))
+	assert.Equal(t, "Shape.extra", ve.Path)
+	assert.Equal(t, int64(len(payload)-3), ve.Offset)
+	assert.EqualError(t, ve.Err, "Invalid union tag 3")
+
+	payload = append([]byte{}, dynamicPayload...)
+	payload[19] = 0x61
+	_, err = DecodeDynamic(types, "Shape", payload)
+	assert.EqualError(t, err, `Shape.tags["a"]: at offset 18: Duplicate map key`)
+
+	// The offset is that of the start of the value
+	types, err = Parse(strings.NewReader(`type Flag optional<bool>`))
+	assert.NoError(t, err)
+	_, err = DecodeDynamic(types, "Flag", []byte{0x01, 0x02})
+	assert.EqualError(t, err, "Flag: at offset 1: Invalid bool value: 0x2")
+
+	types = parseDynamicSchema(t)
+	_, err = DecodeDynamic(types, "Shape", append(dynamicPayload, 0x00, 0x00))
+	assert.True(t, errors.Is(err, bare.ErrTrailingData))
+	assert.EqualError(t, err, fmt.Sprintf(
+		"2 bytes of trailing data after message at offset %d", len(dynamicPayload)))
+}
+
+func TestEncodeDynamic(t *testing.T) {
+	types := parseDynamicSchema(t)
+
+	data, err := EncodeDynamic(types, "Shape", dynamicValue)
+	assert.NoError(t, err)
+	assert.Equal(t, dynamicPayload, data)
+
+	data, err = EncodeDynamic(types, "Color", UserEnumValue{Name: "GREEN"})
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x01}, data)
+}
+
+func TestEncodeDynamicErrors(t *testing.T) {
+	types := parseDynamicSchema(t)
+
+	_, err := EncodeDynamic(types, "Point", StructValue{
+		{"x", IntValue(200)}, {"y", UintValue(1)},
+	})
+	assert.EqualError(t, err, "Point.x: Value 200 out of range for I8")
+
+	_, err = EncodeDynamic(types, "Point", StructValue{{"x", IntValue(1)}})
+	assert.EqualError(t, err, "Point.y: Missing struct field")
+
+	_, err = EncodeDynamic(types, "Point", ListValue{})
+	assert.EqualError(t, err, "Point: Expected struct value, got schema.ListValue")
+
+	_, err = EncodeDynamic(types, "Color", UserEnumValue{Name: "PURPLE"})
+	assert.EqualError(t, err, "Color: Unknown value PURPLE for enum Color")
+}
+
+func TestResolver(t *testing.T) {
+	types := []SchemaType{
+		NewUserDefinedType("A", NewNamedUserType("B")),
+		NewUserDefinedType("B", NewNamedUserType("Color")),
+		NewUserDefinedEnum("Color", UINT, []EnumValue{NewEnumValue("RED", 0)}),
+		NewUserDefinedType("List", NewArrayType(NewNamedUserType("A"), 0)),
+		NewUserDefinedType("X", NewNamedUserType("Y")),
+		NewUserDefinedType("Y", NewNamedUserType("X")),
+	}
+	r := NewResolver(types)
+
+	st, err := r.Lookup("List")
+	assert.NoError(t, err)
+	assert.Equal(t, types[3], st)
+	_, err = r.Lookup("Missing")
+	assert.EqualError(t, err, "Unknown user type Missing")
+
+	ty, enum, err := r.Resolve(NewNamedUserType("A"))
+	assert.NoError(t, err)
+	assert.Nil(t, ty)
+	assert.Equal(t, types[2], enum)
+
+	ty, enum, err = r.Resolve(NewNamedUserType("List"))
+	assert.NoError(t, err)
+	assert.Nil(t, enum)
+	assert.Equal(t, "[]A", FormatType(ty))
+
+	_, _, err = r.Resolve(NewNamedUserType("X"))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Cyclic type alias")
+}
+
+func TestReadDynamicMessages(t *testing.T) {
+	types, err := Parse(strings.NewReader(`
+		type Pair [2]u8
+		type List []u8
+	`))
+	assert.NoError(t, err)
+
+	// The limits apply to each message separately
+	r := bare.DecodeOptions{MaxElements: 3}.NewBytesReader([]byte{
+		0x01, 0x02, 0x02, 0x03, 0x04, 0x02, 0x05, 0x06,
+	})
+	val, err := ReadDynamic(r, types, "Pair")
+	assert.NoError(t, err)
+	assert.Equal(t, ListValue{UintValue(1), UintValue(2)}, val)
+	for _, expected := range []Value{
+		ListValue{UintValue(3), UintValue(4)},
+		ListValue{UintValue(5), UintValue(6)},
+	} {
+		val, err = ReadDynamic(r, types, "List")
+		assert.NoError(t, err)
+		assert.Equal(t, expected, val)
+	}
+
+	// Fixed-length lists count towards them too
+	r = bare.DecodeOptions{MaxElements: 1}.NewBytesReader([]byte{0x01, 0x02})
+	_, err = ReadDynamic(r, types, "Pair")
+	assert.EqualError(t, err,
+		"Pair: at offset 0: Total element count exceeds configured limit of 1")
+}
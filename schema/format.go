@@ -0,0 +1,477 @@
+package schema
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// The syntax used to write a schema. Parse accepts both.
+type Dialect int
+
+const (
+	// The syntax of the draft specification, which this package has always
+	// used: enum Name u8 { .. }, (A | B), [N]T, data<N>, map[K]V, string
+	DraftDialect Dialect = iota
+	// The syntax of the final specification: type Name enum { .. },
+	// union { A | B }, list<T>[N], data[N], map<K><V>, str
+	FinalDialect
+)
+
+// Options for formatting schemas. The zero value formats in the draft
+// dialect.
+type FormatOptions struct {
+	Dialect Dialect
+}
+
+// Writes a schema in the canonical form of the draft dialect. See
+// FormatOptions.Format.
+func Format(w io.Writer, types []SchemaType) error {
+	return FormatOptions{}.Format(w, types)
+}
+
+// Writes a schema as a schema language document which Parse reads back to the
+// same types. The output is indented with tabs, has a blank line between
+// declarations, and gives enum values and union tags explicitly only where
+// they do not follow from the previous one.
+//
+// The comments of the types, if they were parsed from a document, are written
+// back next to the same declarations, fields, enum values and union members,
+// along with single blank lines which separated them.
+func (o FormatOptions) Format(w io.Writer, types []SchemaType) error {
+	p := &printer{opts: o, suppress: true}
+	for i, st := range types {
+		if i > 0 {
+			p.buf.WriteByte('\n')
+			p.suppress = true
+		}
+		if err := p.schemaType(st); err != nil {
+			return err
+		}
+	}
+	_, err := w.Write(p.buf.Bytes())
+	return err
+}
+
+// Returns a type as it is written in the draft dialect, without comments.
+func FormatType(ty Type) string {
+	p := &printer{}
+	if err := p.typ(ty); err != nil {
+		return "?"
+	}
+	return p.buf.String()
+}
+
+type printer struct {
+	opts   FormatOptions
+	buf    bytes.Buffer
+	indent int
+
+	// Comments of the current declaration which are not written yet
+	comments []Comment
+	// Source line of the last node written on the current line, and the last
+	// source line written completely
+	line, lastLine int
+	// Offset in buf of the start of the current line
+	lineStart int
+	// Whether a blank line must not be added before the next line, because it
+	// follows an opening brace or another blank line
+	suppress bool
+}
+
+func (p *printer) schemaType(st SchemaType) error {
+	switch st := st.(type) {
+	case *UserDefinedType:
+		p.comments = st.Comments()
+		p.begin(st.Pos(), true)
+		fmt.Fprintf(&p.buf, "type %s ", st.Name())
+		if err := p.typ(st.Type()); err != nil {
+			return err
+		}
+	case *UserDefinedEnum:
+		p.comments = st.Comments()
+		if err := p.enum(st); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("Unknown schema type %T", st)
+	}
+	p.hoist()
+	p.newline(Pos{})
+
+	// Comments at the end of the document
+	for _, c := range p.comments {
+		p.comment(c)
+	}
+	p.comments = nil
+	return nil
+}
+
+func (p *printer) enum(ude *UserDefinedEnum) error {
+	p.begin(ude.Pos(), true)
+	if p.opts.Dialect == FinalDialect {
+		if ude.Kind() != UINT {
+			return fmt.Errorf("Enum %s of type %s cannot be written in the final dialect",
+				ude.Name(), primitiveNames[ude.Kind()])
+		}
+		fmt.Fprintf(&p.buf, "type %s enum {", ude.Name())
+	} else if ude.Kind() != UINT {
+		fmt.Fprintf(&p.buf, "enum %s %s {", ude.Name(), primitiveNames[ude.Kind()])
+	} else {
+		fmt.Fprintf(&p.buf, "enum %s {", ude.Name())
+	}
+	values := ude.Values()
+	following := func(i int) Pos {
+		if i < len(values) {
+			return values[i].Pos()
+		}
+		return ude.end
+	}
+	p.open(following(0))
+
+	var next uint
+	for i, ev := range values {
+		p.begin(ev.Pos(), true)
+		p.buf.WriteString(ev.Name())
+		if ev.Value() != next {
+			fmt.Fprintf(&p.buf, " = %d", ev.Value())
+		}
+		next = ev.Value() + 1
+		p.newline(following(i + 1))
+	}
+
+	p.close(ude.end, "}")
+	return nil
+}
+
+func (p *printer) typ(ty Type) error {
+	final := p.opts.Dialect == FinalDialect
+	// Types may span several lines in the source, e.g. the key and value of
+	// a map, and comments after them belong at the end of the line
+	p.mark(typePos(ty))
+	switch ty := ty.(type) {
+	case *PrimitiveType:
+		name, ok := primitiveNames[ty.Kind()]
+		if !ok {
+			return fmt.Errorf("Unknown primitive type %s", ty.Kind())
+		}
+		if final && ty.Kind() == String {
+			name = "str"
+		}
+		p.buf.WriteString(name)
+	case *DataType:
+		switch {
+		case ty.Length() == 0:
+			p.buf.WriteString("data")
+		case final:
+			fmt.Fprintf(&p.buf, "data[%d]", ty.Length())
+		default:
+			fmt.Fprintf(&p.buf, "data<%d>", ty.Length())
+		}
+	case *OptionalType:
+		p.buf.WriteString("optional<")
+		if err := p.typ(ty.Subtype()); err != nil {
+			return err
+		}
+		p.buf.WriteString(">")
+	case *ArrayType:
+		if final {
+			p.buf.WriteString("list<")
+			if err := p.typ(ty.Member()); err != nil {
+				return err
+			}
+			p.buf.WriteString(">")
+			if ty.Length() != 0 {
+				fmt.Fprintf(&p.buf, "[%d]", ty.Length())
+			}
+			break
+		}
+		if ty.Length() == 0 {
+			p.buf.WriteString("[]")
+		} else {
+			fmt.Fprintf(&p.buf, "[%d]", ty.Length())
+		}
+		return p.typ(ty.Member())
+	case *MapType:
+		open, middle, close := "map[", "]", ""
+		if final {
+			open, middle, close = "map<", "><", ">"
+		}
+		p.buf.WriteString(open)
+		if err := p.typ(ty.Key()); err != nil {
+			return err
+		}
+		p.buf.WriteString(middle)
+		if err := p.typ(ty.Value()); err != nil {
+			return err
+		}
+		p.buf.WriteString(close)
+	case *UnionType:
+		return p.union(ty)
+	case *StructType:
+		return p.structType(ty)
+	case *NamedUserType:
+		p.buf.WriteString(ty.Name())
+	default:
+		return fmt.Errorf("Unknown schema type %T", ty)
+	}
+	return nil
+}
+
+func (p *printer) union(ut *UnionType) error {
+	final := p.opts.Dialect == FinalDialect
+	p.mark(ut.Pos())
+	if !p.hasComments(ut.Pos(), ut.end) && !containsStruct(ut) {
+		if final {
+			p.buf.WriteString("union { ")
+		} else {
+			p.buf.WriteString("(")
+		}
+		var next uint64
+		for i, ust := range ut.Types() {
+			if i > 0 {
+				p.buf.WriteString(" | ")
+			}
+			if err := p.unionSubtype(&ust, next); err != nil {
+				return err
+			}
+			next = ust.Tag() + 1
+		}
+		if final {
+			p.buf.WriteString(" }")
+		} else {
+			p.buf.WriteString(")")
+		}
+		p.mark(ut.end)
+		return nil
+	}
+
+	// One member per line, with the comments between them
+	if final {
+		p.buf.WriteString("union {")
+	} else {
+		p.buf.WriteString("(")
+	}
+	types := ut.Types()
+	following := func(i int) Pos {
+		if i < len(types) {
+			return types[i].Pos()
+		}
+		return ut.end
+	}
+	p.open(following(0))
+	var next uint64
+	for i, ust := range types {
+		p.begin(ust.Pos(), true)
+		if final {
+			p.buf.WriteString("| ")
+		}
+		if err := p.unionSubtype(&ust, next); err != nil {
+			return err
+		}
+		next = ust.Tag() + 1
+		if !final && i < len(types)-1 {
+			p.buf.WriteString(" |")
+		}
+		p.newline(following(i + 1))
+	}
+	if final {
+		p.close(ut.end, "}")
+	} else {
+		p.close(ut.end, ")")
+	}
+	return nil
+}
+
+func (p *printer) unionSubtype(ust *UnionSubtype, next uint64) error {
+	p.mark(ust.Pos())
+	if err := p.typ(ust.Type()); err != nil {
+		return err
+	}
+	if ust.Tag() != next {
+		fmt.Fprintf(&p.buf, " = %d", ust.Tag())
+	}
+	return nil
+}
+
+func (p *printer) structType(st *StructType) error {
+	p.mark(st.Pos())
+	if p.opts.Dialect == FinalDialect {
+		p.buf.WriteString("struct {")
+	} else {
+		p.buf.WriteString("{")
+	}
+	fields := st.Fields()
+	following := func(i int) Pos {
+		if i < len(fields) {
+			return fields[i].Pos()
+		}
+		return st.end
+	}
+	p.open(following(0))
+	for i, field := range fields {
+		p.begin(field.Pos(), true)
+		fmt.Fprintf(&p.buf, "%s: ", field.Name())
+		if err := p.typ(field.Type()); err != nil {
+			return err
+		}
+		p.newline(following(i + 1))
+	}
+	p.close(st.end, "}")
+	return nil
+}
+
+// Reports whether a union has to be written over several lines because one
+// of its members is a struct.
+func containsStruct(ty Type) bool {
+	switch ty := ty.(type) {
+	case *StructType:
+		return true
+	case *OptionalType:
+		return containsStruct(ty.Subtype())
+	case *ArrayType:
+		return containsStruct(ty.Member())
+	case *MapType:
+		return containsStruct(ty.Key()) || containsStruct(ty.Value())
+	case *UnionType:
+		for _, ust := range ty.Types() {
+			if containsStruct(ust.Type()) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Starts a new line for the node at the given position, after the comments
+// which come before it. A blank line is kept before the node if there is one
+// in the source and gap is set.
+func (p *printer) begin(pos Pos, gap bool) {
+	if pos.IsValid() {
+		for len(p.comments) > 0 && p.comments[0].Pos.Line < pos.Line {
+			p.comment(p.comments[0])
+			p.comments = p.comments[1:]
+		}
+		if gap && !p.suppress && p.lastLine != 0 && pos.Line > p.lastLine+1 {
+			p.buf.WriteByte('\n')
+		}
+		p.line = pos.Line
+	}
+	p.suppress = false
+	p.lineStart = p.buf.Len()
+	p.buf.WriteString(strings.Repeat("\t", p.indent))
+}
+
+// Records the source line of a node written in the middle of a line.
+func (p *printer) mark(pos Pos) {
+	if pos.Line > p.line {
+		p.line = pos.Line
+	}
+}
+
+// Ends the current line, after the first comment at the end of it in the
+// source, unless the node written next, at the given position if it is known,
+// comes before the comment: the comment then belongs to a later line, as the
+// source line is split. Any other comments from the lines the current line was
+// written from are left to the next line, so that they are indented like it.
+func (p *printer) newline(next Pos) {
+	if len(p.comments) > 0 && p.comments[0].Pos.Line <= p.line &&
+		!(next.IsValid() && before(next, p.comments[0].Pos)) {
+		p.buf.WriteString(" #" + p.comments[0].Text)
+		p.comments = p.comments[1:]
+	}
+	p.buf.WriteByte('\n')
+	p.lastLine = p.line
+}
+
+// Moves the comments from the source lines of the current line which do not
+// fit at its end before it. This is done for the last line of declarations,
+// after which they would belong to the next declaration when parsed again.
+func (p *printer) hoist() {
+	n := 0
+	for n < len(p.comments) && p.comments[n].Pos.Line <= p.line {
+		n++
+	}
+	if n < 2 {
+		return
+	}
+	line := append([]byte(nil), p.buf.Bytes()[p.lineStart:]...)
+	p.buf.Truncate(p.lineStart)
+	for _, c := range p.comments[1:n] {
+		fmt.Fprintf(&p.buf, "%s#%s\n", strings.Repeat("\t", p.indent), c.Text)
+	}
+	p.buf.Write(line)
+	p.comments = append([]Comment{p.comments[0]}, p.comments[n:]...)
+}
+
+// Writes a comment on a line of its own.
+func (p *printer) comment(c Comment) {
+	if !p.suppress && p.lastLine != 0 && c.Pos.Line > p.lastLine+1 {
+		p.buf.WriteByte('\n')
+	}
+	p.suppress = false
+	fmt.Fprintf(&p.buf, "%s#%s\n", strings.Repeat("\t", p.indent), c.Text)
+	// Comments left over from the end of the previous line come from lines
+	// already written
+	if c.Pos.Line > p.lastLine {
+		p.lastLine = c.Pos.Line
+	}
+	if c.Pos.Line > p.line {
+		p.line = c.Pos.Line
+	}
+}
+
+// Ends the line of an opening brace or parenthesis, followed by the node at
+// the given position, and indents the following lines.
+func (p *printer) open(next Pos) {
+	p.newline(next)
+	p.indent++
+	p.suppress = true
+}
+
+// Writes the closing brace or parenthesis at the given position on a new line.
+func (p *printer) close(end Pos, text string) {
+	// Comments before the closing brace are indented like the lines above it
+	if end.IsValid() {
+		for len(p.comments) > 0 && p.comments[0].Pos.Line < end.Line {
+			p.comment(p.comments[0])
+			p.comments = p.comments[1:]
+		}
+	}
+	p.indent--
+	p.begin(end, false)
+	p.buf.WriteString(text)
+}
+
+// Reports whether there are comments between two positions.
+func (p *printer) hasComments(from, to Pos) bool {
+	for _, c := range p.comments {
+		if before(from, c.Pos) && before(c.Pos, to) {
+			return true
+		}
+	}
+	return false
+}
+
+func before(a, b Pos) bool {
+	return a.Line < b.Line || (a.Line == b.Line && a.Column < b.Column)
+}
+
+var primitiveNames = map[TypeKind]string{
+	UINT:   "uint",
+	U8:     "u8",
+	U16:    "u16",
+	U32:    "u32",
+	U64:    "u64",
+	INT:    "int",
+	I8:     "i8",
+	I16:    "i16",
+	I32:    "i32",
+	I64:    "i64",
+	F32:    "f32",
+	F64:    "f64",
+	Bool:   "bool",
+	String: "string",
+	Void:   "void",
+}
@@ -0,0 +1,254 @@
+package schema
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func format(t *testing.T, opts FormatOptions, src string) string {
+	types, err := Parse(strings.NewReader(src))
+	if !assert.NoError(t, err) {
+		return ""
+	}
+	var buf bytes.Buffer
+	assert.NoError(t, opts.Format(&buf, types))
+	return buf.String()
+}
+
+func TestFormat(t *testing.T) {
+	src := `type PublicKey data<128> type Time string
+enum Department u16 { ACCOUNTING ADMINISTRATION JSMITH = 99 JDOE }
+type Customer { name: string orders: []{ orderId: i64 quantity: i32 }
+  metadata: map[string]data keys: [4]PublicKey }
+type Person (Customer | void = 5 | optional<Time>) type Data data`
+	expected := `type PublicKey data<128>
+
+type Time string
+
+enum Department u16 {
+	ACCOUNTING
+	ADMINISTRATION
+	JSMITH = 99
+	JDOE
+}
+
+type Customer {
+	name: string
+	orders: []{
+		orderId: i64
+		quantity: i32
+	}
+	metadata: map[string]data
+	keys: [4]PublicKey
+}
+
+type Person (Customer | void = 5 | optional<Time>)
+
+type Data data
+`
+	assert.Equal(t, expected, format(t, FormatOptions{}, src))
+	assert.Equal(t, expected, format(t, FormatOptions{}, expected))
+}
+
+func TestFormatFinalDialect(t *testing.T) {
+	src := `
+		enum Department { ACCOUNTING JSMITH = 99 }
+		type Customer {
+			orders: []{ orderId: i64 }
+			metadata: map[string]data<16>
+			keys: [4]string
+		}
+		type Person (Customer | void = 5 | ({ reason: string } | u8))`
+	expected := `type Department enum {
+	ACCOUNTING
+	JSMITH = 99
+}
+
+type Customer struct {
+	orders: list<struct {
+		orderId: i64
+	}>
+	metadata: map<str><data[16]>
+	keys: list<str>[4]
+}
+
+type Person union {
+	| Customer
+	| void = 5
+	| union {
+		| struct {
+			reason: str
+		}
+		| u8
+	}
+}
+`
+	final := FormatOptions{Dialect: FinalDialect}
+	assert.Equal(t, expected, format(t, final, src))
+	assert.Equal(t, expected, format(t, final, expected))
+	assert.Equal(t, format(t, FormatOptions{}, src),
+		format(t, FormatOptions{}, expected))
+}
+
+func TestFormatComments(t *testing.T) {
+	src := `# Header
+
+# The departments
+enum Department {
+  ACCOUNTING # first
+
+
+  # Reserved for the CEO
+  JSMITH = 99
+}
+type Message (
+  # Plain numbers
+  u8
+  | Department = 4 # tagged
+)
+type Customer {
+  name: string
+
+  # Not yet used
+  orders: []{ orderId: i64 }
+} # trailing
+# End of file
+`
+	expected := `# Header
+
+# The departments
+enum Department {
+	ACCOUNTING # first
+
+	# Reserved for the CEO
+	JSMITH = 99
+}
+
+type Message (
+	# Plain numbers
+	u8 |
+	Department = 4 # tagged
+)
+
+type Customer {
+	name: string
+
+	# Not yet used
+	orders: []{
+		orderId: i64
+	}
+} # trailing
+# End of file
+`
+	assert.Equal(t, expected, format(t, FormatOptions{}, src))
+	assert.Equal(t, expected, format(t, FormatOptions{}, expected))
+}
+
+func TestFormatCommentsIdempotent(t *testing.T) {
+	src := `type B map[ # key
+  string] # value
+  u8
+type S {
+  m: map[ # key
+    string]
+    u8 # value
+  f: u8 # trail
+  l: [] # list
+    { # member
+      x: u8 # x
+    } # end
+  u: (u8 | # first
+    u16) # second
+}
+`
+	expected := `# value
+type B map[string]u8 # key
+
+type S {
+	m: map[string]u8 # key
+	# value
+	f: u8 # trail
+	l: []{ # list
+		# member
+		x: u8 # x
+	} # end
+	u: (
+		u8 | # first
+		u16
+	) # second
+}
+`
+	formatted := format(t, FormatOptions{}, src)
+	assert.Equal(t, expected, formatted)
+	assert.Equal(t, formatted, format(t, FormatOptions{}, formatted))
+}
+
+func TestFormatTrailingComments(t *testing.T) {
+	// Comments stay at the end of the line of the node before them, even when
+	// a type written on one line is split over several
+	src := `type P { x: u8 y: u8 } # point
+type S {
+  x: u8 # note
+  p: { a: u8 } # inline
+  o: optional<{ a: u8 }> # optional
+  u: (u8 | # first
+    string) # last
+}
+type U (P # point
+  | S) # union
+enum E { A B } # enum
+`
+	expected := `type P {
+	x: u8
+	y: u8
+} # point
+
+type S {
+	x: u8 # note
+	p: {
+		a: u8
+	} # inline
+	o: optional<{
+		a: u8
+	}> # optional
+	u: (
+		u8 | # first
+		string
+	) # last
+}
+
+type U (
+	P | # point
+	S
+) # union
+
+enum E {
+	A
+	B
+} # enum
+`
+	formatted := format(t, FormatOptions{}, src)
+	assert.Equal(t, expected, formatted)
+	assert.Equal(t, formatted, format(t, FormatOptions{}, formatted))
+}
+
+func TestFormatErrors(t *testing.T) {
+	types, err := Parse(strings.NewReader(`enum Small u8 { A B }`))
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	err = FormatOptions{Dialect: FinalDialect}.Format(&buf, types)
+	assert.EqualError(t, err,
+		"Enum Small of type u8 cannot be written in the final dialect")
+	assert.Zero(t, buf.Len())
+}
+
+func TestFormatType(t *testing.T) {
+	types, err := Parse(strings.NewReader(`type T map[string][]optional<data<4>>`))
+	assert.NoError(t, err)
+	assert.Equal(t, "map[string][]optional<data<4>>",
+		FormatType(types[0].(*UserDefinedType).Type()))
+}
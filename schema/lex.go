@@ -6,27 +6,86 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"strings"
 	"unicode"
 )
 
 // A scanner for reading lexographic tokens from a BARE schema language
 // document.
 type Scanner struct {
-	// TODO: track lineno/colno information and attach it to the tokens
-	// returned, for better error reporting
 	br       *bufio.Reader
 	pushback []Token
+	// Position of the next rune, and of the previous one for unreadRune
+	pos, prev Pos
+	// Position of the last token returned by Next, and of the one before it
+	// for PushBack
+	last, beforeLast Pos
+	comments         []Comment
+}
+
+// A comment in a schema document.
+type Comment struct {
+	Pos Pos
+	// The text of the comment, after the '#'
+	Text string
 }
 
 // Creates a new BARE schema language scanner for the given reader.
 func NewScanner(reader io.Reader) *Scanner {
-	return &Scanner{bufio.NewReader(reader), nil}
+	return NewFileScanner("", reader)
+}
+
+// Creates a new BARE schema language scanner for the given reader. The file
+// name is recorded in the position of each token.
+func NewFileScanner(file string, reader io.Reader) *Scanner {
+	return &Scanner{
+		br:  bufio.NewReader(reader),
+		pos: Pos{File: file, Line: 1, Column: 1},
+	}
+}
+
+// Returns the position of the next character to be read.
+func (sc *Scanner) Pos() Pos {
+	return sc.pos
+}
+
+// Returns the comments read so far.
+func (sc *Scanner) Comments() []Comment {
+	return sc.comments
+}
+
+func (sc *Scanner) readRune() (rune, error) {
+	r, _, err := sc.br.ReadRune()
+	if err != nil {
+		return r, err
+	}
+	sc.prev = sc.pos
+	if r == '\n' {
+		sc.pos.Line++
+		sc.pos.Column = 1
+	} else {
+		sc.pos.Column++
+	}
+	return r, nil
+}
+
+func (sc *Scanner) unreadRune() {
+	sc.br.UnreadRune()
+	sc.pos = sc.prev
 }
 
 // Returns the next token from the reader. If the token has a string associated
 // with it (e.g. UserTypeName, Name, and Integer), the second return value is
 // set to that string.
 func (sc *Scanner) Next() (Token, error) {
+	tok, err := sc.next()
+	if err == nil {
+		sc.beforeLast, sc.last = sc.last, tok.Pos
+	}
+	return tok, err
+}
+
+func (sc *Scanner) next() (Token, error) {
 	if len(sc.pushback) != 0 {
 		tok := sc.pushback[0]
 		sc.pushback = sc.pushback[1:]
@@ -39,7 +98,8 @@ func (sc *Scanner) Next() (Token, error) {
 	)
 
 	for {
-		r, _, err = sc.br.ReadRune()
+		pos := sc.pos
+		r, err = sc.readRune()
 		if err != nil {
 			break
 		}
@@ -48,43 +108,54 @@ func (sc *Scanner) Next() (Token, error) {
 			continue
 		}
 		if unicode.IsLetter(r) {
-			sc.br.UnreadRune()
+			sc.unreadRune()
 			return sc.scanWord()
 		}
 		if unicode.IsDigit(r) {
-			sc.br.UnreadRune()
+			sc.unreadRune()
 			return sc.scanInteger()
 		}
 
 		switch r {
 		case '#':
-			sc.br.ReadString('\n')
+			var text []rune
+			for {
+				r, err = sc.readRune()
+				if err != nil || r == '\n' {
+					break
+				}
+				text = append(text, r)
+			}
+			sc.comments = append(sc.comments, Comment{
+				Pos:  pos,
+				Text: strings.TrimRight(string(text), "\r"),
+			})
 			continue
 		case '<':
-			return Token{TLANGLE, ""}, nil
+			return Token{TLANGLE, "", pos}, nil
 		case '>':
-			return Token{TRANGLE, ""}, nil
+			return Token{TRANGLE, "", pos}, nil
 		case '{':
-			return Token{TLBRACE, ""}, nil
+			return Token{TLBRACE, "", pos}, nil
 		case '}':
-			return Token{TRBRACE, ""}, nil
+			return Token{TRBRACE, "", pos}, nil
 		case '[':
-			return Token{TLBRACKET, ""}, nil
+			return Token{TLBRACKET, "", pos}, nil
 		case ']':
-			return Token{TRBRACKET, ""}, nil
+			return Token{TRBRACKET, "", pos}, nil
 		case '(':
-			return Token{TLPAREN, ""}, nil
+			return Token{TLPAREN, "", pos}, nil
 		case ')':
-			return Token{TRPAREN, ""}, nil
+			return Token{TRPAREN, "", pos}, nil
 		case '|':
-			return Token{TPIPE, ""}, nil
+			return Token{TPIPE, "", pos}, nil
 		case '=':
-			return Token{TEQUAL, ""}, nil
+			return Token{TEQUAL, "", pos}, nil
 		case ':':
-			return Token{TCOLON, ""}, nil
+			return Token{TCOLON, "", pos}, nil
 		}
 
-		return Token{}, &ErrUnknownToken{r}
+		return Token{}, &ErrUnknownToken{r, pos}
 	}
 
 	return Token{}, err
@@ -94,23 +165,31 @@ func (sc *Scanner) Next() (Token, error) {
 // call to Next.
 func (sc *Scanner) PushBack(tok Token) {
 	sc.pushback = append(sc.pushback, tok)
+	sc.last = sc.beforeLast
 }
 
 // Returned when the lexer encounters an unexpected character
 type ErrUnknownToken struct {
 	token rune
+	pos   Pos
 }
 
 func (e *ErrUnknownToken) Error() string {
-	return fmt.Sprintf("Unknown token '%c'", e.token)
+	return fmt.Sprintf("%s: Unknown token '%c'", e.pos, e.token)
+}
+
+// Returns the position of the unexpected character.
+func (e *ErrUnknownToken) Pos() Pos {
+	return e.pos
 }
 
 func (sc *Scanner) scanWord() (Token, error) {
 	var buf bytes.Buffer
+	pos := sc.pos
 
 	for {
-		r, _, err := sc.br.ReadRune()
-		if err != nil  {
+		r, err := sc.readRune()
+		if err != nil {
 			if err == io.EOF {
 				break
 			}
@@ -120,7 +199,7 @@ func (sc *Scanner) scanWord() (Token, error) {
 		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' {
 			buf.WriteRune(r)
 		} else {
-			sc.br.UnreadRune()
+			sc.unreadRune()
 			break
 		}
 	}
@@ -128,56 +207,65 @@ func (sc *Scanner) scanWord() (Token, error) {
 	tok := buf.String()
 	switch tok {
 	case "type":
-		return Token{TTYPE, ""}, nil
+		return Token{TTYPE, "", pos}, nil
 	case "enum":
-		return Token{TENUM, ""}, nil
+		return Token{TENUM, "", pos}, nil
 	case "uint":
-		return Token{TUINT, ""}, nil
+		return Token{TUINT, "", pos}, nil
 	case "u8":
-		return Token{TU8, ""}, nil
+		return Token{TU8, "", pos}, nil
 	case "u16":
-		return Token{TU16, ""}, nil
+		return Token{TU16, "", pos}, nil
 	case "u32":
-		return Token{TU32, ""}, nil
+		return Token{TU32, "", pos}, nil
 	case "u64":
-		return Token{TU64, ""}, nil
+		return Token{TU64, "", pos}, nil
 	case "int":
-		return Token{TINT, ""}, nil
+		return Token{TINT, "", pos}, nil
 	case "i8":
-		return Token{TI8, ""}, nil
+		return Token{TI8, "", pos}, nil
 	case "i16":
-		return Token{TI16, ""}, nil
+		return Token{TI16, "", pos}, nil
 	case "i32":
-		return Token{TI32, ""}, nil
+		return Token{TI32, "", pos}, nil
 	case "i64":
-		return Token{TI64, ""}, nil
+		return Token{TI64, "", pos}, nil
 	case "f32":
-		return Token{TF32, ""}, nil
+		return Token{TF32, "", pos}, nil
 	case "f64":
-		return Token{TF64, ""}, nil
+		return Token{TF64, "", pos}, nil
 	case "bool":
-		return Token{TBOOL, ""}, nil
+		return Token{TBOOL, "", pos}, nil
 	case "string":
-		return Token{TSTRING, ""}, nil
+		return Token{TSTRING, "", pos}, nil
+	case "str":
+		return Token{TSTR, "", pos}, nil
 	case "data":
-		return Token{TDATA, ""}, nil
+		return Token{TDATA, "", pos}, nil
 	case "void":
-		return Token{TVOID, ""}, nil
+		return Token{TVOID, "", pos}, nil
 	case "optional":
-		return Token{TOPTIONAL, ""}, nil
+		return Token{TOPTIONAL, "", pos}, nil
 	case "map":
-		return Token{TMAP, ""}, nil
+		return Token{TMAP, "", pos}, nil
+	case "list":
+		return Token{TLIST, "", pos}, nil
+	case "struct":
+		return Token{TSTRUCT, "", pos}, nil
+	case "union":
+		return Token{TUNION, "", pos}, nil
 	}
 
-	return Token{TNAME, tok}, nil
+	return Token{TNAME, tok, pos}, nil
 }
 
 func (sc *Scanner) scanInteger() (Token, error) {
 	var buf bytes.Buffer
+	pos := sc.pos
 
 	for {
-		r, _, err := sc.br.ReadRune()
-		if err != nil  {
+		r, err := sc.readRune()
+		if err != nil {
 			if err == io.EOF {
 				break
 			}
@@ -187,22 +275,31 @@ func (sc *Scanner) scanInteger() (Token, error) {
 		if unicode.IsDigit(r) {
 			buf.WriteRune(r)
 		} else {
-			sc.br.UnreadRune()
+			sc.unreadRune()
 			break
 		}
 	}
 
-	return Token{TINTEGER, buf.String()}, nil
+	return Token{TINTEGER, buf.String(), pos}, nil
 }
 
 // A single lexographic token from a schema language token stream
 type Token struct {
 	Token TokenKind
 	Value string
+	// Position of the first character of the token
+	Pos Pos
 }
 
 type TokenKind int
 
+// Reports whether the token is a keyword. Keywords may also be used as field
+// names.
+func (t Token) isKeyword() bool {
+	return t.Token == TTYPE || t.Token == TENUM ||
+		(t.Token >= TUINT && t.Token <= TUNION)
+}
+
 const (
 	TTYPE TokenKind = iota
 	TENUM
@@ -231,6 +328,12 @@ const (
 	TMAP
 	TOPTIONAL
 
+	// Keywords of the final BARE specification
+	TSTR
+	TLIST
+	TSTRUCT
+	TUNION
+
 	// <
 	TLANGLE
 	// >
@@ -301,6 +404,14 @@ func (t Token) String() string {
 		return "map"
 	case TOPTIONAL:
 		return "optional"
+	case TSTR:
+		return "str"
+	case TLIST:
+		return "list"
+	case TSTRUCT:
+		return "struct"
+	case TUNION:
+		return "union"
 	case TLANGLE:
 		return "<"
 	case TRANGLE:
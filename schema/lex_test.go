@@ -10,24 +10,28 @@ import (
 
 func TestScanWords(t *testing.T) {
 	cases := map[string]TokenKind{
-		"uint": TUINT,
-		"u8": TU8,
-		"u16": TU16,
-		"u32": TU32,
-		"u64": TU64,
-		"int": TINT,
-		"i8": TI8,
-		"i16": TI16,
-		"i32": TI32,
-		"i64": TI64,
-		"f32": TF32,
-		"f64": TF64,
-		"bool": TBOOL,
-		"string": TSTRING,
-		"data": TDATA,
-		"void": TVOID,
-		"map": TMAP,
+		"uint":     TUINT,
+		"u8":       TU8,
+		"u16":      TU16,
+		"u32":      TU32,
+		"u64":      TU64,
+		"int":      TINT,
+		"i8":       TI8,
+		"i16":      TI16,
+		"i32":      TI32,
+		"i64":      TI64,
+		"f32":      TF32,
+		"f64":      TF64,
+		"bool":     TBOOL,
+		"string":   TSTRING,
+		"data":     TDATA,
+		"void":     TVOID,
+		"map":      TMAP,
 		"optional": TOPTIONAL,
+		"str":      TSTR,
+		"list":     TLIST,
+		"struct":   TSTRUCT,
+		"union":    TUNION,
 	}
 
 	for input, reference := range cases {
@@ -111,7 +115,10 @@ func TestScanSample(t *testing.T) {
 	}
 
 	type Person (Customer | Employee)`
-	reference := []Token{
+	reference := []struct {
+		Token TokenKind
+		Value string
+	}{
 		{TTYPE, ""}, {TNAME, "PublicKey"}, {TDATA, ""},
 			{TLANGLE, ""}, {TINTEGER, "128"}, {TRANGLE, ""},
 		{TTYPE, ""}, {TNAME, "Time"}, {TSTRING, ""},
@@ -150,3 +157,30 @@ func TestScanSample(t *testing.T) {
 	_, err := scanner.Next()
 	assert.Equal(t, io.EOF, err, "Expected Scan to return EOF")
 }
+
+
+func TestScanPositions(t *testing.T) {
+	scanner := NewFileScanner("test.bare", strings.NewReader(
+		"type Foo\n  # comment\n\t{ bar: uint }"))
+	reference := []Pos{
+		{"test.bare", 1, 1},
+		{"test.bare", 1, 6},
+		{"test.bare", 3, 2},
+		{"test.bare", 3, 4},
+		{"test.bare", 3, 7},
+		{"test.bare", 3, 9},
+		{"test.bare", 3, 14},
+	}
+	for i, ref := range reference {
+		tok, err := scanner.Next()
+		assert.NoError(t, err)
+		assert.Equal(t, ref, tok.Pos, "Expected Scan to return correct position for reference %d", i)
+	}
+	_, err := scanner.Next()
+	assert.Equal(t, io.EOF, err, "Expected Scan to return EOF")
+
+	scanner = NewScanner(strings.NewReader("type\n  $"))
+	scanner.Next()
+	_, err = scanner.Next()
+	assert.EqualError(t, err, "2:3: Unknown token '$'")
+}
@@ -10,8 +10,8 @@ import (
 var (
 	userTypeNameRE = regexp.MustCompile(`[A-Z][A-Za-z0-9]*`)
 	userEnumNameRE = regexp.MustCompile(`[A-Z][A-Za-z0-9]*`)
-	fieldNameRE = regexp.MustCompile(`[a-z][A-Za-z0-9]*`)
-	enumValueRE = regexp.MustCompile(`[A-Z][A-Z0-9_]*`)
+	fieldNameRE    = regexp.MustCompile(`[a-z][A-Za-z0-9]*`)
+	enumValueRE    = regexp.MustCompile(`[A-Z][A-Z0-9_]*`)
 )
 
 // Returned when the lexer encounters an unexpected token
@@ -21,15 +21,32 @@ type ErrUnexpectedToken struct {
 }
 
 func (e *ErrUnexpectedToken) Error() string {
-	return fmt.Sprintf("Unexpected token '%s'; expected %s",
-		e.token.String(), e.expected)
+	return fmt.Sprintf("%s: Unexpected token '%s'; expected %s",
+		e.token.Pos, e.token.String(), e.expected)
+}
+
+// Returns the position of the unexpected token.
+func (e *ErrUnexpectedToken) Pos() Pos {
+	return e.token.Pos
 }
 
 // Parses a BARE schema definition language document from the given reader and
 // returns a list of the user-defined types it specifies.
 func Parse(reader io.Reader) ([]SchemaType, error) {
-	scanner := NewScanner(reader)
-	var stypes []SchemaType
+	return parse(NewScanner(reader))
+}
+
+// Parses a BARE schema definition language document like Parse. The file name
+// is recorded in the positions of the types and in errors.
+func ParseFile(file string, reader io.Reader) ([]SchemaType, error) {
+	return parse(NewFileScanner(file, reader))
+}
+
+func parse(scanner *Scanner) ([]SchemaType, error) {
+	var (
+		stypes []SchemaType
+		ends   []Pos
+	)
 	for {
 		st, err := parseSchemaType(scanner)
 		if err == io.EOF {
@@ -38,6 +55,30 @@ func Parse(reader io.Reader) ([]SchemaType, error) {
 			return nil, err
 		}
 		stypes = append(stypes, st)
+		ends = append(ends, scanner.last)
+	}
+
+	// Each comment belongs to the first declaration which ends on or after
+	// its line, or the last one for comments at the end of the document
+	i := 0
+	for _, c := range scanner.Comments() {
+		for i < len(stypes)-1 && ends[i].Line < c.Pos.Line {
+			i++
+		}
+		switch st := stypes[i].(type) {
+		case *UserDefinedType:
+			st.comments = append(st.comments, c)
+		case *UserDefinedEnum:
+			st.comments = append(st.comments, c)
+		}
+	}
+	for i, st := range stypes {
+		switch st := st.(type) {
+		case *UserDefinedType:
+			st.end = ends[i]
+		case *UserDefinedEnum:
+			st.end = ends[i]
+		}
 	}
 	return stypes, nil
 }
@@ -48,16 +89,33 @@ func parseSchemaType(scanner *Scanner) (SchemaType, error) {
 		return nil, err
 	}
 
+	var st SchemaType
 	switch tok.Token {
 	case TTYPE:
 		scanner.PushBack(tok)
-		return parseUserType(scanner)
+		st, err = parseUserType(scanner)
 	case TENUM:
 		scanner.PushBack(tok)
-		return parseUserEnum(scanner)
+		st, err = parseUserEnum(scanner)
+	default:
+		return nil, &ErrUnexpectedToken{tok, "'type' or 'enum'"}
 	}
 
-	return nil, &ErrUnexpectedToken{tok, "'type' or 'enum'"}
+	if err == io.EOF {
+		// Only the end of the document between two declarations is expected
+		return nil, errorf(scanner.Pos(), "Unexpected end of file")
+	}
+	return st, err
+}
+
+// Returns the position of the next token.
+func nextPos(scanner *Scanner) (Pos, error) {
+	tok, err := scanner.Next()
+	if err != nil {
+		return Pos{}, err
+	}
+	scanner.PushBack(tok)
+	return tok.Pos, nil
 }
 
 func parseUserType(scanner *Scanner) (SchemaType, error) {
@@ -76,15 +134,33 @@ func parseUserType(scanner *Scanner) (SchemaType, error) {
 	if tok.Token != TNAME {
 		return nil, &ErrUnexpectedToken{tok, "type name"}
 	}
+	name, pos := tok.Value, tok.Pos
+
+	// type Name enum { ... }
+	tok, err = scanner.Next()
+	if err != nil {
+		return nil, err
+	}
+	if tok.Token == TENUM {
+		evs, err := parseEnumValues(scanner)
+		if err != nil {
+			return nil, err
+		}
+		if !userEnumNameRE.MatchString(name) {
+			return nil, errorf(pos, "Invalid name for user enum %s", name)
+		}
+		return &UserDefinedEnum{name: name, kind: UINT, values: evs, pos: pos}, nil
+	}
+	scanner.PushBack(tok)
 
-	udt := &UserDefinedType{name: tok.Value}
+	udt := &UserDefinedType{name: name, pos: pos}
 	udt.type_, err = parseType(scanner)
 	if err != nil {
 		return nil, err
 	}
 
 	if !userTypeNameRE.MatchString(udt.Name()) {
-		return nil, fmt.Errorf("Invalid name for user type %s", udt.Name())
+		return nil, errorf(udt.pos, "Invalid name for user type %s", udt.Name())
 	}
 
 	return udt, nil
@@ -108,6 +184,7 @@ func parseUserEnum(scanner *Scanner) (SchemaType, error) {
 		return nil, &ErrUnexpectedToken{tok, "enum name"}
 	}
 	name = tok.Value
+	pos := tok.Pos
 
 	var kind TypeKind
 	tok, err = scanner.Next()
@@ -128,7 +205,21 @@ func parseUserEnum(scanner *Scanner) (SchemaType, error) {
 		scanner.PushBack(tok)
 	}
 
-	tok, err = scanner.Next()
+	evs, err := parseEnumValues(scanner)
+	if err != nil {
+		return nil, err
+	}
+
+	if !userEnumNameRE.MatchString(name) {
+		return nil, errorf(pos, "Invalid name for user enum %s", name)
+	}
+
+	return &UserDefinedEnum{name: name, kind: kind, values: evs, pos: pos}, nil
+}
+
+// Parses the braced list of values of an enum.
+func parseEnumValues(scanner *Scanner) ([]EnumValue, error) {
+	tok, err := scanner.Next()
 	if err != nil {
 		return nil, err
 	}
@@ -149,8 +240,9 @@ func parseUserEnum(scanner *Scanner) (SchemaType, error) {
 
 		var ev EnumValue
 		ev.name = tok.Value
+		ev.pos = tok.Pos
 		if !enumValueRE.MatchString(ev.name) {
-			return nil, fmt.Errorf("Invalid name for enum value %s", ev.name)
+			return nil, errorf(ev.pos, "Invalid name for enum value %s", ev.name)
 		}
 
 		tok, err = scanner.Next()
@@ -168,12 +260,11 @@ func parseUserEnum(scanner *Scanner) (SchemaType, error) {
 
 			v, _ := strconv.ParseUint(tok.Value, 10, 32)
 			value = uint(v)
-			ev.value = value
 		} else {
-			ev.value = value
-			value += 1
 			scanner.PushBack(tok)
 		}
+		ev.value = value
+		value += 1
 
 		evs = append(evs, ev)
 
@@ -191,11 +282,7 @@ func parseUserEnum(scanner *Scanner) (SchemaType, error) {
 		}
 	}
 
-	if !userEnumNameRE.MatchString(name) {
-		return nil, fmt.Errorf("Invalid name for user enum %s", name)
-	}
-
-	return &UserDefinedEnum{name, kind, evs}, nil
+	return evs, nil
 }
 
 func parseType(scanner *Scanner) (Type, error) {
@@ -206,35 +293,35 @@ func parseType(scanner *Scanner) (Type, error) {
 
 	switch tok.Token {
 	case TUINT:
-		return &PrimitiveType{UINT}, nil
+		return &PrimitiveType{UINT, tok.Pos}, nil
 	case TU8:
-		return &PrimitiveType{U8}, nil
+		return &PrimitiveType{U8, tok.Pos}, nil
 	case TU16:
-		return &PrimitiveType{U16}, nil
+		return &PrimitiveType{U16, tok.Pos}, nil
 	case TU32:
-		return &PrimitiveType{U32}, nil
+		return &PrimitiveType{U32, tok.Pos}, nil
 	case TU64:
-		return &PrimitiveType{U64}, nil
+		return &PrimitiveType{U64, tok.Pos}, nil
 	case TINT:
-		return &PrimitiveType{INT}, nil
+		return &PrimitiveType{INT, tok.Pos}, nil
 	case TI8:
-		return &PrimitiveType{I8}, nil
+		return &PrimitiveType{I8, tok.Pos}, nil
 	case TI16:
-		return &PrimitiveType{I16}, nil
+		return &PrimitiveType{I16, tok.Pos}, nil
 	case TI32:
-		return &PrimitiveType{I32}, nil
+		return &PrimitiveType{I32, tok.Pos}, nil
 	case TI64:
-		return &PrimitiveType{I64}, nil
+		return &PrimitiveType{I64, tok.Pos}, nil
 	case TF32:
-		return &PrimitiveType{F32}, nil
+		return &PrimitiveType{F32, tok.Pos}, nil
 	case TF64:
-		return &PrimitiveType{F64}, nil
+		return &PrimitiveType{F64, tok.Pos}, nil
 	case TBOOL:
-		return &PrimitiveType{Bool}, nil
-	case TSTRING:
-		return &PrimitiveType{String}, nil
+		return &PrimitiveType{Bool, tok.Pos}, nil
+	case TSTRING, TSTR:
+		return &PrimitiveType{String, tok.Pos}, nil
 	case TVOID:
-		return &PrimitiveType{Void}, nil
+		return &PrimitiveType{Void, tok.Pos}, nil
 	case TOPTIONAL:
 		scanner.PushBack(tok)
 		return parseOptionalType(scanner)
@@ -247,14 +334,17 @@ func parseType(scanner *Scanner) (Type, error) {
 	case TLBRACKET:
 		scanner.PushBack(tok)
 		return parseArrayType(scanner)
-	case TLPAREN:
+	case TLIST:
+		scanner.PushBack(tok)
+		return parseListType(scanner)
+	case TLPAREN, TUNION:
 		scanner.PushBack(tok)
 		return parseUnionType(scanner)
-	case TLBRACE:
+	case TLBRACE, TSTRUCT:
 		scanner.PushBack(tok)
 		return parseStructType(scanner)
 	case TNAME:
-		return &NamedUserType{name: tok.Value}, nil
+		return &NamedUserType{name: tok.Value, pos: tok.Pos}, nil
 	}
 
 	return nil, &ErrUnexpectedToken{tok, "type"}
@@ -268,6 +358,7 @@ func parseOptionalType(scanner *Scanner) (Type, error) {
 	if tok.Token != TOPTIONAL {
 		return nil, &ErrUnexpectedToken{tok, "optional"}
 	}
+	pos := tok.Pos
 
 	tok, err = scanner.Next()
 	if err != nil {
@@ -289,7 +380,7 @@ func parseOptionalType(scanner *Scanner) (Type, error) {
 	if tok.Token != TRANGLE {
 		return nil, &ErrUnexpectedToken{tok, ">"}
 	}
-	return &OptionalType{subtype: st}, nil
+	return &OptionalType{subtype: st, pos: pos}, nil
 }
 
 func parseDataType(scanner *Scanner) (Type, error) {
@@ -300,34 +391,54 @@ func parseDataType(scanner *Scanner) (Type, error) {
 	if tok.Token != TDATA {
 		return nil, &ErrUnexpectedToken{tok, "data"}
 	}
+	pos := tok.Pos
 
+	// data<length>, or data[length] in the final specification
 	tok, err = scanner.Next()
-	if err != nil {
+	if err == io.EOF {
+		return &DataType{0, pos}, nil
+	} else if err != nil {
 		return nil, err
 	}
-	if tok.Token != TLANGLE {
+	var closing TokenKind
+	switch tok.Token {
+	case TLANGLE:
+		closing = TRANGLE
+	case TLBRACKET:
+		closing = TRBRACKET
+	default:
 		scanner.PushBack(tok)
-		return &DataType{0}, nil
+		return &DataType{0, pos}, nil
 	}
 
-	tok, err = scanner.Next()
+	length, err := parseLength(scanner, closing)
 	if err != nil {
 		return nil, err
 	}
+
+	return &DataType{length, pos}, nil
+}
+
+// Parses an integer length followed by the given closing token.
+func parseLength(scanner *Scanner, closing TokenKind) (uint, error) {
+	tok, err := scanner.Next()
+	if err != nil {
+		return 0, err
+	}
 	if tok.Token != TINTEGER {
-		return nil, &ErrUnexpectedToken{tok, "integer"}
+		return 0, &ErrUnexpectedToken{tok, "integer"}
 	}
 	length, _ := strconv.ParseUint(tok.Value, 10, 32)
 
 	tok, err = scanner.Next()
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
-	if tok.Token != TRANGLE {
-		return nil, &ErrUnexpectedToken{tok, ">"}
+	if tok.Token != closing {
+		return 0, &ErrUnexpectedToken{tok, Token{Token: closing}.String()}
 	}
 
-	return &DataType{uint(length)}, nil
+	return uint(length), nil
 }
 
 func parseMapType(scanner *Scanner) (Type, error) {
@@ -338,11 +449,25 @@ func parseMapType(scanner *Scanner) (Type, error) {
 	if tok.Token != TMAP {
 		return nil, &ErrUnexpectedToken{tok, "map"}
 	}
+	pos := tok.Pos
 
 	tok, err = scanner.Next()
 	if err != nil {
 		return nil, err
 	}
+	if tok.Token == TLANGLE {
+		// map<key><value> in the final specification
+		scanner.PushBack(tok)
+		key, err := parseAngled(scanner)
+		if err != nil {
+			return nil, err
+		}
+		value, err := parseAngled(scanner)
+		if err != nil {
+			return nil, err
+		}
+		return &MapType{key, value, pos}, nil
+	}
 	if tok.Token != TLBRACKET {
 		return nil, &ErrUnexpectedToken{tok, "["}
 	}
@@ -365,7 +490,67 @@ func parseMapType(scanner *Scanner) (Type, error) {
 		return nil, err
 	}
 
-	return &MapType{key, value}, nil
+	return &MapType{key, value, pos}, nil
+}
+
+// Parses a type enclosed in angle brackets.
+func parseAngled(scanner *Scanner) (Type, error) {
+	tok, err := scanner.Next()
+	if err != nil {
+		return nil, err
+	}
+	if tok.Token != TLANGLE {
+		return nil, &ErrUnexpectedToken{tok, "<"}
+	}
+
+	ty, err := parseType(scanner)
+	if err != nil {
+		return nil, err
+	}
+
+	tok, err = scanner.Next()
+	if err != nil {
+		return nil, err
+	}
+	if tok.Token != TRANGLE {
+		return nil, &ErrUnexpectedToken{tok, ">"}
+	}
+	return ty, nil
+}
+
+// Parses list<type> or list<type>[length], from the final specification.
+func parseListType(scanner *Scanner) (Type, error) {
+	tok, err := scanner.Next()
+	if err != nil {
+		return nil, err
+	}
+	if tok.Token != TLIST {
+		return nil, &ErrUnexpectedToken{tok, "list"}
+	}
+	pos := tok.Pos
+
+	member, err := parseAngled(scanner)
+	if err != nil {
+		return nil, err
+	}
+
+	tok, err = scanner.Next()
+	if err == io.EOF {
+		return &ArrayType{member, 0, pos}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if tok.Token != TLBRACKET {
+		scanner.PushBack(tok)
+		return &ArrayType{member, 0, pos}, nil
+	}
+
+	length, err := parseLength(scanner, TRBRACKET)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ArrayType{member, length, pos}, nil
 }
 
 func parseArrayType(scanner *Scanner) (Type, error) {
@@ -376,6 +561,7 @@ func parseArrayType(scanner *Scanner) (Type, error) {
 	if tok.Token != TLBRACKET {
 		return nil, &ErrUnexpectedToken{tok, "["}
 	}
+	pos := tok.Pos
 
 	tok, err = scanner.Next()
 	if err != nil {
@@ -407,7 +593,7 @@ func parseArrayType(scanner *Scanner) (Type, error) {
 		return nil, err
 	}
 
-	return &ArrayType{member, length}, nil
+	return &ArrayType{member, length, pos}, nil
 }
 
 func parseUnionType(scanner *Scanner) (Type, error) {
@@ -415,15 +601,44 @@ func parseUnionType(scanner *Scanner) (Type, error) {
 	if err != nil {
 		return nil, err
 	}
-	if tok.Token != TLPAREN {
+	pos := tok.Pos
+
+	closing := TRPAREN
+	switch tok.Token {
+	case TLPAREN:
+	case TUNION:
+		// union { type | type | ... } in the final specification, which may
+		// have a leading and trailing '|'
+		tok, err = scanner.Next()
+		if err != nil {
+			return nil, err
+		}
+		if tok.Token != TLBRACE {
+			return nil, &ErrUnexpectedToken{tok, "{"}
+		}
+		closing = TRBRACE
+
+		tok, err = scanner.Next()
+		if err != nil {
+			return nil, err
+		}
+		if tok.Token != TPIPE {
+			scanner.PushBack(tok)
+		}
+	default:
 		return nil, &ErrUnexpectedToken{tok, "("}
 	}
+	expected := fmt.Sprintf("'|' or '%s'", Token{Token: closing})
 
 	var (
 		types []UnionSubtype
 		tag   uint64
 	)
 	for {
+		tyPos, err := nextPos(scanner)
+		if err != nil {
+			return nil, err
+		}
 		ty, err := parseType(scanner)
 		if err != nil {
 			return nil, err
@@ -449,6 +664,7 @@ func parseUnionType(scanner *Scanner) (Type, error) {
 		types = append(types, UnionSubtype{
 			subtype: ty,
 			tag:     tag,
+			pos:     tyPos,
 		})
 		tag++
 
@@ -457,16 +673,25 @@ func parseUnionType(scanner *Scanner) (Type, error) {
 			return nil, err
 		}
 
-		if tok.Token == TPIPE {
+		if tok.Token == TPIPE && closing == TRBRACE {
+			tok, err = scanner.Next()
+			if err != nil {
+				return nil, err
+			}
+			if tok.Token == TRBRACE {
+				break
+			}
+			scanner.PushBack(tok)
+		} else if tok.Token == TPIPE {
 			continue
-		} else if tok.Token == TRPAREN {
+		} else if tok.Token == closing {
 			break
 		} else {
-			return nil, &ErrUnexpectedToken{tok, "'|' or ')'"}
+			return nil, &ErrUnexpectedToken{tok, expected}
 		}
 	}
 
-	return &UnionType{types}, nil
+	return &UnionType{types, pos, tok.Pos}, nil
 }
 
 func parseStructType(scanner *Scanner) (Type, error) {
@@ -474,8 +699,16 @@ func parseStructType(scanner *Scanner) (Type, error) {
 	if err != nil {
 		return nil, err
 	}
+	pos := tok.Pos
+	if tok.Token == TSTRUCT {
+		// struct { fields... } in the final specification
+		tok, err = scanner.Next()
+		if err != nil {
+			return nil, err
+		}
+	}
 	if tok.Token != TLBRACE {
-		return nil, &ErrUnexpectedToken{tok, "["}
+		return nil, &ErrUnexpectedToken{tok, "{"}
 	}
 
 	var fields []StructField
@@ -489,13 +722,16 @@ func parseStructType(scanner *Scanner) (Type, error) {
 		if tok.Token == TRBRACE {
 			break
 		}
-		if tok.Token != TNAME {
+		if tok.isKeyword() {
+			tok.Value = tok.String()
+		} else if tok.Token != TNAME {
 			return nil, &ErrUnexpectedToken{tok, "field name"}
 		}
 
 		sf.name = tok.Value
+		sf.pos = tok.Pos
 		if !fieldNameRE.MatchString(sf.name) {
-			return nil, fmt.Errorf("Invalid name for field %s", sf.name)
+			return nil, errorf(sf.pos, "Invalid name for field %s", sf.name)
 		}
 
 		tok, err = scanner.Next()
@@ -514,5 +750,5 @@ func parseStructType(scanner *Scanner) (Type, error) {
 		fields = append(fields, sf)
 	}
 
-	return &StructType{fields}, nil
+	return &StructType{fields, pos, scanner.last}, nil
 }
@@ -305,3 +305,175 @@ func TestParseEnumType(t *testing.T) {
 	assert.Equal(t, "MyEnumUint", ude.Name())
 	assert.Equal(t, UINT, ude.Kind())
 }
+
+
+func TestParsePositions(t *testing.T) {
+	types, err := ParseFile("test.bare", strings.NewReader(
+		"type MyStruct {\n\tx: i32\n\ty: (A | map[string]B)\n}\n\nenum MyEnum {\n\tFOO\n}"))
+	assert.NoError(t, err)
+	assert.Len(t, types, 2)
+
+	udt := types[0].(*UserDefinedType)
+	assert.Equal(t, Pos{"test.bare", 1, 6}, udt.Pos())
+	st := udt.Type().(*StructType)
+	assert.Equal(t, Pos{"test.bare", 1, 15}, st.Pos())
+	f := st.Fields()[0]
+	assert.Equal(t, Pos{"test.bare", 2, 2}, f.Pos())
+	assert.Equal(t, Pos{"test.bare", 2, 5}, f.Type().(*PrimitiveType).Pos())
+	ut := st.Fields()[1].Type().(*UnionType)
+	assert.Equal(t, Pos{"test.bare", 3, 5}, ut.Pos())
+	assert.Equal(t, Pos{"test.bare", 3, 6}, ut.Types()[0].Pos())
+	assert.Equal(t, Pos{"test.bare", 3, 10}, ut.Types()[1].Pos())
+	assert.Equal(t, Pos{"test.bare", 3, 10}, ut.Types()[1].Type().(*MapType).Pos())
+
+	ude := types[1].(*UserDefinedEnum)
+	assert.Equal(t, Pos{"test.bare", 6, 6}, ude.Pos())
+	assert.Equal(t, Pos{"test.bare", 7, 2}, ude.Values()[0].Pos())
+}
+
+func TestParseErrors(t *testing.T) {
+	cases := map[string]string{
+		"type Foo {\n\tx: }":     "test.bare:2:5: Unexpected token '}'; expected type",
+		"type Foo {\n\tX: u8\n}": "test.bare:2:2: Invalid name for field X",
+		"enum Foo {\n\tfoo\n}":   "test.bare:2:2: Invalid name for enum value foo",
+		"type foo u8":            "test.bare:1:6: Invalid name for user type foo",
+		"type Foo {\n\tx: u8":    "test.bare:2:7: Unexpected end of file",
+		"type Foo $":             "test.bare:1:10: Unknown token '$'",
+	}
+	for input, expected := range cases {
+		_, err := ParseFile("test.bare", strings.NewReader(input))
+		assert.EqualError(t, err, expected, input)
+	}
+}
+
+func TestParseFinalDialect(t *testing.T) {
+	draft, err := Parse(strings.NewReader(`
+		type PublicKey data<128>
+		type Time string
+
+		enum Department {
+			ACCOUNTING
+			ADMINISTRATION
+			JSMITH = 99
+			JDOE
+		}
+
+		type Customer {
+			name: string
+			orders: []{
+				orderId: i64
+				quantity: i32
+			}
+			metadata: map[string]data
+			keys: [4]PublicKey
+		}
+
+		type TerminatedEmployee void
+
+		type Person (Customer | TerminatedEmployee = 5 | optional<Time>)
+		type Data data`))
+	assert.NoError(t, err)
+
+	final, err := Parse(strings.NewReader(`
+		type PublicKey data[128]
+		type Time str
+
+		type Department enum {
+			ACCOUNTING
+			ADMINISTRATION
+			JSMITH = 99
+			JDOE
+		}
+
+		type Customer struct {
+			name: str
+			orders: list<struct {
+				orderId: i64
+				quantity: i32
+			}>
+			metadata: map<str><data>
+			keys: list<PublicKey>[4]
+		}
+
+		type TerminatedEmployee void
+
+		type Person union {
+			| Customer
+			| TerminatedEmployee = 5
+			| optional<Time>
+		}
+		type Data data`))
+	assert.NoError(t, err)
+
+	assert.Len(t, final, len(draft))
+	for i := range draft {
+		assert.Equal(t, draft[i].Name(), final[i].Name())
+		switch d := draft[i].(type) {
+		case *UserDefinedType:
+			assertSameType(t, d.Type(), final[i].(*UserDefinedType).Type())
+		case *UserDefinedEnum:
+			f := final[i].(*UserDefinedEnum)
+			assert.Equal(t, d.Kind(), f.Kind())
+			assert.Len(t, f.Values(), len(d.Values()))
+			for j, ev := range d.Values() {
+				assert.Equal(t, ev.Name(), f.Values()[j].Name())
+				assert.Equal(t, ev.Value(), f.Values()[j].Value())
+			}
+		}
+	}
+
+	ude := draft[2].(*UserDefinedEnum)
+	assert.Equal(t, uint(100), ude.Values()[3].Value())
+}
+
+// Asserts that two types are the same, except for their positions.
+func assertSameType(t *testing.T, a, b Type) {
+	if !assert.Equal(t, a.Kind(), b.Kind()) {
+		return
+	}
+	switch a := a.(type) {
+	case *OptionalType:
+		assertSameType(t, a.Subtype(), b.(*OptionalType).Subtype())
+	case *DataType:
+		assert.Equal(t, a.Length(), b.(*DataType).Length())
+	case *MapType:
+		assertSameType(t, a.Key(), b.(*MapType).Key())
+		assertSameType(t, a.Value(), b.(*MapType).Value())
+	case *ArrayType:
+		assert.Equal(t, a.Length(), b.(*ArrayType).Length())
+		assertSameType(t, a.Member(), b.(*ArrayType).Member())
+	case *UnionType:
+		bt := b.(*UnionType).Types()
+		if assert.Len(t, bt, len(a.Types())) {
+			for i, ust := range a.Types() {
+				assert.Equal(t, ust.Tag(), bt[i].Tag())
+				assertSameType(t, ust.Type(), bt[i].Type())
+			}
+		}
+	case *StructType:
+		bf := b.(*StructType).Fields()
+		if assert.Len(t, bf, len(a.Fields())) {
+			for i, field := range a.Fields() {
+				assert.Equal(t, field.Name(), bf[i].Name())
+				assertSameType(t, field.Type(), bf[i].Type())
+			}
+		}
+	case *NamedUserType:
+		assert.Equal(t, a.Name(), b.(*NamedUserType).Name())
+	}
+}
+
+func TestParseKeywordFieldNames(t *testing.T) {
+	types, err := Parse(strings.NewReader(`
+		type Keywords struct {
+			list: list<u8>
+			struct: str
+			type: data
+		}`))
+	assert.NoError(t, err)
+
+	st := types[0].(*UserDefinedType).Type().(*StructType)
+	assert.Equal(t, "list", st.Fields()[0].Name())
+	assert.Equal(t, "struct", st.Fields()[1].Name())
+	assert.Equal(t, "type", st.Fields()[2].Name())
+}
@@ -0,0 +1,47 @@
+package schema
+
+import "fmt"
+
+// A position in a schema document. Lines and columns start at 1; columns are
+// counted in characters.
+type Pos struct {
+	File   string
+	Line   int
+	Column int
+}
+
+// Reports whether the position is known.
+func (p Pos) IsValid() bool {
+	return p.Line > 0
+}
+
+// Formats the position as "file:line:column", omitting the parts which are
+// not known.
+func (p Pos) String() string {
+	s := p.File
+	if p.IsValid() {
+		if s != "" {
+			s += ":"
+		}
+		s += fmt.Sprintf("%d:%d", p.Line, p.Column)
+	}
+	if s == "" {
+		s = "-"
+	}
+	return s
+}
+
+// Returned when a schema document is invalid, other than because of an
+// unexpected token.
+type ErrInvalid struct {
+	Pos Pos
+	Msg string
+}
+
+func (e *ErrInvalid) Error() string {
+	return fmt.Sprintf("%s: %s", e.Pos, e.Msg)
+}
+
+func errorf(pos Pos, format string, args ...interface{}) error {
+	return &ErrInvalid{pos, fmt.Sprintf(format, args...)}
+}
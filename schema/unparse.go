@@ -4,8 +4,12 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"io"
 	"reflect"
 	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
 
 	bare "git.sr.ht/~runxiyu/go-bareish"
 )
@@ -13,8 +17,20 @@ import (
 var (
 	intType  = reflect.TypeOf(bare.Int(0))
 	uintType = reflect.TypeOf(bare.Uint(0))
+
+	marshalableInterface = reflect.TypeOf((*bare.Marshalable)(nil)).Elem()
+	unionInterface       = reflect.TypeOf((*bare.Union)(nil)).Elem()
+	enumInterface        = reflect.TypeOf((*Enum)(nil)).Elem()
 )
 
+// Named unsigned integer types which implement this interface are declared as
+// enums by DocumentFor, with the values it returns. See NewEnumValue. They are
+// also a bare.Enum, whose IsValid method should accept the same values.
+type Enum interface {
+	bare.Enum
+	EnumValues() []EnumValue
+}
+
 // Given a pointer to a value, returns the BARE schema language representation
 // for that value type.
 //
@@ -35,79 +51,333 @@ func SchemaFor(val interface{}) (string, error) {
 
 // Given a reflect.Type, returns the BARE schema language representation for
 // that type. See SchemaFor for details.
+//
+// The type itself is written out in full, and the named types it refers to by
+// their name; use DocumentFor to get their declarations as well.
 func SchemaForType(t reflect.Type) (string, error) {
-	// TODO: Implement user-defined types for unparsing schemas from
-	if t.Kind() == reflect.Ptr {
-		schema, err := SchemaForType(t.Elem())
+	m := newTypeMapper()
+	ty, err := m.expand(t)
+	if err != nil {
+		return "", err
+	}
+	return FormatType(ty), nil
+}
+
+// Given pointers to values, returns a BARE schema language document declaring
+// their types and all of the named types they refer to. See TypesFor for how
+// Go types are described.
+//
+// var person Person // a union interface
+// schema.DocumentFor(&person)
+func DocumentFor(vals ...interface{}) (string, error) {
+	types, err := TypesFor(vals...)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := Format(&buf, types); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// Given pointers to values of named types, returns the declarations of these
+// types and of all of the named types they refer to, in the order they are
+// first encountered. The types are described as Marshal encodes them:
+//
+//   - named types declare a user-defined type, and are referred to by name
+//   - named unsigned integer types which implement Enum declare an enum
+//   - union interfaces are unions of the members given to bare.RegisterUnion
+//   - structs have a field for each field without the "-" tag, named after the
+//     "bare" tag or the Go field name; a struct without any fields, or with a
+//     "bare" tag which is not a valid field name, causes an error
+//   - pointers are optional types
+//   - []byte and [N]byte are data and data<N>
+//   - other slices, arrays and maps are []T, [N]T and map[K]V
+//   - bare.Int and bare.Uint, like int and uint, are int and uint
+//
+// Types with a codec (see bare.RegisterCodec) are described by the schema given
+// to Codec.WithSchema. Other types with a custom encoding (see
+// bare.Marshalable) have no known schema and cause an error, like types which
+// Marshal does not support.
+func TypesFor(vals ...interface{}) ([]SchemaType, error) {
+	m := newTypeMapper()
+	for _, val := range vals {
+		t := reflect.TypeOf(val)
+		if t == nil || t.Kind() != reflect.Ptr {
+			return nil, errors.New("Expected val to be pointer type")
+		}
+		t = t.Elem()
+		if !isDeclared(t) {
+			return nil, fmt.Errorf("Type %s has no name to declare", t)
+		}
+		if _, err := m.typeFor(t); err != nil {
+			return nil, err
+		}
+	}
+	return m.decls, nil
+}
+
+// Builds the schema types describing Go types.
+type typeMapper struct {
+	decls    []SchemaType
+	declared map[reflect.Type]string
+	names    map[string]reflect.Type
+}
+
+func newTypeMapper() *typeMapper {
+	return &typeMapper{
+		declared: make(map[reflect.Type]string),
+		names:    make(map[string]reflect.Type),
+	}
+}
+
+// Reports whether a type is declared as a user-defined type, rather than
+// written out where it is used.
+func isDeclared(t reflect.Type) bool {
+	return t.Name() != "" && t.PkgPath() != "" && t.PkgPath() != intType.PkgPath()
+}
+
+// Returns the schema type for a Go type, declaring it if it is named.
+func (m *typeMapper) typeFor(t reflect.Type) (Type, error) {
+	if name, ok := m.declared[t]; ok {
+		return NewNamedUserType(name), nil
+	}
+	if !isDeclared(t) {
+		return m.expand(t)
+	}
+
+	r, size := utf8.DecodeRuneInString(t.Name())
+	name := string(unicode.ToUpper(r)) + t.Name()[size:]
+	if other, ok := m.names[name]; ok {
+		return nil, fmt.Errorf("Types %s and %s are both named %s", other, t, name)
+	}
+	m.declared[t] = name
+	m.names[name] = t
+
+	// Reserve the place of the declaration before the types it refers to
+	i := len(m.decls)
+	m.decls = append(m.decls, nil)
+	if reflect.PtrTo(t).Implements(enumInterface) {
+		ude, err := enumFor(name, t)
 		if err != nil {
-			return "", err
+			return nil, err
 		}
-		return fmt.Sprintf("optional<%s>", schema), nil
+		m.decls[i] = ude
+	} else {
+		ty, err := m.expand(t)
+		if err != nil {
+			return nil, err
+		}
+		m.decls[i] = NewUserDefinedType(name, ty)
+	}
+	return NewNamedUserType(name), nil
+}
+
+func enumFor(name string, t reflect.Type) (*UserDefinedEnum, error) {
+	var kind TypeKind
+	switch t.Kind() {
+	case reflect.Uint:
+		kind = UINT
+	case reflect.Uint8:
+		kind = U8
+	case reflect.Uint16:
+		kind = U16
+	case reflect.Uint32:
+		kind = U32
+	case reflect.Uint64:
+		kind = U64
+		if t == uintType {
+			kind = UINT
+		}
+	default:
+		return nil, fmt.Errorf("Enum type %s is not an unsigned integer", t)
+	}
+	values := reflect.New(t).Interface().(Enum).EnumValues()
+	return NewUserDefinedEnum(name, kind, values), nil
+}
+
+// Returns the schema type for a Go type, written out in full even if it is
+// named.
+func (m *typeMapper) expand(t reflect.Type) (Type, error) {
+	if c, ok := bare.CodecFor(t); ok {
+		return codecType(c)
+	}
+	if reflect.PtrTo(t).Implements(marshalableInterface) {
+		return nil, fmt.Errorf("Type %s has a custom encoding with no known schema", t)
 	}
 
 	switch t {
 	case intType:
-		return "int", nil
+		return NewPrimitiveType(INT), nil
 	case uintType:
-		return "uint", nil
+		return NewPrimitiveType(UINT), nil
 	}
 
 	switch t.Kind() {
+	case reflect.Ptr:
+		subtype, err := m.typeFor(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return NewOptionalType(subtype), nil
 	case reflect.Uint8:
-		return "u8", nil
+		return NewPrimitiveType(U8), nil
 	case reflect.Uint16:
-		return "u16", nil
+		return NewPrimitiveType(U16), nil
 	case reflect.Uint32:
-		return "u32", nil
+		return NewPrimitiveType(U32), nil
 	case reflect.Uint64:
-		return "u64", nil
+		return NewPrimitiveType(U64), nil
 	case reflect.Uint:
-		return "uint", nil
+		return NewPrimitiveType(UINT), nil
 	case reflect.Int8:
-		return "i8", nil
+		return NewPrimitiveType(I8), nil
 	case reflect.Int16:
-		return "i16", nil
+		return NewPrimitiveType(I16), nil
 	case reflect.Int32:
-		return "i32", nil
+		return NewPrimitiveType(I32), nil
 	case reflect.Int64:
-		return "i64", nil
+		return NewPrimitiveType(I64), nil
 	case reflect.Int:
-		return "int", nil
+		return NewPrimitiveType(INT), nil
 	case reflect.Float32:
-		return "f32", nil
+		return NewPrimitiveType(F32), nil
 	case reflect.Float64:
-		return "f64", nil
+		return NewPrimitiveType(F64), nil
 	case reflect.Bool:
-		return "bool", nil
+		return NewPrimitiveType(Bool), nil
 	case reflect.String:
-		return "string", nil
+		return NewPrimitiveType(String), nil
+	case reflect.Slice:
+		if isByte(t.Elem()) {
+			return NewDataType(0), nil
+		}
+		member, err := m.typeFor(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return NewArrayType(member, 0), nil
+	case reflect.Array:
+		if t.Len() == 0 {
+			return nil, fmt.Errorf("Array type %s has no elements", t)
+		}
+		if isByte(t.Elem()) {
+			return NewDataType(uint(t.Len())), nil
+		}
+		member, err := m.typeFor(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return NewArrayType(member, uint(t.Len())), nil
+	case reflect.Map:
+		key, err := m.typeFor(t.Key())
+		if err != nil {
+			return nil, err
+		}
+		value, err := m.typeFor(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return NewMapType(key, value), nil
+	case reflect.Interface:
+		if t.Implements(unionInterface) {
+			return m.unionFor(t)
+		}
 	case reflect.Struct:
-		return schemaForStruct(t)
-	default:
-		return "", &bare.UnsupportedTypeError{t}
+		return m.structFor(t)
+	}
+	return nil, &bare.UnsupportedTypeError{Type: t}
+}
+
+// Returns the schema type given for a codec by Codec.WithSchema.
+func codecType(c *bare.Codec) (Type, error) {
+	schema := c.Schema()
+	if schema == "" {
+		return nil, fmt.Errorf("Type %s has a custom encoding with no known schema", c.Type())
+	}
+	scanner := NewScanner(strings.NewReader(schema))
+	ty, err := parseType(scanner)
+	if err == nil {
+		// The schema must be a single type
+		if tok, err2 := scanner.Next(); err2 != io.EOF {
+			err = &ErrUnexpectedToken{tok, "end of schema"}
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Type %s has an invalid schema %q: %v", c.Type(), schema, err)
+	}
+	return ty, nil
+}
+
+// Reports whether the elements of a slice or array are written as data.
+func isByte(t reflect.Type) bool {
+	return t.Kind() == reflect.Uint8 && !isDeclared(t)
+}
+
+func (m *typeMapper) unionFor(t reflect.Type) (Type, error) {
+	ut, ok := bare.UnionFor(t)
+	if !ok {
+		return nil, fmt.Errorf("Union type %s is not registered", t)
+	}
+	ub := NewUnionBuilder()
+	for _, tag := range ut.Tags() {
+		mt, _ := ut.TypeFor(tag)
+		member, err := m.typeFor(mt)
+		if err != nil {
+			return nil, err
+		}
+		ub.TypeTag(member, tag)
 	}
+	return ub.Build(), nil
 }
 
-var tagFieldNameRE = regexp.MustCompile(`"[a-z][A-Za-z0-9]*"`)
+var tagFieldNameRE = regexp.MustCompile(`^[a-z][A-Za-z0-9]*$`)
 
-func schemaForStruct(t reflect.Type) (string, error) {
-	buf := bytes.NewBufferString("{\n")
+func (m *typeMapper) structFor(t reflect.Type) (Type, error) {
+	sb := NewStructBuilder()
+	fields := 0
 	for i := 0; i < t.NumField(); i++ {
 		field := t.Field(i)
-		schema, err := SchemaForType(field.Type)
-		if err != nil {
-			return "", err
-		}
-		// TODO: Convert Go names into valid schema names
-		name := field.Name
-		if tag, ok := field.Tag.Lookup("bare"); ok {
-			name = tagFieldNameRE.FindString(tag)
-			if name == "" {
-				name = field.Name
+		tag := field.Tag.Get("bare")
+		if tag == "-" {
+			continue
+		}
+		name := fieldName(field.Name)
+		if tag != "" {
+			if !tagFieldNameRE.MatchString(tag) {
+				return nil, fmt.Errorf("Field %s of type %s has invalid bare tag %q",
+					field.Name, t, tag)
 			}
+			name = tag
+		}
+		ty, err := m.typeFor(field.Type)
+		if err != nil {
+			return nil, err
 		}
-		buf.WriteString(fmt.Sprintf("\t%s: %s\n", name, schema))
+		sb.Field(name, ty)
+		fields++
 	}
-	buf.WriteString("}")
-	return buf.String(), nil
+	if fields == 0 {
+		return nil, fmt.Errorf("Struct type %s has no fields", t)
+	}
+	return sb.Build(), nil
+}
+
+// Converts a Go field name into a schema field name, by making its first word
+// lower case: ID becomes id, and HTTPServer httpServer.
+func fieldName(name string) string {
+	runes := []rune(name)
+	n := 0
+	for n < len(runes) && unicode.IsUpper(runes[n]) {
+		n++
+	}
+	if n > 1 && n < len(runes) {
+		// The last upper case letter starts the next word
+		n--
+	}
+	for i := 0; i < n; i++ {
+		runes[i] = unicode.ToLower(runes[i])
+	}
+	return string(runes)
 }
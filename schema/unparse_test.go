@@ -1,9 +1,12 @@
 package schema
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+
+	bare "git.sr.ht/~runxiyu/go-bareish"
 )
 
 func TestUnparseValue(t *testing.T) {
@@ -91,3 +94,211 @@ func TestUnparseOptional(t *testing.T) {
 	assert.Equal(t, schema, "optional<string>",
 		"Expected SchemaFor to return optional<string>")
 }
+
+func TestUnparseCollections(t *testing.T) {
+	var (
+		slice  []string
+		array  [4]int16
+		m      map[string][]uint
+		data   []byte
+		fixed  [16]byte
+		varint map[bare.Uint]*bare.Int
+	)
+	for _, tc := range []struct {
+		val      interface{}
+		expected string
+	}{
+		{&slice, "[]string"},
+		{&array, "[4]i16"},
+		{&m, "map[string][]uint"},
+		{&data, "data"},
+		{&fixed, "data<16>"},
+		{&varint, "map[uint]optional<int>"},
+	} {
+		schema, err := SchemaFor(tc.val)
+		assert.NoError(t, err)
+		assert.Equal(t, tc.expected, schema)
+	}
+}
+
+type docColor uint8
+
+const (
+	docRed docColor = iota
+	docGreen
+	docBlue = 10
+)
+
+func (c docColor) IsValid() bool {
+	return c == docRed || c == docGreen || c == docBlue
+}
+
+func (c docColor) EnumValues() []EnumValue {
+	return []EnumValue{
+		NewEnumValue("RED", uint(docRed)),
+		NewEnumValue("GREEN", uint(docGreen)),
+		NewEnumValue("BLUE", uint(docBlue)),
+	}
+}
+
+type DocKey [32]byte
+
+type DocNode struct {
+	ID       bare.Uint
+	Label    string `bare:"name"`
+	Color    docColor
+	Key      *DocKey
+	Children []DocNode
+	Cache    map[string]int `bare:"-"`
+}
+
+type DocShape interface{ bare.Union }
+
+type DocCircle struct{ Radius float64 }
+type DocSquare struct{ HTTPSide float32 }
+
+func (DocCircle) IsUnion() {}
+func (DocSquare) IsUnion() {}
+
+func init() {
+	bare.RegisterUnion((*DocShape)(nil)).
+		Member(*new(DocCircle), 1).
+		Member(*new(DocSquare), 5)
+}
+
+type docCustom string
+
+func (c *docCustom) Marshal(w *bare.Writer) error {
+	return w.WriteString(string(*c))
+}
+
+type docUnregistered interface{ bare.Union }
+
+type docBadTag struct {
+	N int `bare:"Not-a-name"`
+}
+
+type docEmpty struct {
+	Skipped int `bare:"-"`
+}
+
+func TestDocumentFor(t *testing.T) {
+	var (
+		node  DocNode
+		shape DocShape
+	)
+	doc, err := DocumentFor(&node, &shape)
+	assert.NoError(t, err)
+	assert.Equal(t, `type DocNode {
+	id: uint
+	name: string
+	color: DocColor
+	key: optional<DocKey>
+	children: []DocNode
+}
+
+enum DocColor u8 {
+	RED
+	GREEN
+	BLUE = 10
+}
+
+type DocKey data<32>
+
+type DocShape (DocCircle = 1 | DocSquare = 5)
+
+type DocCircle {
+	radius: f64
+}
+
+type DocSquare {
+	httpSide: f32
+}
+`, doc)
+
+	types, err := Parse(strings.NewReader(doc))
+	assert.NoError(t, err)
+	assert.Empty(t, Check(types))
+}
+
+func TestDocumentForErrors(t *testing.T) {
+	var (
+		custom       struct{ C docCustom }
+		unregistered struct{ U docUnregistered }
+		unnamed      []string
+		channel      struct{ C chan int }
+		badTag       docBadTag
+		empty        docEmpty
+	)
+	_, err := SchemaFor(&custom)
+	assert.EqualError(t, err,
+		"Type schema.docCustom has a custom encoding with no known schema")
+	_, err = SchemaFor(&unregistered)
+	assert.EqualError(t, err, "Union type schema.docUnregistered is not registered")
+	_, err = DocumentFor(&unnamed)
+	assert.EqualError(t, err, "Type []string has no name to declare")
+	_, err = SchemaFor(&channel)
+	assert.IsType(t, &bare.UnsupportedTypeError{}, err)
+	_, err = SchemaFor(&badTag)
+	assert.EqualError(t, err,
+		`Field N of type schema.docBadTag has invalid bare tag "Not-a-name"`)
+	_, err = SchemaFor(&empty)
+	assert.EqualError(t, err, "Struct type schema.docEmpty has no fields")
+}
+
+type codecPoint struct{ x, y float64 }
+
+type codecNoSchema struct{ n int }
+
+type codecInvalid struct{ n int }
+
+func init() {
+	bare.RegisterCodecOf(func(w *bare.Writer, p *codecPoint) error {
+		return nil
+	}, func(r *bare.Reader, p *codecPoint) error {
+		return nil
+	}).WithSchema("struct { x: f64 y: f64 }")
+	bare.RegisterCodecOf(func(w *bare.Writer, v *codecNoSchema) error {
+		return nil
+	}, func(r *bare.Reader, v *codecNoSchema) error {
+		return nil
+	})
+	bare.RegisterCodecOf(func(w *bare.Writer, v *codecInvalid) error {
+		return nil
+	}, func(r *bare.Reader, v *codecInvalid) error {
+		return nil
+	}).WithSchema("uint uint")
+}
+
+func TestSchemaForCodecs(t *testing.T) {
+	var points map[string]codecPoint
+	schema, err := SchemaFor(&points)
+	assert.NoError(t, err)
+	assert.Equal(t, "map[string]CodecPoint", schema)
+
+	type shape struct {
+		Points []codecPoint
+	}
+	var s shape
+	doc, err := DocumentFor(&s)
+	assert.NoError(t, err)
+	assert.Equal(t, `type Shape {
+	points: []CodecPoint
+}
+
+type CodecPoint {
+	x: f64
+	y: f64
+}
+`, doc)
+
+	var noSchema codecNoSchema
+	_, err = SchemaFor(&noSchema)
+	assert.EqualError(t, err,
+		"Type schema.codecNoSchema has a custom encoding with no known schema")
+	var invalid codecInvalid
+	_, err = SchemaFor(&invalid)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(),
+		`Type schema.codecInvalid has an invalid schema "uint uint"`)
+}
@@ -0,0 +1,97 @@
+package schema
+
+// A dynamically typed BARE value, decoded according to a schema rather than a
+// Go type. See DecodeDynamic.
+//
+// The concrete type of a value depends on the schema type it represents:
+//
+//	uint, u8, u16, u32, u64       UintValue
+//	int, i8, i16, i32, i64        IntValue
+//	f32, f64                      FloatValue
+//	bool                          BoolValue
+//	string                        StringValue
+//	data, data<N>                 DataValue
+//	void                          VoidValue
+//	optional<T>                   OptionalValue
+//	[]T, [N]T                     ListValue
+//	map[K]V                       MapValue
+//	{ fields... }                 StructValue
+//	(T | T | ...)                 UnionValue
+//	enum                          UserEnumValue
+type Value interface {
+	isValue()
+}
+
+type UintValue uint64
+
+type IntValue int64
+
+type FloatValue float64
+
+type BoolValue bool
+
+type StringValue string
+
+type DataValue []byte
+
+type VoidValue struct{}
+
+// An optional value. Value is nil if the value is not present.
+type OptionalValue struct {
+	Value Value
+}
+
+type ListValue []Value
+
+// The entries of a map, in the order they appear in the message.
+type MapValue []MapEntry
+
+type MapEntry struct {
+	Key   Value
+	Value Value
+}
+
+// The fields of a struct, in the order they appear in the schema.
+type StructValue []FieldValue
+
+type FieldValue struct {
+	Name  string
+	Value Value
+}
+
+// Returns the value of the named field.
+func (sv StructValue) Field(name string) (Value, bool) {
+	for _, field := range sv {
+		if field.Name == name {
+			return field.Value, true
+		}
+	}
+	return nil, false
+}
+
+// A value of one of the types of a union, identified by its tag.
+type UnionValue struct {
+	Tag   uint64
+	Value Value
+}
+
+// A value of a user-defined enum. When encoding, the value is identified by
+// Name, unless it is empty.
+type UserEnumValue struct {
+	Name  string
+	Value uint
+}
+
+func (UintValue) isValue()     {}
+func (IntValue) isValue()      {}
+func (FloatValue) isValue()    {}
+func (BoolValue) isValue()     {}
+func (StringValue) isValue()   {}
+func (DataValue) isValue()     {}
+func (VoidValue) isValue()     {}
+func (OptionalValue) isValue() {}
+func (ListValue) isValue()     {}
+func (MapValue) isValue()      {}
+func (StructValue) isValue()   {}
+func (UnionValue) isValue()    {}
+func (UserEnumValue) isValue() {}
@@ -0,0 +1,140 @@
+package schema
+
+// A Visitor's Visit method is called by Walk for each type. If the visitor w
+// it returns is not nil, Walk visits each of the children of the type with w,
+// followed by a call of w.Visit(nil).
+type Visitor interface {
+	Visit(ty Type) (w Visitor)
+}
+
+// Traverses a type tree in depth-first order: it calls v.Visit(ty), then
+// walks the children of the type with the visitor it returns. The children
+// are the subtype of optional types, the member of arrays, the key and value
+// of maps, the subtypes of unions and the field types of structs. Walk does
+// not follow named user types to their declaration.
+func Walk(v Visitor, ty Type) {
+	if v = v.Visit(ty); v == nil {
+		return
+	}
+
+	switch ty := ty.(type) {
+	case *OptionalType:
+		Walk(v, ty.Subtype())
+	case *ArrayType:
+		Walk(v, ty.Member())
+	case *MapType:
+		Walk(v, ty.Key())
+		Walk(v, ty.Value())
+	case *UnionType:
+		for _, ust := range ty.Types() {
+			Walk(v, ust.Type())
+		}
+	case *StructType:
+		for _, field := range ty.Fields() {
+			Walk(v, field.Type())
+		}
+	}
+
+	v.Visit(nil)
+}
+
+type inspector func(Type) bool
+
+func (f inspector) Visit(ty Type) Visitor {
+	if f(ty) {
+		return f
+	}
+	return nil
+}
+
+// Traverses a type tree in depth-first order like Walk, calling f for each
+// type. The children of a type are skipped if f returns false for it. After
+// the children, f is called with nil.
+func Inspect(ty Type, f func(Type) bool) {
+	Walk(inspector(f), ty)
+}
+
+// Rewrites a type tree: f is called for each type after its children have
+// been rewritten, and the type it returns replaces the original one. Types
+// whose children are replaced are copied, so the original tree is left as it
+// was; the rest of the tree is shared with the result.
+func Rewrite(ty Type, f func(Type) Type) Type {
+	switch t := ty.(type) {
+	case *OptionalType:
+		if subtype := Rewrite(t.Subtype(), f); subtype != t.Subtype() {
+			copied := *t
+			copied.subtype = subtype
+			ty = &copied
+		}
+	case *ArrayType:
+		if member := Rewrite(t.Member(), f); member != t.Member() {
+			copied := *t
+			copied.member = member
+			ty = &copied
+		}
+	case *MapType:
+		key, value := Rewrite(t.Key(), f), Rewrite(t.Value(), f)
+		if key != t.Key() || value != t.Value() {
+			copied := *t
+			copied.key, copied.value = key, value
+			ty = &copied
+		}
+	case *UnionType:
+		var types []UnionSubtype
+		for i, ust := range t.Types() {
+			subtype := Rewrite(ust.Type(), f)
+			if subtype == ust.Type() && types == nil {
+				continue
+			}
+			if types == nil {
+				types = make([]UnionSubtype, len(t.Types()))
+				copy(types, t.Types())
+			}
+			types[i].subtype = subtype
+		}
+		if types != nil {
+			copied := *t
+			copied.types = types
+			ty = &copied
+		}
+	case *StructType:
+		var fields []StructField
+		for i, field := range t.Fields() {
+			fieldType := Rewrite(field.Type(), f)
+			if fieldType == field.Type() && fields == nil {
+				continue
+			}
+			if fields == nil {
+				fields = make([]StructField, len(t.Fields()))
+				copy(fields, t.Fields())
+			}
+			fields[i].type_ = fieldType
+		}
+		if fields != nil {
+			copied := *t
+			copied.fields = fields
+			ty = &copied
+		}
+	}
+	return f(ty)
+}
+
+// Rewrites the type of each user-defined type in a schema with Rewrite. The
+// declarations whose type is replaced are copied, and enums are kept as they
+// are.
+func RewriteSchema(types []SchemaType, f func(Type) Type) []SchemaType {
+	result := make([]SchemaType, len(types))
+	for i, st := range types {
+		result[i] = st
+		udt, ok := st.(*UserDefinedType)
+		if !ok {
+			continue
+		}
+		if ty := Rewrite(udt.Type(), f); ty != udt.Type() {
+			copied := *udt
+			copied.type_ = ty
+			result[i] = &copied
+		}
+	}
+	return result
+}
@@ -0,0 +1,76 @@
+package schema
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInspect(t *testing.T) {
+	types, err := Parse(strings.NewReader(`
+		type T {
+			a: optional<Named>
+			b: map[string][]u8
+			c: (Named | { d: bool })
+		}`))
+	assert.NoError(t, err)
+
+	var kinds []TypeKind
+	Inspect(types[0].(*UserDefinedType).Type(), func(ty Type) bool {
+		if ty == nil {
+			return false
+		}
+		kinds = append(kinds, ty.Kind())
+		// Skip the contents of unions
+		return ty.Kind() != Union
+	})
+	assert.Equal(t, []TypeKind{
+		Struct, Optional, UserType, Map, String, Slice, U8, Union,
+	}, kinds)
+}
+
+func TestRewrite(t *testing.T) {
+	types, err := Parse(strings.NewReader(`
+		type Name string
+		type T {
+			a: u8
+			b: [](string | Name)
+			c: map[string]optional<Name>
+		}`))
+	assert.NoError(t, err)
+
+	orig := types[1].(*UserDefinedType).Type().(*StructType)
+	rewritten := RewriteSchema(types, func(ty Type) Type {
+		if ty.Kind() == String {
+			return NewPrimitiveType(U64)
+		}
+		if named, ok := ty.(*NamedUserType); ok && named.Name() == "Name" {
+			return NewNamedUserType("Label")
+		}
+		return ty
+	})
+
+	var buf bytes.Buffer
+	assert.NoError(t, Format(&buf, rewritten))
+	assert.Equal(t, `type Name u64
+
+type T {
+	a: u8
+	b: [](u64 | Label)
+	c: map[u64]optional<Label>
+}
+`, buf.String())
+
+	// The original schema is unchanged, and unchanged parts are shared
+	buf.Reset()
+	assert.NoError(t, Format(&buf, types))
+	assert.Contains(t, buf.String(), "b: [](string | Name)")
+	st := rewritten[1].(*UserDefinedType).Type().(*StructType)
+	assert.True(t, st != orig)
+	assert.True(t, st.Fields()[0].Type() == orig.Fields()[0].Type())
+
+	same := RewriteSchema(types, func(ty Type) Type { return ty })
+	assert.True(t, same[1] == types[1])
+}
@@ -0,0 +1,132 @@
+package bare
+
+import (
+	"fmt"
+	"math/big"
+	"net"
+	"net/netip"
+	"net/url"
+	"sync"
+	"time"
+)
+
+var registerStandardCodecs sync.Once
+
+// Registers codecs (see RegisterCodec) for the following standard library
+// types, which may then be used in messages as they are:
+//
+//   - time.Time, as a string in RFC 3339 format with nanoseconds and the UTC
+//     offset of its location; the name of the location and the monotonic
+//     clock reading are lost, and years before 0 or after 9999 cannot be
+//     encoded
+//   - net.IP, as data of 4 bytes for IPv4 addresses and 16 bytes for IPv6
+//     addresses, or no bytes for nil
+//   - netip.Addr, as data in the format of its MarshalBinary method
+//   - url.URL, as a string
+//   - big.Int, as a string of its decimal representation
+//
+// Like other codecs, they must be registered during initialization, before
+// these types are first used. It is safe to call RegisterStandardCodecs more than once.
+func RegisterStandardCodecs() {
+	registerStandardCodecs.Do(func() {
+		RegisterCodecOf(encodeTime, decodeTime).WithSchema("string")
+		RegisterCodecOf(encodeIP, decodeIP).WithSchema("data")
+		RegisterCodecOf(encodeAddr, decodeAddr).WithSchema("data")
+		RegisterCodecOf(encodeURL, decodeURL).WithSchema("string")
+		RegisterCodecOf(encodeBigInt, decodeBigInt).WithSchema("string")
+	})
+}
+
+func encodeTime(w *Writer, t *time.Time) error {
+	if y := t.Year(); y < 0 || y > 9999 {
+		return fmt.Errorf("Year %d is outside the range of RFC 3339", y)
+	}
+	return w.WriteString(t.Format(time.RFC3339Nano))
+}
+
+func decodeTime(r *Reader, t *time.Time) error {
+	str, err := r.ReadString()
+	if err != nil {
+		return err
+	}
+	*t, err = time.Parse(time.RFC3339Nano, str)
+	return err
+}
+
+func encodeIP(w *Writer, ip *net.IP) error {
+	switch {
+	case *ip == nil:
+		return w.WriteData(nil)
+	case len(*ip) != net.IPv4len && len(*ip) != net.IPv6len:
+		return fmt.Errorf("Invalid IP address length %d", len(*ip))
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return w.WriteData(ip4)
+	}
+	return w.WriteData(*ip)
+}
+
+func decodeIP(r *Reader, ip *net.IP) error {
+	data, err := r.ReadData()
+	if err != nil {
+		return err
+	}
+	switch len(data) {
+	case 0:
+		*ip = nil
+	case net.IPv4len, net.IPv6len:
+		// data may refer to the input of UnmarshalNoCopy
+		*ip = append(net.IP(nil), data...)
+	default:
+		return fmt.Errorf("Invalid IP address length %d", len(data))
+	}
+	return nil
+}
+
+func encodeAddr(w *Writer, addr *netip.Addr) error {
+	data, err := addr.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return w.WriteData(data)
+}
+
+func decodeAddr(r *Reader, addr *netip.Addr) error {
+	data, err := r.ReadData()
+	if err != nil {
+		return err
+	}
+	return addr.UnmarshalBinary(data)
+}
+
+func encodeURL(w *Writer, u *url.URL) error {
+	return w.WriteString(u.String())
+}
+
+func decodeURL(r *Reader, u *url.URL) error {
+	str, err := r.ReadString()
+	if err != nil {
+		return err
+	}
+	parsed, err := url.Parse(str)
+	if err != nil {
+		return err
+	}
+	*u = *parsed
+	return nil
+}
+
+func encodeBigInt(w *Writer, i *big.Int) error {
+	return w.WriteString(i.String())
+}
+
+func decodeBigInt(r *Reader, i *big.Int) error {
+	str, err := r.ReadString()
+	if err != nil {
+		return err
+	}
+	if _, ok := i.SetString(str, 10); !ok {
+		return fmt.Errorf("Invalid integer %q", str)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package bare
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+)
+
+// An Encoder writes a stream of BARE messages to an output stream.
+type Encoder struct {
+	w *Writer
+}
+
+// Returns a new encoder that writes to w.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{NewWriter(w)}
+}
+
+// Writes the BARE encoding of val (which must be a pointer) to the stream. See
+// Marshal for details.
+func (e *Encoder) Encode(val interface{}) error {
+	return MarshalWriter(e.w, val)
+}
+
+// A Decoder reads a stream of consecutive BARE messages from an input stream.
+//
+// The decoder may buffer data read from the underlying reader beyond the end
+// of the last message decoded; use Buffered to recover it.
+type Decoder struct {
+	br *bufio.Reader
+	lr limitedReader
+	r  *Reader
+	// Options given to DecodeOptions.NewDecoder, whose defaults are
+	// resolved for each message
+	opts DecodeOptions
+}
+
+// Returns a new decoder that reads from r.
+func NewDecoder(r io.Reader) *Decoder {
+	d := &Decoder{br: bufio.NewReader(r)}
+	d.lr.R = d.br
+	d.r = NewReader(&d.lr)
+	return d
+}
+
+// Reads the next BARE message from the stream into val, which must be a
+// pointer to a value of the message type.
+//
+// If the stream ends cleanly between two messages, io.EOF is returned. If it
+// ends part way through a message, a DecodeError wrapping io.ErrUnexpectedEOF
+// is returned instead.
+// The size limit set by MaxUnmarshalBytes applies to each message separately.
+// The default limits are those in effect when each message is decoded. Use
+// DecodeOptions.NewDecoder to override them.
+func (d *Decoder) Decode(val interface{}) error {
+	if _, err := d.br.Peek(1); err != nil {
+		return err
+	}
+
+	d.r.opts = d.opts.withDefaults()
+	d.lr.N = d.r.opts.MaxUnmarshalBytes
+	err := UnmarshalBareReader(d.r, val)
+	if de, ok := err.(*DecodeError); ok && de.Err == io.EOF {
+		de.Err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// Reports whether there is another message to be read from the stream. A
+// false result means that the stream has ended or returned an error.
+func (d *Decoder) More() bool {
+	_, err := d.br.Peek(1)
+	return err == nil
+}
+
+// Returns a reader of the data remaining in the decoder's buffer. The reader
+// is valid until the next call to Decode.
+func (d *Decoder) Buffered() io.Reader {
+	buf, _ := d.br.Peek(d.br.Buffered())
+	return bytes.NewReader(buf)
+}
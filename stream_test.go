@@ -0,0 +1,90 @@
+package bare
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncoder(t *testing.T) {
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	for x := 0; x < 3; x++ {
+		age := Age(x)
+		err := enc.Encode(&age)
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, []byte{0x00, 0x02, 0x04}, buf.Bytes())
+}
+
+func TestDecoder(t *testing.T) {
+	dec := NewDecoder(bytes.NewReader([]byte{0x00, 0x02, 0x04}))
+	var age Age
+	for x := 0; x < 3; x++ {
+		assert.True(t, dec.More())
+		err := dec.Decode(&age)
+		assert.Nil(t, err)
+		assert.Equal(t, Age(x), age)
+	}
+	assert.False(t, dec.More())
+	err := dec.Decode(&age)
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestDecoderTruncated(t *testing.T) {
+	dec := NewDecoder(bytes.NewReader([]byte{0x42, 0xEF, 0xBE}))
+	var u8 uint8
+	err := dec.Decode(&u8)
+	assert.Nil(t, err)
+
+	var u32 uint32
+	assert.True(t, dec.More())
+	err = dec.Decode(&u32)
+	assert.True(t, errors.Is(err, io.ErrUnexpectedEOF))
+}
+
+func TestDecoderLimit(t *testing.T) {
+	MaxUnmarshalBytes(4)
+	defer MaxUnmarshalBytes(1024 * 1024 * 32)
+
+	payload := []byte{
+		0xEF, 0xBE, 0xAD, 0xDE,
+		0xEF, 0xBE, 0xAD, 0xDE,
+		0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08,
+	}
+	dec := NewDecoder(bytes.NewReader(payload))
+
+	// The limit applies to each message rather than to the whole stream
+	var u32 uint32
+	for x := 0; x < 2; x++ {
+		err := dec.Decode(&u32)
+		assert.Nil(t, err)
+		assert.Equal(t, uint32(0xDEADBEEF), u32)
+	}
+
+	var u64 uint64
+	err := dec.Decode(&u64)
+	assert.True(t, errors.Is(err, ErrLimitExceeded))
+
+	// Changes to the defaults apply to the next message
+	dec = NewDecoder(bytes.NewReader(payload[8:]))
+	MaxUnmarshalBytes(8)
+	err = dec.Decode(&u64)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0x0807060504030201), u64)
+}
+
+func TestDecoderBuffered(t *testing.T) {
+	dec := NewDecoder(bytes.NewReader([]byte{0x42, 0x13, 0x37}))
+	var u8 uint8
+	err := dec.Decode(&u8)
+	assert.Nil(t, err)
+
+	rest, err := ioutil.ReadAll(dec.Buffered())
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0x13, 0x37}, rest)
+}
@@ -2,7 +2,11 @@ package bare
 
 import (
 	"fmt"
+	"io"
 	"reflect"
+	"sort"
+	"sync"
+	"sync/atomic"
 )
 
 // Any type which is a union member must implement this interface. You must
@@ -14,27 +18,71 @@ type Union interface {
 
 type UnionTags struct {
 	iface reflect.Type
+
+	mu    sync.RWMutex
 	tags  map[reflect.Type]uint64
 	types map[uint64]reflect.Type
 }
 
 var unionInterface = reflect.TypeOf((*Union)(nil)).Elem()
-var unionRegistry map[reflect.Type]*UnionTags
 
-func init() {
-	unionRegistry = make(map[reflect.Type]*UnionTags)
+// A set of union types and their members. Each union interface may be
+// registered once per registry, so libraries which register conflicting tags
+// for the same interface can each use their own registry. Registries are safe
+// for concurrent use, and registrations take effect immediately, including in
+// codecs already used.
+type Registry struct {
+	// Serializes changes to unions
+	mu sync.Mutex
+	// The current map[reflect.Type]*UnionTags, which is replaced rather than
+	// modified so that it can be read without locking
+	unions atomic.Value
+}
+
+// The registry used by RegisterUnion, Marshal, Unmarshal, and by readers and
+// writers created without a registry.
+var DefaultRegistry = NewRegistry()
+
+// Returns a new registry without any unions.
+func NewRegistry() *Registry {
+	reg := &Registry{}
+	reg.unions.Store(map[reflect.Type]*UnionTags{})
+	return reg
 }
 
-// Registers a union type in this context. Pass the union interface and the
-// list of types associated with it, sorted ascending by their union tag.
+func registryOr(reg *Registry) *Registry {
+	if reg == nil {
+		return DefaultRegistry
+	}
+	return reg
+}
+
+// Registers a union type in the default registry. Pass the union interface
+// and the list of types associated with it, sorted ascending by their union
+// tag. See Registry.RegisterUnion.
 func RegisterUnion(iface interface{}) *UnionTags {
+	return DefaultRegistry.RegisterUnion(iface)
+}
+
+// Returns the union registered in the default registry for an interface type.
+func UnionFor(iface reflect.Type) (*UnionTags, bool) {
+	return DefaultRegistry.UnionFor(iface)
+}
+
+// Registers a union type in this registry. Pass a pointer to the union
+// interface, and add its members with UnionTags.Member.
+func (reg *Registry) RegisterUnion(iface interface{}) *UnionTags {
 	ity := reflect.TypeOf(iface).Elem()
-	if _, ok := unionRegistry[ity]; ok {
-		panic(fmt.Errorf("Type %s has already been registered", ity.Name()))
+	if !ity.Implements(unionInterface) {
+		panic(fmt.Errorf("Type %s does not implement bare.Union", ity.Name()))
 	}
 
-	if !ity.Implements(reflect.TypeOf((*Union)(nil)).Elem()) {
-		panic(fmt.Errorf("Type %s does not implement bare.Union", ity.Name()))
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	unions := reg.unions.Load().(map[reflect.Type]*UnionTags)
+	if _, ok := unions[ity]; ok {
+		panic(fmt.Errorf("Type %s has already been registered", ity.Name()))
 	}
 
 	utypes := &UnionTags{
@@ -42,16 +90,83 @@ func RegisterUnion(iface interface{}) *UnionTags {
 		tags:  make(map[reflect.Type]uint64),
 		types: make(map[uint64]reflect.Type),
 	}
-	unionRegistry[ity] = utypes
+	updated := make(map[reflect.Type]*UnionTags, len(unions)+1)
+	for t, ut := range unions {
+		updated[t] = ut
+	}
+	updated[ity] = utypes
+	reg.unions.Store(updated)
 	return utypes
 }
 
+// Removes the registration of a union type, given a pointer to the union
+// interface like RegisterUnion. Returns whether it was registered.
+func (reg *Registry) UnregisterUnion(iface interface{}) bool {
+	ity := reflect.TypeOf(iface).Elem()
+
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	unions := reg.unions.Load().(map[reflect.Type]*UnionTags)
+	if _, ok := unions[ity]; !ok {
+		return false
+	}
+	updated := make(map[reflect.Type]*UnionTags, len(unions))
+	for t, ut := range unions {
+		if t != ity {
+			updated[t] = ut
+		}
+	}
+	reg.unions.Store(updated)
+	return true
+}
+
+// Returns the union registered in this registry for an interface type.
+func (reg *Registry) UnionFor(iface reflect.Type) (*UnionTags, bool) {
+	ut, ok := reg.unions.Load().(map[reflect.Type]*UnionTags)[iface]
+	return ut, ok
+}
+
+// Marshals a value (val, which must be a pointer) into a BARE message, using
+// the unions of this registry. See Marshal for details.
+func (reg *Registry) Marshal(val interface{}) ([]byte, error) {
+	return EncodeOptions{Registry: reg}.Marshal(val)
+}
+
+// Returns a new BARE primitive writer wrapping the given io.Writer, which uses
+// the unions of this registry for the values marshaled to it.
+func (reg *Registry) NewWriter(base io.Writer) *Writer {
+	return EncodeOptions{Registry: reg}.NewWriter(base)
+}
+
+// Returns a new encoder that writes to w, using the unions of this registry.
+func (reg *Registry) NewEncoder(w io.Writer) *Encoder {
+	return EncodeOptions{Registry: reg}.NewEncoder(w)
+}
+
+// Unmarshals a BARE message into val, using the unions of this registry. See
+// Unmarshal for details, and DecodeOptions.Registry to also set limits.
+func (reg *Registry) Unmarshal(data []byte, val interface{}) error {
+	return DecodeOptions{Registry: reg}.Unmarshal(data, val)
+}
+
+// Unmarshals a BARE message into val from a reader, using the unions of this
+// registry. See UnmarshalReader for details.
+func (reg *Registry) UnmarshalReader(r io.Reader, val interface{}) error {
+	return DecodeOptions{Registry: reg}.UnmarshalReader(r, val)
+}
+
+// Adds a member to the union with the given tag. t is a value of the member
+// type, which must implement the union interface.
 func (ut *UnionTags) Member(t interface{}, tag uint64) *UnionTags {
 	ty := reflect.TypeOf(t)
 	if !ty.AssignableTo(ut.iface) {
 		panic(fmt.Errorf("Type %s does not implement interface %s",
 			ty.Name(), ut.iface.Name()))
 	}
+
+	ut.mu.Lock()
+	defer ut.mu.Unlock()
 	if _, ok := ut.tags[ty]; ok {
 		panic(fmt.Errorf("Type %s is already registered for union %s",
 			ty.Name(), ut.iface.Name()))
@@ -66,11 +181,31 @@ func (ut *UnionTags) Member(t interface{}, tag uint64) *UnionTags {
 }
 
 func (ut *UnionTags) TagFor(v interface{}) (uint64, bool) {
-	tag, ok := ut.tags[reflect.TypeOf(v)]
-	return tag, ok
+	return ut.tagOf(reflect.TypeOf(v))
 }
 
 func (ut *UnionTags) TypeFor(tag uint64) (reflect.Type, bool) {
+	ut.mu.RLock()
+	defer ut.mu.RUnlock()
 	t, ok := ut.types[tag]
 	return t, ok
 }
+
+func (ut *UnionTags) tagOf(t reflect.Type) (uint64, bool) {
+	ut.mu.RLock()
+	defer ut.mu.RUnlock()
+	tag, ok := ut.tags[t]
+	return tag, ok
+}
+
+// Returns the tags of the members of the union in ascending order.
+func (ut *UnionTags) Tags() []uint64 {
+	ut.mu.RLock()
+	defer ut.mu.RUnlock()
+	tags := make([]uint64, 0, len(ut.types))
+	for tag := range ut.types {
+		tags = append(tags, tag)
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i] < tags[j] })
+	return tags
+}
@@ -0,0 +1,155 @@
+package bare
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type Shape interface{ Union }
+
+type Circle struct{ Radius uint8 }
+type Square struct{ Side uint8 }
+
+func (Circle) IsUnion() {}
+func (Square) IsUnion() {}
+
+func unionType(iface interface{}) reflect.Type {
+	return reflect.TypeOf(iface).Elem()
+}
+
+func TestRegistryScoped(t *testing.T) {
+	a := NewRegistry()
+	a.RegisterUnion((*Shape)(nil)).
+		Member(*new(Circle), 0).
+		Member(*new(Square), 1)
+	b := NewRegistry()
+	b.RegisterUnion((*Shape)(nil)).
+		Member(*new(Square), 0).
+		Member(*new(Circle), 1)
+
+	var val Shape = Circle{Radius: 5}
+	data, err := a.Marshal(&val)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x00, 0x05}, data)
+	data, err = b.Marshal(&val)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x01, 0x05}, data)
+
+	var decoded Shape
+	assert.NoError(t, b.Unmarshal([]byte{0x00, 0x07}, &decoded))
+	assert.Equal(t, &Square{Side: 7}, decoded)
+	assert.NoError(t, DecodeOptions{Registry: a}.Unmarshal([]byte{0x00, 0x07}, &decoded))
+	assert.Equal(t, &Circle{Radius: 7}, decoded)
+
+	// Shape is not registered in the default registry
+	_, err = Marshal(&val)
+	assert.EqualError(t, errors.Unwrap(err), "Union type Shape is not registered")
+	err = Unmarshal([]byte{0x00, 0x07}, &decoded)
+	assert.EqualError(t, errors.Unwrap(err), "Union type Shape is not registered")
+}
+
+func TestRegistryWriter(t *testing.T) {
+	reg := NewRegistry()
+	reg.RegisterUnion((*Shape)(nil)).Member(*new(Square), 3)
+
+	var buf bytes.Buffer
+	var val Shape = Square{Side: 2}
+	assert.NoError(t, MarshalWriter(reg.NewWriter(&buf), &val))
+	assert.NoError(t, reg.NewEncoder(&buf).Encode(&val))
+	assert.Equal(t, []byte{0x03, 0x02, 0x03, 0x02}, buf.Bytes())
+
+	dec := DecodeOptions{Registry: reg}.NewDecoder(&buf)
+	for i := 0; i < 2; i++ {
+		var decoded Shape
+		assert.NoError(t, dec.Decode(&decoded))
+		assert.Equal(t, &Square{Side: 2}, decoded)
+	}
+}
+
+func TestRegistryUnregister(t *testing.T) {
+	reg := NewRegistry()
+	reg.RegisterUnion((*Shape)(nil)).Member(*new(Circle), 0)
+	assert.Panics(t, func() { reg.RegisterUnion((*Shape)(nil)) })
+
+	var val Shape = Circle{Radius: 1}
+	_, err := reg.Marshal(&val)
+	assert.NoError(t, err)
+
+	assert.True(t, reg.UnregisterUnion((*Shape)(nil)))
+	assert.False(t, reg.UnregisterUnion((*Shape)(nil)))
+	_, ok := reg.UnionFor(unionType((*Shape)(nil)))
+	assert.False(t, ok)
+	_, err = reg.Marshal(&val)
+	assert.Error(t, err)
+
+	// The union can be registered again with other tags
+	reg.RegisterUnion((*Shape)(nil)).Member(*new(Circle), 9)
+	data, err := reg.Marshal(&val)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x09, 0x01}, data)
+}
+
+func TestRegistryConcurrent(t *testing.T) {
+	reg := NewRegistry()
+	ut := reg.RegisterUnion((*Shape)(nil))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if i == 0 {
+				ut.Member(*new(Circle), 0)
+			}
+			var val Shape = Circle{Radius: uint8(i)}
+			for j := 0; j < 100; j++ {
+				if data, err := reg.Marshal(&val); err == nil {
+					assert.Equal(t, []byte{0x00, uint8(i)}, data)
+				}
+				reg.UnionFor(unionType((*Shape)(nil)))
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// Unrelated registrations while the union is in use
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			other := NewRegistry()
+			other.RegisterUnion((*Shape)(nil)).Member(*new(Square), uint64(i))
+			var val Shape = Square{}
+			data, err := other.Marshal(&val)
+			assert.NoError(t, err)
+			assert.Equal(t, []byte{uint8(i), 0x00}, data, fmt.Sprint(i))
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestRegistryMemberAddedAfterUse(t *testing.T) {
+	reg := NewRegistry()
+	ut := reg.RegisterUnion((*Shape)(nil)).Member(*new(Circle), 0)
+
+	type drawing struct{ Shapes []Shape }
+	val := drawing{Shapes: []Shape{Square{Side: 4}}}
+	_, err := reg.Marshal(&val)
+	assert.EqualError(t, errors.Unwrap(err), "Invalid union value: bare.Square")
+	var decoded drawing
+	err = reg.Unmarshal([]byte{0x01, 0x01, 0x04}, &decoded)
+	assert.EqualError(t, errors.Unwrap(err), "Invalid union tag 1 for type Shape")
+
+	ut.Member(*new(Square), 1)
+	data, err := reg.Marshal(&val)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x01, 0x01, 0x04}, data)
+	assert.NoError(t, reg.Unmarshal(data, &decoded))
+	assert.Equal(t, []Shape{&Square{Side: 4}}, decoded.Shapes)
+}
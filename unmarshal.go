@@ -1,7 +1,6 @@
 package bare
 
 import (
-	"bytes"
 	"errors"
 	"fmt"
 	"io"
@@ -17,23 +16,47 @@ type Unmarshalable interface {
 
 // Unmarshals a BARE message into val, which must be a pointer to a value of
 // the message type.
+//
+// The limits applied to the message are the package defaults; use
+// DecodeOptions to override them. Any data after the message is ignored,
+// unless DecodeOptions.DisallowTrailingData is set; use UnmarshalPrefix to
+// find where the message ends.
 func Unmarshal(data []byte, val interface{}) error {
-	b := bytes.NewReader(data)
-	r := NewReader(b)
-	return UnmarshalBareReader(r, val)
+	return DecodeOptions{}.Unmarshal(data, val)
+}
+
+// Unmarshals the BARE message at the start of data into val, which must be a
+// pointer to a value of the message type, and returns the length of the
+// message in bytes. Unlike Unmarshal, the message may be followed by more
+// data, such as the next message of a sequence starting at data[n:]. If the
+// message cannot be decoded, n is the offset of the error.
+func UnmarshalPrefix(data []byte, val interface{}) (n int, err error) {
+	return DecodeOptions{}.UnmarshalPrefix(data, val)
+}
+
+// Unmarshals a BARE message into val like Unmarshal, except that the data
+// values ([]byte) decoded refer to data rather than a copy of it, as if
+// DecodeOptions.NoCopy was set. data must not be modified while they are in
+// use.
+func UnmarshalNoCopy(data []byte, val interface{}) error {
+	return DecodeOptions{NoCopy: true}.Unmarshal(data, val)
 }
 
 // Unmarshals a BARE message into value (val, which must be a pointer), from a
 // reader. See Unmarshal for details.
 func UnmarshalReader(r io.Reader, val interface{}) error {
-	r = newLimitedReader(r)
-	return UnmarshalBareReader(NewReader(r), val)
+	return DecodeOptions{}.UnmarshalReader(r, val)
 }
 
-type decodeFunc func(r *Reader, v reflect.Value) error
+// Decodes a value of a given type, such as a codec given to RegisterCodec, into
+// v, which is settable.
+type DecodeFunc func(r *Reader, v reflect.Value) error
 
-var decodeFuncCache sync.Map // map[reflect.Type]decodeFunc
+var decodeFuncCache sync.Map // map[reflect.Type]DecodeFunc
 
+// Unmarshals a BARE message into value (val, which must be a pointer), from a
+// BARE primitive reader, applying the options the reader was created with.
+// See Unmarshal for details.
 func UnmarshalBareReader(r *Reader, val interface{}) error {
 	t := reflect.TypeOf(val)
 	v := reflect.ValueOf(val)
@@ -41,23 +64,64 @@ func UnmarshalBareReader(r *Reader, val interface{}) error {
 		return errors.New("Expected val to be pointer type")
 	}
 
-	return getDecoder(t.Elem())(r, v.Elem())
+	if r.depth != 0 {
+		// Nested in a custom Unmarshalable; errors are attributed to the
+		// enclosing value by our caller
+		return getDecoder(t.Elem())(r, v.Elem())
+	}
+
+	r.BeginMessage()
+	offset := r.Offset()
+	if err := getDecoder(t.Elem())(r, v.Elem()); err != nil {
+		return wrapDecodeError(err, rootSegment(t.Elem()), t.Elem(), offset)
+	}
+	return nil
 }
 
 // get decoder from cache
-func getDecoder(t reflect.Type) decodeFunc {
+func getDecoder(t reflect.Type) DecodeFunc {
 	if f, ok := decodeFuncCache.Load(t); ok {
-		return f.(decodeFunc)
+		return f.(DecodeFunc)
 	}
 
-	f := decoderFunc(t)
+	// See getEncoder
+	var (
+		wg sync.WaitGroup
+		f  DecodeFunc
+	)
+	wg.Add(1)
+	fi, loaded := decodeFuncCache.LoadOrStore(t,
+		DecodeFunc(func(r *Reader, v reflect.Value) error {
+			wg.Wait()
+			return f(r, v)
+		}))
+	if loaded {
+		return fi.(DecodeFunc)
+	}
+
+	defer func() {
+		if f == nil {
+			f = func(r *Reader, v reflect.Value) error {
+				return fmt.Errorf("Decoder for type %s could not be built", t)
+			}
+			decodeFuncCache.Delete(t)
+		}
+		wg.Done()
+	}()
+	if f = decoderFunc(t); f == nil {
+		panic(fmt.Errorf("No decoder for type %s", t))
+	}
 	decodeFuncCache.Store(t, f)
 	return f
 }
 
 var unmarshalableInterface = reflect.TypeOf((*Unmarshalable)(nil)).Elem()
 
-func decoderFunc(t reflect.Type) decodeFunc {
+func decoderFunc(t reflect.Type) DecodeFunc {
+	if c, ok := CodecFor(t); ok {
+		return c.decode
+	}
+
 	if reflect.PtrTo(t).Implements(unmarshalableInterface) {
 		return func(r *Reader, v reflect.Value) error {
 			uv := v.Addr().Interface().(Unmarshalable)
@@ -75,12 +139,21 @@ func decoderFunc(t reflect.Type) decodeFunc {
 	case reflect.Struct:
 		return decodeStruct(t)
 	case reflect.Array:
+		if isData(t) {
+			return decodeDataArray
+		}
 		return decodeArray(t)
 	case reflect.Slice:
+		if isData(t) {
+			return decodeData
+		}
 		return decodeSlice(t)
 	case reflect.Map:
 		return decodeMap(t)
 	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if t.Implements(enumInterface) {
+			return decodeEnum
+		}
 		return decodeUint
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
 		return decodeInt
@@ -97,92 +170,130 @@ func decoderFunc(t reflect.Type) decodeFunc {
 	}
 }
 
-func decodeOptional(t reflect.Type) decodeFunc {
+func decodeOptional(t reflect.Type) DecodeFunc {
 	return func(r *Reader, v reflect.Value) error {
-		s, err := r.ReadU8()
-		if err != nil {
+		if err := r.Enter(); err != nil {
 			return err
 		}
+		defer r.Leave()
 
-		if s > 1 {
-			return fmt.Errorf("Invalid optional value: %#x", s)
+		ok, err := r.ReadOptional()
+		if err != nil {
+			return err
 		}
 
-		if s == 0 {
+		if !ok {
 			return nil
 		}
 
 		v.Set(reflect.New(t))
-		return getDecoder(t)(r, v.Elem())
+		offset := r.Offset()
+		if err := getDecoder(t)(r, v.Elem()); err != nil {
+			return wrapDecodeError(err, "", t, offset)
+		}
+		return nil
 	}
 }
 
-func decodeStruct(t reflect.Type) decodeFunc {
+func decodeStruct(t reflect.Type) DecodeFunc {
 	n := t.NumField()
-	decoders := make([]decodeFunc, n)
+	decoders := make([]DecodeFunc, n)
+	segments := make([]string, n)
 	for i := 0; i < n; i++ {
 		field := t.Field(i)
 		if field.Tag.Get("bare") == "-" {
 			continue
 		}
 		decoders[i] = getDecoder(field.Type)
+		segments[i] = fieldSegment(field)
 	}
 
 	return func(r *Reader, v reflect.Value) error {
+		if err := r.Enter(); err != nil {
+			return err
+		}
+		defer r.Leave()
+
 		for i := 0; i < n; i++ {
 			if decoders[i] == nil {
 				continue
 			}
+			offset := r.Offset()
 			err := decoders[i](r, v.Field(i))
 			if err != nil {
-				return err
+				return wrapDecodeError(err, segments[i],
+					t.Field(i).Type, offset)
 			}
 		}
 		return nil
 	}
 }
 
-func decodeArray(t reflect.Type) decodeFunc {
-	f := getDecoder(t.Elem())
+func decodeArray(t reflect.Type) DecodeFunc {
+	elem := t.Elem()
+	f := getDecoder(elem)
 	len := t.Len()
 
 	return func(r *Reader, v reflect.Value) error {
+		if err := r.Enter(); err != nil {
+			return err
+		}
+		defer r.Leave()
+
 		for i := 0; i < len; i++ {
+			offset := r.Offset()
 			err := f(r, v.Index(i))
 			if err != nil {
-				return err
+				return wrapDecodeError(err, indexSegment(i), elem, offset)
 			}
 		}
 		return nil
 	}
 }
 
-func decodeSlice(t reflect.Type) decodeFunc {
+func decodeSlice(t reflect.Type) DecodeFunc {
 	elem := t.Elem()
 	f := getDecoder(elem)
 
 	return func(r *Reader, v reflect.Value) error {
-		len, err := r.ReadUint()
-		if err != nil {
+		if err := r.Enter(); err != nil {
 			return err
 		}
+		defer r.Leave()
 
-		if len > maxArrayLength {
-			return fmt.Errorf("Array length %d exceeds configured limit of %d", len, maxArrayLength)
+		len, err := r.ReadArrayLength()
+		if err != nil {
+			return err
 		}
 
 		v.Set(reflect.MakeSlice(t, int(len), int(len)))
 
 		for i := 0; i < int(len); i++ {
+			offset := r.Offset()
 			if err := f(r, v.Index(i)); err != nil {
-				return err
+				return wrapDecodeError(err, indexSegment(i), elem, offset)
 			}
 		}
 		return nil
 	}
 }
 
-func decodeMap(t reflect.Type) decodeFunc {
+// Decodes a byte slice all at once with ReadData.
+func decodeData(r *Reader, v reflect.Value) error {
+	data, err := r.ReadData()
+	if err != nil {
+		return err
+	}
+	v.SetBytes(data)
+	return nil
+}
+
+// Decodes an array of bytes all at once.
+func decodeDataArray(r *Reader, v reflect.Value) error {
+	return r.ReadDataFixed(v.Slice(0, v.Len()).Bytes())
+}
+
+func decodeMap(t reflect.Type) DecodeFunc {
 	keyType := t.Key()
 	keyf := getDecoder(keyType)
 
@@ -190,13 +301,14 @@ func decodeMap(t reflect.Type) decodeFunc {
 	valf := getDecoder(valueType)
 
 	return func(r *Reader, v reflect.Value) error {
-		size, err := r.ReadUint()
-		if err != nil {
+		if err := r.Enter(); err != nil {
 			return err
 		}
+		defer r.Leave()
 
-		if size > maxMapSize {
-			return fmt.Errorf("Map size %d exceeds configured limit of %d", size, maxMapSize)
+		size, err := r.ReadMapSize()
+		if err != nil {
+			return err
 		}
 
 		v.Set(reflect.MakeMapWithSize(t, int(size)))
@@ -205,16 +317,20 @@ func decodeMap(t reflect.Type) decodeFunc {
 		value := reflect.New(valueType).Elem()
 
 		for i := uint64(0); i < size; i++ {
+			offset := r.Offset()
 			if err := keyf(r, key); err != nil {
-				return err
+				return wrapDecodeError(err, fmt.Sprintf("[#%d]", i),
+					keyType, offset)
 			}
 
 			if v.MapIndex(key).Kind() > reflect.Invalid {
 				return fmt.Errorf("Encountered duplicate map key: %v", key.Interface())
 			}
 
+			offset = r.Offset()
 			if err := valf(r, value); err != nil {
-				return err
+				return wrapDecodeError(err, keySegment(key),
+					valueType, offset)
 			}
 
 			v.SetMapIndex(key, value)
@@ -223,41 +339,37 @@ func decodeMap(t reflect.Type) decodeFunc {
 	}
 }
 
-func decodeUnion(t reflect.Type) decodeFunc {
-	ut, ok := unionRegistry[t]
-	if !ok {
-		return func(r *Reader, v reflect.Value) error {
+// Union members are looked up in the registry of the reader on each call, so
+// that unions registered after the decoder was built are decoded too.
+func decodeUnion(t reflect.Type) DecodeFunc {
+	return func(r *Reader, v reflect.Value) error {
+		ut, ok := registryOr(r.opts.Registry).UnionFor(t)
+		if !ok {
 			return fmt.Errorf("Union type %s is not registered", t.Name())
 		}
-	}
-
-	decoders := make(map[uint64]decodeFunc)
-	for tag, t := range ut.types {
-		t := t
-		f := getDecoder(t)
-
-		decoders[tag] = func(r *Reader, v reflect.Value) error {
-			nv := reflect.New(t)
-			if err := f(r, nv.Elem()); err != nil {
-				return err
-			}
 
-			v.Set(nv)
-			return nil
+		if err := r.Enter(); err != nil {
+			return err
 		}
-	}
+		defer r.Leave()
 
-	return func(r *Reader, v reflect.Value) error {
 		tag, err := r.ReadUint()
 		if err != nil {
 			return err
 		}
 
-		if f, ok := decoders[tag]; ok {
-			return f(r, v)
+		mt, ok := ut.TypeFor(tag)
+		if !ok {
+			return fmt.Errorf("Invalid union tag %d for type %s", tag, t.Name())
 		}
 
-		return fmt.Errorf("Invalid union tag %d for type %s", tag, t.Name())
+		nv := reflect.New(mt)
+		offset := r.Offset()
+		if err := getDecoder(mt)(r, nv.Elem()); err != nil {
+			return wrapDecodeError(err, unionSegment(mt), mt, offset)
+		}
+		v.Set(nv)
+		return nil
 	}
 }
 
@@ -295,6 +407,13 @@ func decodeUint(r *Reader, v reflect.Value) error {
 	return err
 }
 
+func decodeEnum(r *Reader, v reflect.Value) error {
+	if err := decodeUint(r, v); err != nil {
+		return err
+	}
+	return r.CheckEnum(v.Interface().(Enum))
+}
+
 func decodeInt(r *Reader, v reflect.Value) error {
 	var err error
 	switch getIntKind(v.Type()) {
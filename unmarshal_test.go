@@ -1,6 +1,9 @@
 package bare
 
 import (
+	"bytes"
+	"errors"
+	"io"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -112,7 +115,7 @@ func TestUnmarshalValue(t *testing.T) {
 	assert.True(t, b, "Expected Unmarshal to read true")
 
 	err = Unmarshal(payloads[12][2:], &b)
-	assert.EqualError(t, err, "Invalid bool value: 0x2")
+	assert.EqualError(t, errors.Unwrap(err), "Invalid bool value: 0x2")
 
 	err = Unmarshal(payloads[13], &str)
 	assert.Nil(t, err, "Expected Unmarshal to return without error")
@@ -131,7 +134,7 @@ func TestUnmarshalOptional(t *testing.T) {
 	assert.Equal(t, uint32(0xDEADBEEF), *val, "Expected Unmarshal to read 0xDEADBEEF")
 
 	err = Unmarshal([]byte{0x02}, &val)
-	assert.EqualError(t, err, "Invalid optional value: 0x2")
+	assert.EqualError(t, errors.Unwrap(err), "Invalid optional value: 0x2")
 }
 
 func TestUnmarshalStruct(t *testing.T) {
@@ -182,7 +185,7 @@ func TestUnmarshalSlice(t *testing.T) {
 
 	MaxArrayLength(64)
 	err = Unmarshal([]byte{100}, &val)
-	assert.EqualError(t, err, "Array length 100 exceeds configured limit of 64")
+	assert.EqualError(t, errors.Unwrap(err), "Array length 100 exceeds configured limit of 64")
 }
 
 func TestUnmarshalMap(t *testing.T) {
@@ -207,14 +210,14 @@ func TestUnmarshalMap(t *testing.T) {
 			0x01, 0x37,
 		}
 		err = Unmarshal(payload, &val)
-		assert.EqualError(t, err, "Encountered duplicate map key: 1")
+		assert.EqualError(t, errors.Unwrap(err), "Encountered duplicate map key: 1")
 	})
 
 	t.Run("respects size limits", func(t *testing.T) {
 		MaxMapSize(64)
 		payload = []byte{100}
 		err = Unmarshal(payload, &val)
-		assert.EqualError(t, err, "Map size 100 exceeds configured limit of 64")
+		assert.EqualError(t, errors.Unwrap(err), "Map size 100 exceeds configured limit of 64")
 	})
 }
 
@@ -238,7 +241,7 @@ func TestUnmarshalUnion(t *testing.T) {
 
 	payload = []byte{0x13, 0x37}
 	err = Unmarshal(payload, &val)
-	assert.EqualError(t, err, "Invalid union tag 19 for type NameAge")
+	assert.EqualError(t, errors.Unwrap(err), "Invalid union tag 19 for type NameAge")
 }
 
 func TestUnmarshalCustom(t *testing.T) {
@@ -249,3 +252,119 @@ func TestUnmarshalCustom(t *testing.T) {
 	assert.Nil(t, err, "Expected Unmarshal to return without error")
 	assert.Equal(t, Custom(0x42), val)
 }
+
+func TestUnmarshalRecursive(t *testing.T) {
+	payload := []byte{
+		0x01, 0x02,
+		0x02, 0x00, 0x00,
+		0x03, 0x00, 0x01,
+		0x04, 0x00, 0x00,
+		0x00,
+	}
+	var val Node
+	err := Unmarshal(payload, &val)
+	assert.Nil(t, err, "Expected Unmarshal to return without error")
+	assert.Equal(t, Node{
+		Value: 1,
+		Children: []Node{
+			{Value: 2, Children: []Node{}},
+			{Value: 3, Children: []Node{}, Next: &Node{
+				Value: 4, Children: []Node{},
+			}},
+		},
+	}, val)
+
+	t.Run("respects depth limits", func(t *testing.T) {
+		// A linked list nested far deeper than the default limit
+		var payload []byte
+		for i := 0; i < 100000; i++ {
+			payload = append(payload, 0x00, 0x00, 0x01)
+		}
+		err = Unmarshal(payload, &val)
+		assert.EqualError(t, errors.Unwrap(err),
+			"Nesting depth exceeds configured limit of 1024")
+	})
+}
+
+func TestUnmarshalTrailingData(t *testing.T) {
+	payload := []byte{0x02, 0x68, 0x69, 0xff, 0xfe}
+
+	var s string
+	assert.NoError(t, Unmarshal(payload, &s))
+	assert.Equal(t, "hi", s)
+
+	strict := DecodeOptions{DisallowTrailingData: true}
+	err := strict.Unmarshal(payload, &s)
+	assert.True(t, errors.Is(err, ErrTrailingData))
+	assert.Equal(t, &TrailingDataError{Offset: 3, Bytes: 2}, err)
+	assert.EqualError(t, err, "2 bytes of trailing data after message at offset 3")
+	assert.NoError(t, strict.Unmarshal(payload[:3], &s))
+
+	err = strict.UnmarshalReader(bytes.NewReader(payload), &s)
+	assert.Equal(t, &TrailingDataError{Offset: 3, Bytes: 2}, err)
+	assert.NoError(t, strict.UnmarshalReader(bytes.NewReader(payload[:3]), &s))
+}
+
+func TestUnmarshalPrefix(t *testing.T) {
+	payload := []byte{0x02, 0x68, 0x69, 0x01, 0x21, 0x05}
+
+	var messages []string
+	for len(payload) > 0 {
+		var s string
+		n, err := UnmarshalPrefix(payload, &s)
+		if err != nil {
+			assert.Equal(t, 1, n)
+			assert.True(t, errors.Is(err, io.EOF))
+			break
+		}
+		messages = append(messages, s)
+		payload = payload[n:]
+	}
+	assert.Equal(t, []string{"hi", "!"}, messages)
+
+	// Trailing data is expected even in strict mode
+	var u uint8
+	n, err := DecodeOptions{DisallowTrailingData: true}.UnmarshalPrefix([]byte{1, 2}, &u)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+}
+
+func TestUnmarshalNoCopy(t *testing.T) {
+	type Blob struct {
+		Name string
+		Data []byte
+	}
+	payload := []byte{0x02, 0x68, 0x69, 0x03, 0x13, 0x37, 0x42}
+
+	var blob Blob
+	err := Unmarshal(payload, &blob)
+	assert.Nil(t, err)
+	assert.Equal(t, Blob{"hi", []byte{0x13, 0x37, 0x42}}, blob)
+	assert.False(t, &blob.Data[0] == &payload[4])
+
+	err = UnmarshalNoCopy(payload, &blob)
+	assert.Nil(t, err)
+	assert.Equal(t, Blob{"hi", []byte{0x13, 0x37, 0x42}}, blob)
+	assert.True(t, &blob.Data[0] == &payload[4])
+	// Appending to the data does not overwrite the rest of the input
+	assert.Equal(t, 3, cap(blob.Data))
+
+	payload[1] = 'H'
+	assert.Equal(t, "hi", blob.Name)
+
+	opts := DecodeOptions{UnsafeStrings: true}
+	err = opts.Unmarshal(payload, &blob)
+	assert.Nil(t, err)
+	assert.False(t, &blob.Data[0] == &payload[4])
+	assert.Equal(t, "Hi", blob.Name)
+	payload[1] = 'h'
+	assert.Equal(t, "hi", blob.Name)
+
+	// Named byte types
+	type octet uint8
+	type octets []octet
+	var o octets
+	err = UnmarshalNoCopy([]byte{0x02, 0x01, 0x02}, &o)
+	assert.Nil(t, err)
+	assert.Equal(t, octets{1, 2}, o)
+}
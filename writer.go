@@ -5,12 +5,31 @@ import (
 	"fmt"
 	"io"
 	"math"
+	"unicode/utf8"
 )
 
 // A Writer for BARE primitive types.
+//
+// Writers may be reused, e.g. from a sync.Pool, by calling Reset.
 type Writer struct {
 	base    io.Writer
 	scratch [binary.MaxVarintLen64]byte
+	opts    EncodeOptions
+	// The output of writers created with NewBytesWriter, which have no base,
+	// and whether it is limited to its initial capacity. For buffered
+	// writers, the data not yet written to base.
+	buf      []byte
+	fixedCap bool
+	buffered bool
+	// Set for writers which only count the bytes written, for EncodedSize
+	discard bool
+
+	// Number of bytes written so far, and the number at which the message
+	// being marshaled exceeds MaxMarshalBytes, if it is limited
+	written int64
+	limit   int64
+	// Nesting depth of the value being marshaled. See Enter.
+	depth uint64
 }
 
 // Returns a new BARE primitive writer wrapping the given io.Writer.
@@ -18,84 +37,213 @@ func NewWriter(base io.Writer) *Writer {
 	return &Writer{base: base}
 }
 
+// Returns a new BARE primitive writer wrapping the given io.Writer, which
+// collects up to size bytes before writing them to it at once. Call Flush
+// once done writing.
+func NewBufferedWriter(base io.Writer, size int) *Writer {
+	return &Writer{
+		base:     base,
+		buf:      make([]byte, 0, size),
+		buffered: true,
+	}
+}
+
+// Returns a new BARE primitive writer which appends to a byte slice, growing
+// it as needed. Use Bytes to get the result.
+func NewBytesWriter(buf []byte) *Writer {
+	return &Writer{buf: buf}
+}
+
+// Returns the contents of the byte slice of a writer created with
+// NewBytesWriter, including the data written so far.
+func (w *Writer) Bytes() []byte {
+	return w.buf
+}
+
+// Returns the number of bytes written so far, including those buffered.
+func (w *Writer) Offset() int64 {
+	return w.written
+}
+
+// Returns the number of bytes buffered by a writer created with
+// NewBufferedWriter, which have not been written to the underlying writer yet.
+func (w *Writer) Buffered() int {
+	if !w.buffered || w.base == nil {
+		return 0
+	}
+	return len(w.buf)
+}
+
+// Writes any buffered data to the underlying writer. It does nothing for
+// writers without a buffer.
+func (w *Writer) Flush() error {
+	if w.Buffered() == 0 {
+		return nil
+	}
+	err := w.writeBase(w.buf)
+	w.buf = w.buf[:0]
+	return err
+}
+
+// Makes the writer write to base, from offset zero, keeping its options and
+// its buffer, if any. Data buffered and not flushed is discarded. If base is
+// nil, the writer appends to its byte slice from the start, like a writer
+// created with NewBytesWriter.
+func (w *Writer) Reset(base io.Writer) {
+	w.base = base
+	w.buf = w.buf[:0]
+	w.fixedCap = false
+	w.written = 0
+	w.limit = 0
+	w.depth = 0
+}
+
+func (w *Writer) writeBase(p []byte) error {
+	for amt := 0; amt < len(p); {
+		n, err := w.base.Write(p[amt:])
+		if err != nil {
+			return err
+		}
+		amt += n
+	}
+	return nil
+}
+
+func (w *Writer) write(p []byte) error {
+	if w.limit != 0 && w.written+int64(len(p)) > w.limit {
+		return ErrLimitExceeded
+	}
+	switch {
+	case w.discard:
+	case w.base == nil:
+		if w.fixedCap && len(w.buf)+len(p) > cap(w.buf) {
+			return io.ErrShortBuffer
+		}
+		w.buf = append(w.buf, p...)
+	case w.buffered:
+		if len(w.buf)+len(p) > cap(w.buf) {
+			if err := w.Flush(); err != nil {
+				return err
+			}
+		}
+		if len(p) > cap(w.buf) {
+			// Too large to be worth buffering
+			if err := w.writeBase(p); err != nil {
+				return err
+			}
+		} else {
+			w.buf = append(w.buf, p...)
+		}
+	default:
+		if err := w.writeBase(p); err != nil {
+			return err
+		}
+	}
+	w.written += int64(len(p))
+	return nil
+}
+
+// Writes a string like write, saving the conversion to []byte where possible.
+func (w *Writer) writeString(str string) error {
+	if w.limit != 0 && w.written+int64(len(str)) > w.limit {
+		return ErrLimitExceeded
+	}
+	switch {
+	case w.discard:
+	case w.base == nil:
+		if w.fixedCap && len(w.buf)+len(str) > cap(w.buf) {
+			return io.ErrShortBuffer
+		}
+		w.buf = append(w.buf, str...)
+	case w.buffered && len(w.buf)+len(str) <= cap(w.buf):
+		w.buf = append(w.buf, str...)
+	default:
+		return w.write([]byte(str))
+	}
+	w.written += int64(len(str))
+	return nil
+}
+
 func (w *Writer) WriteUint(i uint64) error {
 	n := binary.PutUvarint(w.scratch[:], i)
-	_, err := w.base.Write(w.scratch[:n])
-	return err
+	return w.write(w.scratch[:n])
 }
 
 func (w *Writer) WriteU8(i uint8) error {
-	return binary.Write(w.base, binary.LittleEndian, i)
+	w.scratch[0] = i
+	return w.write(w.scratch[:1])
 }
 
 func (w *Writer) WriteU16(i uint16) error {
-	return binary.Write(w.base, binary.LittleEndian, i)
+	binary.LittleEndian.PutUint16(w.scratch[:], i)
+	return w.write(w.scratch[:2])
 }
 
 func (w *Writer) WriteU32(i uint32) error {
-	return binary.Write(w.base, binary.LittleEndian, i)
+	binary.LittleEndian.PutUint32(w.scratch[:], i)
+	return w.write(w.scratch[:4])
 }
 
 func (w *Writer) WriteU64(i uint64) error {
-	return binary.Write(w.base, binary.LittleEndian, i)
+	binary.LittleEndian.PutUint64(w.scratch[:], i)
+	return w.write(w.scratch[:8])
 }
 
 func (w *Writer) WriteInt(i int64) error {
-	var buf [binary.MaxVarintLen64]byte
-	n := binary.PutVarint(buf[:], i)
-	_, err := w.base.Write(buf[:n])
-	return err
+	n := binary.PutVarint(w.scratch[:], i)
+	return w.write(w.scratch[:n])
 }
 
 func (w *Writer) WriteI8(i int8) error {
-	return binary.Write(w.base, binary.LittleEndian, i)
+	return w.WriteU8(uint8(i))
 }
 
 func (w *Writer) WriteI16(i int16) error {
-	return binary.Write(w.base, binary.LittleEndian, i)
+	return w.WriteU16(uint16(i))
 }
 
 func (w *Writer) WriteI32(i int32) error {
-	return binary.Write(w.base, binary.LittleEndian, i)
+	return w.WriteU32(uint32(i))
 }
 
 func (w *Writer) WriteI64(i int64) error {
-	return binary.Write(w.base, binary.LittleEndian, i)
+	return w.WriteU64(uint64(i))
 }
 
 func (w *Writer) WriteF32(f float32) error {
 	if math.IsNaN(float64(f)) {
 		return fmt.Errorf("NaN is not permitted in BARE floats")
 	}
-	return binary.Write(w.base, binary.LittleEndian, f)
+	return w.WriteU32(math.Float32bits(f))
 }
 
 func (w *Writer) WriteF64(f float64) error {
 	if math.IsNaN(f) {
 		return fmt.Errorf("NaN is not permitted in BARE floats")
 	}
-	return binary.Write(w.base, binary.LittleEndian, f)
+	return w.WriteU64(math.Float64bits(f))
 }
 
 func (w *Writer) WriteBool(b bool) error {
-	return binary.Write(w.base, binary.LittleEndian, b)
+	if b {
+		return w.WriteU8(1)
+	}
+	return w.WriteU8(0)
 }
 
 func (w *Writer) WriteString(str string) error {
-	return w.WriteData([]byte(str))
+	if w.opts.Strict && !utf8.ValidString(str) {
+		return ErrInvalidStr
+	}
+	if err := w.WriteUint(uint64(len(str))); err != nil {
+		return err
+	}
+	return w.writeString(str)
 }
 
 // Writes a fixed amount of arbitrary data, defined by the length of the slice.
 func (w *Writer) WriteDataFixed(data []byte) error {
-	var amt int = 0
-	for amt < len(data) {
-		n, err := w.base.Write(data[amt:])
-		if err != nil {
-			return err
-		}
-		amt += n
-	}
-	return nil
+	return w.write(data)
 }
 
 // Writes arbitrary data whose length is encoded into the message.
@@ -104,13 +252,5 @@ func (w *Writer) WriteData(data []byte) error {
 	if err != nil {
 		return err
 	}
-	var amt int = 0
-	for amt < len(data) {
-		n, err := w.base.Write(data[amt:])
-		if err != nil {
-			return err
-		}
-		amt += n
-	}
-	return nil
+	return w.WriteDataFixed(data)
 }
@@ -2,6 +2,7 @@ package bare
 
 import (
 	"bytes"
+	"io/ioutil"
 	"math"
 	"testing"
 
@@ -152,3 +153,96 @@ func TestWriteData(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, []byte{0x03, 0x13, 0x37, 0x42}, b.Bytes())
 }
+
+func TestBytesWriter(t *testing.T) {
+	w := NewBytesWriter([]byte{0xFF})
+	assert.Nil(t, w.WriteUint(0x1337))
+	assert.Nil(t, w.WriteI16(-1234))
+	assert.Nil(t, w.WriteF32(1337.42))
+	assert.Nil(t, w.WriteBool(true))
+	assert.Nil(t, w.WriteString("hi"))
+	assert.Nil(t, w.WriteData([]byte{0x13, 0x37}))
+	assert.Equal(t, []byte{
+		0xFF,
+		0xB7, 0x26,
+		0x2E, 0xFB,
+		0x71, 0x2D, 0xA7, 0x44,
+		0x01,
+		0x02, 0x68, 0x69,
+		0x02, 0x13, 0x37,
+	}, w.Bytes())
+}
+
+func TestBufferedWriter(t *testing.T) {
+	b := bytes.NewBuffer([]byte{})
+	w := NewBufferedWriter(b, 4)
+
+	assert.Nil(t, w.WriteU16(0xCAFE))
+	assert.Nil(t, w.WriteString("a"))
+	assert.Equal(t, 0, b.Len())
+	assert.Equal(t, 4, w.Buffered())
+	assert.Equal(t, int64(4), w.Offset())
+
+	// Data which does not fit flushes the buffer, and larger data is written
+	// directly
+	assert.Nil(t, w.WriteDataFixed([]byte{1, 2, 3, 4, 5}))
+	assert.Equal(t, []byte{0xFE, 0xCA, 0x01, 'a', 1, 2, 3, 4, 5}, b.Bytes())
+	assert.Equal(t, 0, w.Buffered())
+
+	assert.Nil(t, w.WriteU8(6))
+	assert.Equal(t, 9, b.Len())
+	assert.Nil(t, w.Flush())
+	assert.Equal(t, []byte{0xFE, 0xCA, 0x01, 'a', 1, 2, 3, 4, 5, 6}, b.Bytes())
+	assert.Equal(t, int64(10), w.Offset())
+
+	// Writers without a buffer have nothing to flush
+	assert.Nil(t, NewWriter(b).Flush())
+	assert.Equal(t, 0, NewWriter(b).Buffered())
+}
+
+func TestWriterReset(t *testing.T) {
+	b1 := bytes.NewBuffer([]byte{})
+	w := EncodeOptions{Strict: true}.NewWriter(b1)
+	assert.Nil(t, w.WriteU8(1))
+	assert.Equal(t, int64(1), w.Offset())
+
+	b2 := bytes.NewBuffer([]byte{})
+	w.Reset(b2)
+	assert.Equal(t, int64(0), w.Offset())
+	assert.Nil(t, w.WriteU8(2))
+	assert.Equal(t, []byte{1}, b1.Bytes())
+	assert.Equal(t, []byte{2}, b2.Bytes())
+	// Options are kept
+	assert.Equal(t, ErrInvalidStr, w.WriteString("\xff"))
+
+	// Unflushed data is discarded
+	w = NewBufferedWriter(b1, 16)
+	assert.Nil(t, w.WriteU8(3))
+	w.Reset(b2)
+	assert.Nil(t, w.WriteU8(4))
+	assert.Nil(t, w.Flush())
+	assert.Equal(t, []byte{1}, b1.Bytes())
+	assert.Equal(t, []byte{2, 4}, b2.Bytes())
+
+	w = NewBytesWriter(nil)
+	assert.Nil(t, w.WriteU8(5))
+	w.Reset(nil)
+	assert.Nil(t, w.WriteU8(6))
+	assert.Equal(t, []byte{6}, w.Bytes())
+}
+
+func TestWriterAllocs(t *testing.T) {
+	w := NewBufferedWriter(ioutil.Discard, 64)
+	allocs := testing.AllocsPerRun(16, func() {
+		w.WriteUint(0x1337)
+		w.WriteInt(-1337)
+		w.WriteU16(0xCAFE)
+		w.WriteI32(-1234)
+		w.WriteU64(0xDEADBEEF)
+		w.WriteF64(1337.42)
+		w.WriteBool(true)
+		w.WriteString("hello")
+		w.Flush()
+	})
+	assert.Equal(t, 0.0, allocs)
+}